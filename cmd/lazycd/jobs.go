@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"lazycd/internal/core"
+	"lazycd/internal/store"
+)
+
+// runJobs implements `lazycd jobs`: maintenance of the saved job history.
+func runJobs(state *store.State, jobMgr *core.JobManager, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: lazycd jobs gc [--keep N] [--max-age-days N] [--orphans] [--dry-run]")
+	}
+	switch args[0] {
+	case "gc":
+		return runJobsGC(state, jobMgr, args[1:])
+	default:
+		return fmt.Errorf("unknown jobs command: %s", args[0])
+	}
+}
+
+// runJobsGC removes obsolete jobs and jobs beyond the retention limits,
+// with their trash and backups.
+func runJobsGC(state *store.State, jobMgr *core.JobManager, args []string) error {
+	flags := flag.NewFlagSet("jobs gc", flag.ExitOnError)
+	keep := flags.Int("keep", state.JobRetentionCount, "number of newest jobs kept (0 = all)")
+	days := flags.Int("max-age-days", state.JobRetentionDays, "remove jobs older than this many days (0 = no limit)")
+	orphans := flags.Bool("orphans", false, "also remove trash of unknown jobs that still holds files")
+	dryRun := flags.Bool("dry-run", false, "list what would be removed")
+	flags.Parse(args)
+
+	if *keep < 0 || *days < 0 {
+		return errors.New("--keep and --max-age-days must not be negative")
+	}
+
+	report, err := jobMgr.Prune(core.PruneOptions{
+		KeepJobs: *keep,
+		MaxAge:   retentionAge(*days),
+		Orphans:  *orphans,
+		DryRun:   *dryRun,
+	})
+	if report != nil {
+		printPrune(report, *dryRun)
+	}
+	return err
+}
+
+// retentionAge converts a retention in days to a duration, 0 = no limit.
+func retentionAge(days int) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func printPrune(report *core.PruneReport, dryRun bool) {
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	for _, sum := range report.Jobs {
+		fmt.Printf("%-6s %s  %s  %d items\n", sum.Type, sum.ID, sum.CreatedAt.Format("2006-01-02 15:04"), sum.Items)
+	}
+	for _, dir := range report.Orphans {
+		fmt.Printf("orphan %s\n", dir)
+	}
+	fmt.Printf("%s %d jobs and %d orphaned trash directories, %d bytes\n", verb, len(report.Jobs), len(report.Orphans), report.Bytes)
+}
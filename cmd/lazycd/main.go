@@ -33,6 +33,49 @@ func main() {
 		os.Exit(1)
 	}
 
+	core.SetRateLimit(state.RateLimit)
+	jobMgr.MaxRunning = state.MaxJobs
+
+	// Subcommands run without the TUI and leave the job history alone,
+	// so dry runs change nothing
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "put":
+			if err := runPut(state, jobMgr, os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		case "jobs":
+			if err := runJobs(state, jobMgr, os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		default:
+			fmt.Printf("Unknown command: %s\n", os.Args[1])
+			os.Exit(2)
+		}
+		if err := state.Save(); err != nil {
+			fmt.Printf("Error saving state: %v\n", err)
+		}
+		return
+	}
+
+	// Settle moves interrupted by a crash or failed cleanup
+	if _, err := jobMgr.RecoverAll(); err != nil {
+		fmt.Printf("Error recovering interrupted jobs: %v\n", err)
+	}
+
+	// Apply the configured job history retention
+	if state.JobRetentionCount > 0 || state.JobRetentionDays > 0 {
+		_, err := jobMgr.Prune(core.PruneOptions{
+			KeepJobs: state.JobRetentionCount,
+			MaxAge:   retentionAge(state.JobRetentionDays),
+		})
+		if err != nil {
+			fmt.Printf("Error pruning job history: %v\n", err)
+		}
+	}
+
 	// Initialize UI
 	g := ui.NewGui(state, jobMgr)
 
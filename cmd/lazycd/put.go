@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"lazycd/internal/core"
+	"lazycd/internal/store"
+)
+
+// runPut implements `lazycd put`: put the whole shelf into the target
+// directory without starting the TUI, or just print the plan with --dry-run.
+func runPut(state *store.State, jobMgr *core.JobManager, args []string) error {
+	flags := flag.NewFlagSet("put", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the plan without executing it")
+	asJSON := flags.Bool("json", false, "print the plan or job as JSON")
+	defaultPolicy := state.ConflictPolicy
+	if defaultPolicy == "" {
+		defaultPolicy = string(core.PolicySkip)
+	}
+	policy := flags.String("policy", defaultPolicy, "conflict policy: skip, rename, overwrite, newer, larger, size-differs or skip-identical")
+	target := flags.String("target", state.TargetDir, "target directory")
+	template := flags.String("rename-template", state.RenameTemplate, "name pattern for --policy rename, e.g. {name}_{n}{ext}")
+	force := flags.Bool("force", false, "run even if the preflight check blocks")
+	defaultSanitize := state.Sanitize
+	if defaultSanitize == "" {
+		defaultSanitize = string(core.SanitizeAuto)
+	}
+	sanitize := flags.String("sanitize", defaultSanitize, "rewrite names the target cannot store: auto (FAT/exFAT only), always or off")
+	flags.Parse(args)
+
+	if !core.ConflictPolicy(*policy).Valid() {
+		return fmt.Errorf("unknown policy: %s", *policy)
+	}
+	if err := core.ValidateRenameTemplate(*template); err != nil {
+		return err
+	}
+	if !core.SanitizeMode(*sanitize).Valid() {
+		return fmt.Errorf("unknown sanitize mode: %s", *sanitize)
+	}
+	if *target == "" {
+		return errors.New("no target directory (set one with t in lazycd or pass --target)")
+	}
+
+	items := make([]core.PutItem, 0, len(state.ShelfItems))
+	for _, item := range state.ShelfItems {
+		items = append(items, core.PutItem{Src: item.AbsPath, Op: string(item.OpMode)})
+	}
+
+	opts := core.PutOptions{
+		TargetDir:      *target,
+		Policy:         core.ConflictPolicy(*policy),
+		RenameTemplate: *template,
+		Verify:         core.HashAlgo(state.VerifyAlgo),
+		Parallelism:    state.Parallelism,
+		Force:          *force,
+		Sanitize:       core.SanitizeMode(*sanitize),
+	}
+	plan := core.PlanPut(items, opts)
+
+	if *dryRun {
+		if *asJSON {
+			return printJSON(plan)
+		}
+		printPlan(plan)
+		return nil
+	}
+
+	job, err := jobMgr.ExecutePlan(plan, opts)
+	if err != nil {
+		if !*asJSON {
+			printPreflight(plan.Preflight)
+		}
+		return err
+	}
+	state.RemoveShelfPaths(job.Succeeded("move"))
+
+	if *asJSON {
+		return printJSON(job)
+	}
+	for _, item := range job.Items {
+		line := fmt.Sprintf("%-7s %-4s %s", item.Status, item.Op, item.Src)
+		if item.Dst != "" {
+			line += " -> " + item.Dst
+		}
+		if item.Comparison != "" {
+			line += " [" + string(item.Comparison) + "]"
+		}
+		if item.Error != "" {
+			line += ": " + item.Error
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func printPlan(plan *core.Plan) {
+	for _, item := range plan.Items {
+		line := fmt.Sprintf("%-9s %-4s %s", item.Outcome, item.Op, item.Src)
+		if item.Dst != "" {
+			line += " -> " + item.Dst
+		}
+		if item.Comparison != "" {
+			line += " [" + string(item.Comparison) + "]"
+		}
+		if item.Existing != "" && item.Existing != item.Target {
+			line += " (collides with " + filepath.Base(item.Existing) + ")"
+		}
+		if len(item.Renamed) > 0 {
+			line += fmt.Sprintf(" (sanitized; %d entries inside renamed)", len(item.Renamed))
+		} else if item.Sanitized() {
+			line += " (sanitized)"
+		}
+		if item.SameDevice {
+			line += " (rename)"
+		} else if item.Runnable() {
+			line += fmt.Sprintf(" (%d bytes)", item.Bytes)
+		}
+		fmt.Println(line)
+		for _, e := range item.Errors {
+			fmt.Printf("          ! %s\n", e)
+		}
+	}
+	fmt.Printf("%d items, %d bytes to write into %s\n", len(plan.Items), plan.TotalBytes, plan.TargetDir)
+	if plan.Sanitize {
+		fsType := plan.FSType
+		if fsType == "" {
+			fsType = "unknown"
+		}
+		fmt.Printf("Names are sanitized (target filesystem: %s)\n", fsType)
+	}
+	printPreflight(plan.Preflight)
+}
+
+func printPreflight(pf *core.Preflight) {
+	for _, line := range pf.Report() {
+		fmt.Println(line)
+	}
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,417 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"lazycd/internal/fs"
+)
+
+// JobArchive is a put that writes its items into a new archive file.
+const JobArchive JobType = "archive"
+
+// ArchiveFormat is the format of an archive written by an archive job.
+type ArchiveFormat string
+
+const (
+	FormatZip    ArchiveFormat = "zip"
+	FormatTar    ArchiveFormat = "tar"
+	FormatTarGz  ArchiveFormat = "tar.gz"
+	FormatTarZst ArchiveFormat = "tar.zst"
+)
+
+// ArchiveFormats lists the selectable formats in cycling order.
+var ArchiveFormats = []ArchiveFormat{FormatZip, FormatTar, FormatTarGz, FormatTarZst}
+
+// Ext returns the file name extension of the format, with the dot.
+func (f ArchiveFormat) Ext() string {
+	return "." + string(f)
+}
+
+// ArchiveLayout decides the member names of the items of an archive.
+type ArchiveLayout string
+
+const (
+	LayoutFlat     ArchiveLayout = "flat"     // Every item at the top under its base name
+	LayoutRelative ArchiveLayout = "relative" // Paths relative to the items' common parent
+	LayoutFull     ArchiveLayout = "full"     // Full paths without the leading slash
+)
+
+// ArchiveLayouts lists the selectable layouts in cycling order.
+var ArchiveLayouts = []ArchiveLayout{LayoutFlat, LayoutRelative, LayoutFull}
+
+// ArchiveSpec describes the archive an archive job writes into the
+// target directory.
+type ArchiveSpec struct {
+	Name   string        `json:"name"`
+	Format ArchiveFormat `json:"format"`
+	Layout ArchiveLayout `json:"layout"`
+}
+
+// FormatFor returns the format named by the extension of name, "" if it
+// has none of ArchiveFormats.
+func FormatFor(name string) ArchiveFormat {
+	lower := strings.ToLower(name)
+	for _, f := range ArchiveFormats {
+		if strings.HasSuffix(lower, f.Ext()) {
+			return f
+		}
+	}
+	return ""
+}
+
+// MemberNames returns the name in the archive of every source.
+func MemberNames(srcs []string, layout ArchiveLayout) []string {
+	names := make([]string, len(srcs))
+	common := commonParent(srcs)
+	for i, src := range srcs {
+		switch layout {
+		case LayoutRelative:
+			rel, err := filepath.Rel(common, src)
+			if err != nil {
+				rel = filepath.Base(src)
+			}
+			names[i] = filepath.ToSlash(rel)
+		case LayoutFull:
+			names[i] = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(src)), "/")
+		default:
+			names[i] = filepath.Base(src)
+		}
+	}
+	return names
+}
+
+// commonParent returns the deepest directory containing every path.
+func commonParent(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	common := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for !strings.HasPrefix(p, common+string(filepath.Separator)) && common != filepath.Dir(common) {
+			common = filepath.Dir(common)
+		}
+	}
+	return common
+}
+
+// PlanArchive predicts writing srcs into the archive spec.Name in
+// opts.TargetDir. Items are the members of the archive; their Dst is the
+// path of the member inside the new archive. The archive is written in
+// one go, so an existing file of that name is an error rather than a
+// conflict to resolve.
+func PlanArchive(srcs []string, spec ArchiveSpec, opts PutOptions) *Plan {
+	plan := &Plan{
+		Type:      JobArchive,
+		TargetDir: opts.TargetDir,
+		Items:     make([]PlanItem, len(srcs)),
+		Archive:   &spec,
+	}
+	archive := plan.ArchivePath()
+	_, statErr := fs.Lstat(archive)
+
+	names := MemberNames(srcs, spec.Layout)
+	for i, src := range srcs {
+		pi := &plan.Items[i]
+		pi.Src = src
+		pi.Op = "archive"
+		pi.Target = filepath.Join(archive, filepath.FromSlash(names[i]))
+		pi.Outcome = OutcomeCreate
+
+		switch {
+		case spec.Name == "" || strings.ContainsRune(spec.Name, filepath.Separator):
+			pi.Outcome = OutcomeError
+			pi.addError("invalid archive name '%s'", spec.Name)
+		case statErr == nil:
+			pi.Outcome = OutcomeError
+			pi.addError("'%s' exists", archive)
+		default:
+			if _, err := fs.Lstat(src); err != nil {
+				pi.Outcome = OutcomeError
+				pi.addError("source: %v", err)
+			}
+		}
+	}
+
+	plan.predictArchive()
+	return plan
+}
+
+// ArchivePath returns the archive file an archive plan writes.
+func (p *Plan) ArchivePath() string {
+	if p.Archive == nil {
+		return ""
+	}
+	return filepath.Join(p.TargetDir, p.Archive.Name)
+}
+
+// predictArchive fills in the destination and bytes of every runnable
+// item of an archive plan and flags members stored twice.
+func (p *Plan) predictArchive() {
+	p.TotalBytes = 0
+	members := make(map[string]bool)
+	for i := range p.Items {
+		pi := &p.Items[i]
+		pi.Dst = ""
+		pi.Bytes = 0
+		if !pi.Runnable() {
+			continue
+		}
+		pi.Errors = nil
+
+		if members[pi.Target] {
+			pi.addError("'%s' is already a member of this archive", filepath.Base(pi.Target))
+		}
+		members[pi.Target] = true
+		if !canRead(pi.Src) {
+			pi.addError("no permission to read %s", pi.Src)
+		}
+
+		pi.Dst = pi.Target
+		pi.Bytes, _ = PathSize(pi.Src)
+		p.TotalBytes += pi.Bytes
+	}
+	p.preflight()
+}
+
+// archiveAll writes the pending items of an archive job into its archive.
+// The archive is written as a whole: if it fails or is canceled, nothing
+// is kept and every item gets the error.
+func (jm *JobManager) archiveAll(job *Job) {
+	if len(job.pending) == 0 {
+		return
+	}
+
+	job.mu.Lock()
+	archive := job.Items[job.pending[0]].CreatedPath
+	members := make([]archiveSource, len(job.pending))
+	for n, idx := range job.pending {
+		item := job.Items[idx]
+		rel, _ := filepath.Rel(archive, item.Dst)
+		members[n] = archiveSource{src: item.Src, name: filepath.ToSlash(rel)}
+	}
+	job.mu.Unlock()
+
+	err := job.ctl.wait()
+	if err == nil {
+		err = writeArchive(archive, job.plan.Archive.Format, members, job.ctl)
+	}
+	var fp *Fingerprint
+	if err == nil {
+		fp, _ = TakeFingerprint(archive)
+	}
+
+	for _, idx := range job.pending {
+		job.updateItem(idx, func(ji *JobItem) {
+			ji.setResult(err)
+			if err != nil {
+				ji.CreatedPath = ""
+			} else if ji.CreatedPath != "" {
+				ji.Fingerprint = fp
+			}
+		})
+	}
+	jm.changed(job)
+}
+
+// archiveSource is an item to store: the tree at src under name.
+type archiveSource struct {
+	src  string
+	name string
+}
+
+// writeArchive creates the archive file path in format with the members,
+// removing it again if anything fails. Member contents go through ctl, so
+// progress counts uncompressed bytes and the job can pause or cancel.
+func writeArchive(path string, format ArchiveFormat, members []archiveSource, ctl *jobControl) (err error) {
+	f, err := fs.Create(path, 0644, true)
+	if err != nil {
+		return conflictSincePlanning(path, err)
+	}
+	defer func() {
+		if err != nil {
+			fs.Abort(f)
+			fs.Remove(path)
+		}
+	}()
+
+	buf := bufio.NewWriter(throttled(f))
+	aw, err := newArchiveWriter(buf, format, ctl)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := addTree(aw, m, ctl); err != nil {
+			aw.Close()
+			return err
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := fs.Sync(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// addTree stores the tree of m in the archive.
+func addTree(aw archiveWriter, m archiveSource, ctl *jobControl) error {
+	return fs.WalkDir(m.src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctl.wait(); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(m.src, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(m.name, filepath.ToSlash(rel))
+
+		switch {
+		case info.IsDir():
+			return aw.add(name, info, "", nil)
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := fs.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return aw.add(name, info, target, nil)
+		case info.Mode().IsRegular():
+			r, err := fs.Open(p)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return aw.add(name, info, "", r)
+		default:
+			return fmt.Errorf("%s: cannot archive %s", p, info.Mode().Type())
+		}
+	})
+}
+
+// archiveWriter adds entries to an archive being written. Contents are
+// given for regular files only, link for symlinks only.
+type archiveWriter interface {
+	add(name string, info os.FileInfo, link string, r io.Reader) error
+	Close() error
+}
+
+// controlled counts writes into w against ctl, if there is one.
+func controlled(w io.Writer, ctl *jobControl) io.Writer {
+	if ctl == nil {
+		return w
+	}
+	return controlledWriter{w: w, ctl: ctl}
+}
+
+func newArchiveWriter(w io.Writer, format ArchiveFormat, ctl *jobControl) (archiveWriter, error) {
+	switch format {
+	case FormatZip:
+		return &zipWriter{zw: zip.NewWriter(w), ctl: ctl}, nil
+	case FormatTar:
+		return &tarWriter{tw: tar.NewWriter(w), ctl: ctl}, nil
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarWriter{tw: tar.NewWriter(gz), compressor: gz, ctl: ctl}, nil
+	case FormatTarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(zw), compressor: zw, ctl: ctl}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format: %s", format)
+}
+
+type tarWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser // nil for plain tar
+	ctl        *jobControl
+}
+
+func (t *tarWriter) add(name string, info os.FileInfo, link string, r io.Reader) error {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Uname, hdr.Gname = "", ""
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+	n, err := io.Copy(controlled(t.tw, t.ctl), r)
+	if err == nil && n != hdr.Size {
+		err = fmt.Errorf("%s changed size while archiving", name)
+	}
+	return err
+}
+
+func (t *tarWriter) Close() error {
+	err := t.tw.Close()
+	if t.compressor != nil {
+		if cerr := t.compressor.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+type zipWriter struct {
+	zw  *zip.Writer
+	ctl *jobControl
+}
+
+func (z *zipWriter) add(name string, info os.FileInfo, link string, r io.Reader) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	} else if r != nil {
+		hdr.Method = zip.Deflate
+	}
+	w, err := z.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if link != "" {
+		_, err = io.WriteString(w, link) // Zip stores the target as the contents
+		return err
+	}
+	if r != nil {
+		_, err = io.Copy(controlled(w, z.ctl), r)
+	}
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
@@ -1,10 +1,15 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"lazycd/internal/fs"
 )
 
 type ConflictPolicy string
@@ -13,18 +18,138 @@ const (
 	PolicySkip      ConflictPolicy = "skip"
 	PolicyOverwrite ConflictPolicy = "overwrite"
 	PolicyRename    ConflictPolicy = "rename"
+
+	// Content-aware policies compare src with the existing dst and either
+	// overwrite it or skip the item.
+	PolicyNewer         ConflictPolicy = "newer"          // Overwrite if src is newer
+	PolicyLarger        ConflictPolicy = "larger"         // Overwrite if src is larger
+	PolicySizeDiffers   ConflictPolicy = "size-differs"   // Overwrite if sizes differ
+	PolicySkipIdentical ConflictPolicy = "skip-identical" // Skip identical contents, overwrite otherwise
 )
 
-// CheckConflict returns whether the destination exists.
-func CheckConflict(dst string) (bool, error) {
-	_, err := os.Stat(dst)
-	if err == nil {
-		return true, nil // Exists
+// Policies lists every conflict policy in cycling order.
+var Policies = []ConflictPolicy{
+	PolicySkip, PolicyRename, PolicyOverwrite,
+	PolicyNewer, PolicyLarger, PolicySizeDiffers, PolicySkipIdentical,
+}
+
+// Comparison is the result of comparing src with an existing dst under a
+// content-aware policy.
+type Comparison string
+
+const (
+	CmpSrcNewer   Comparison = "src-newer"
+	CmpSrcOlder   Comparison = "src-older"
+	CmpSameTime   Comparison = "same-mtime"
+	CmpSrcLarger  Comparison = "src-larger"
+	CmpSrcSmaller Comparison = "src-smaller"
+	CmpSameSize   Comparison = "same-size"
+	CmpIdentical  Comparison = "identical"
+	CmpDifferent  Comparison = "different"
+)
+
+// Compares reports whether the policy decides by comparing src and dst.
+func (p ConflictPolicy) Compares() bool {
+	switch p {
+	case PolicyNewer, PolicyLarger, PolicySizeDiffers, PolicySkipIdentical:
+		return true
 	}
-	if os.IsNotExist(err) {
-		return false, nil // Does not exist
+	return false
+}
+
+// Valid reports whether p is a known policy.
+func (p ConflictPolicy) Valid() bool {
+	for _, known := range Policies {
+		if p == known {
+			return true
+		}
 	}
-	return false, err // Other error
+	return false
+}
+
+// Compare evaluates a content-aware policy against an existing dst and
+// reports whether src should overwrite it, together with the comparison
+// that decided. algo is used for PolicySkipIdentical (HashXXH64 if none).
+func Compare(src, dst string, policy ConflictPolicy, algo HashAlgo) (bool, Comparison, error) {
+	srcInfo, err := fs.Lstat(src)
+	if err != nil {
+		return false, "", err
+	}
+	dstInfo, err := fs.Lstat(dst)
+	if err != nil {
+		return false, "", err
+	}
+
+	switch policy {
+	case PolicyNewer:
+		switch {
+		case srcInfo.ModTime().After(dstInfo.ModTime()):
+			return true, CmpSrcNewer, nil
+		case srcInfo.ModTime().Before(dstInfo.ModTime()):
+			return false, CmpSrcOlder, nil
+		default:
+			return false, CmpSameTime, nil
+		}
+
+	case PolicyLarger, PolicySizeDiffers:
+		srcSize, err := PathSize(src)
+		if err != nil {
+			return false, "", err
+		}
+		dstSize, err := PathSize(dst)
+		if err != nil {
+			return false, "", err
+		}
+		switch {
+		case srcSize > dstSize:
+			return true, CmpSrcLarger, nil
+		case srcSize < dstSize:
+			return policy == PolicySizeDiffers, CmpSrcSmaller, nil
+		default:
+			return false, CmpSameSize, nil
+		}
+
+	case PolicySkipIdentical:
+		if srcInfo.Mode().Type() != dstInfo.Mode().Type() {
+			return true, CmpDifferent, nil
+		}
+		// Cheap size check before hashing
+		srcSize, err := PathSize(src)
+		if err != nil {
+			return false, "", err
+		}
+		dstSize, err := PathSize(dst)
+		if err != nil {
+			return false, "", err
+		}
+		if srcSize != dstSize {
+			return true, CmpDifferent, nil
+		}
+		if algo == HashNone {
+			algo = HashXXH64
+		}
+		if _, err := VerifyCopy(src, dst, algo); err != nil {
+			if errors.Is(err, ErrChecksumMismatch) {
+				return true, CmpDifferent, nil
+			}
+			return false, "", err
+		}
+		return false, CmpIdentical, nil
+
+	default:
+		return false, "", fmt.Errorf("policy %s does not compare contents", policy)
+	}
+}
+
+// CheckConflict returns whether the destination exists. Names differing
+// only in case (on case-insensitive filesystems) or Unicode normalization
+// count as existing, see FindExisting.
+func CheckConflict(dst string) (bool, error) {
+	existing, err := FindExisting(dst)
+	if err != nil {
+		return false, err // Other error
+	}
+	return existing != "", nil
 }
 
 // ResolveConflict returns the final path to use based on the policy.
@@ -32,12 +157,12 @@ func CheckConflict(dst string) (bool, error) {
 // If PolicyRename, returns a new non-conflicting path.
 // If PolicyOverwrite, returns original dst (but checks safety).
 func ResolveConflict(src, dst string, policy ConflictPolicy) (string, error) {
-	exists, err := CheckConflict(dst)
+	existing, err := FindExisting(dst)
 	if err != nil {
 		return "", err
 	}
 	
-	if !exists {
+	if existing == "" {
 		return dst, nil
 	}
 	
@@ -46,39 +171,176 @@ func ResolveConflict(src, dst string, policy ConflictPolicy) (string, error) {
 		return "", nil // Skip this item
 		
 	case PolicyOverwrite:
-		// Safety check: Cannot overwrite directory with file or vice-versa easily without recursive delete.
-		// Spec says: "dst가 폴더면 overwrite 불가"
-		dstInfo, err := os.Stat(dst)
-		if err != nil {
-			return "", err
-		}
-		if dstInfo.IsDir() {
-			return "", fmt.Errorf("cannot overwrite directory '%s'", dst)
-		}
-		// If src is dir and dst is file -> error? Not explicitly said but usually logic error.
-		// For now assume we proceed with overwrite (caller handles backup)
-		return dst, nil
+		return overwritable(existing)
 		
 	case PolicyRename:
-		return findFreeName(dst)
+		return findFreeName(dst, nil, "")
+		
+	case PolicyNewer, PolicyLarger, PolicySizeDiffers, PolicySkipIdentical:
+		if isDir(src) && isDir(existing) {
+			return "", nil // Only a plan can merge directories, skip
+		}
+		overwrite, _, err := Compare(src, existing, policy, HashNone)
+		if err != nil || !overwrite {
+			return "", err
+		}
+		return overwritable(existing)
 		
 	default:
 		return "", fmt.Errorf("unknown policy: %s", policy)
 	}
 }
 
-// findFreeName generates name (1).ext, name (2).ext ...
-func findFreeName(path string) (string, error) {
-	ext := filepath.Ext(path)
-	baseNoExt := strings.TrimSuffix(filepath.Base(path), ext)
+// overwritable returns dst if it may be replaced by an overwrite.
+func overwritable(dst string) (string, error) {
+	// Safety check: Cannot overwrite directory with file or vice-versa easily without recursive delete.
+	// Spec says: "dst가 폴더면 overwrite 불가"
+	dstInfo, err := fs.Stat(dst)
+	if err != nil {
+		return "", err
+	}
+	if dstInfo.IsDir() {
+		return "", fmt.Errorf("cannot overwrite directory '%s'", dst)
+	}
+	// If src is dir and dst is file -> error? Not explicitly said but usually logic error.
+	// For now assume we proceed with overwrite (caller handles backup)
+	return dst, nil
+}
+
+// DefaultRenameTemplate reproduces the classic "name (N).ext" scheme.
+const DefaultRenameTemplate = "{name} ({n}){ext}"
+
+// maxRenameIndex bounds the numbering of findFreeName.
+const maxRenameIndex = 10000
+
+// compoundExts are multi-part extensions kept together when renaming, so
+// "archive.tar.gz" becomes "archive (1).tar.gz" and not "archive.tar (1).gz".
+var compoundExts = []string{
+	".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tar.lz4", ".tar.lz", ".tar.br", ".tar.z",
+}
+
+// SplitExt splits a file name into base and extension, keeping compound
+// extensions like .tar.gz intact. Dotfiles such as ".bashrc" have no
+// extension.
+func SplitExt(name string) (string, string) {
+	lower := strings.ToLower(name)
+	for _, ext := range compoundExts {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			cut := len(name) - len(ext)
+			return name[:cut], name[cut:]
+		}
+	}
+	ext := filepath.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// ExpandRenameTemplate fills in a rename template. Supported placeholders
+// are {name} (base without extension), {ext} (including the dot), {n}
+// (counter) and {date} (YYYY-MM-DD).
+func ExpandRenameTemplate(tmpl, name, ext string, n int, now time.Time) string {
+	return strings.NewReplacer(
+		"{name}", name,
+		"{ext}", ext,
+		"{n}", strconv.Itoa(n),
+		"{date}", now.Format("2006-01-02"),
+	).Replace(tmpl)
+}
+
+// ValidateRenameTemplate rejects a template that would put renamed
+// entries outside their directory.
+func ValidateRenameTemplate(tmpl string) error {
+	if strings.ContainsAny(tmpl, "/"+string(filepath.Separator)) {
+		return fmt.Errorf("rename template %q contains a path separator", tmpl)
+	}
+	return nil
+}
+
+// checkRenameName rejects an expanded template that is not a plain name.
+func checkRenameName(tmpl, name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return fmt.Errorf("rename template %q gives the invalid name %q", tmpl, name)
+	}
+	return nil
+}
+
+// findFreeName picks the first free name for path according to tmpl
+// (DefaultRenameTemplate if empty). The directory is read once; paths in
+// reserved are treated as taken even if they do not exist yet.
+//
+// The result is only free at the time of the scan; use ClaimPath to take
+// it race-free.
+func findFreeName(path string, reserved map[string]struct{}, tmpl string) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultRenameTemplate
+	}
+	if err := ValidateRenameTemplate(tmpl); err != nil {
+		return "", err
+	}
 	dir := filepath.Dir(path)
-	
-	for i := 1; i < 10000; i++ {
-		newName := fmt.Sprintf("%s (%d)%s", baseNoExt, i, ext)
-		newPath := filepath.Join(dir, newName)
-		if _, err := os.Stat(newPath); os.IsNotExist(err) {
-			return newPath, nil
+
+	// Names are compared folded, so case and normalization variants of
+	// existing entries count as taken
+	sensitive := CaseSensitive(dir)
+	taken := make(map[string]struct{})
+	entries, err := fs.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for _, entry := range entries {
+		taken[foldName(entry.Name(), sensitive)] = struct{}{}
+	}
+	for p := range reserved {
+		if filepath.Dir(p) == dir {
+			taken[foldName(filepath.Base(p), sensitive)] = struct{}{}
+		}
+	}
+	isFree := func(name string) bool {
+		_, ok := taken[foldName(name, sensitive)]
+		return !ok
+	}
+
+	name, ext := SplitExt(filepath.Base(path))
+	now := time.Now()
+
+	// Templates without a counter get one appended if their result is taken
+	if !strings.Contains(tmpl, "{n}") {
+		candidate := ExpandRenameTemplate(tmpl, name, ext, 0, now)
+		if err := checkRenameName(tmpl, candidate); err != nil {
+			return "", err
+		}
+		if isFree(candidate) {
+			return filepath.Join(dir, candidate), nil
+		}
+		name, ext = SplitExt(candidate)
+		tmpl = DefaultRenameTemplate
+	}
+
+	for i := 1; i < maxRenameIndex; i++ {
+		candidate := ExpandRenameTemplate(tmpl, name, ext, i, now)
+		if err := checkRenameName(tmpl, candidate); err != nil {
+			return "", err
+		}
+		if isFree(candidate) {
+			return filepath.Join(dir, candidate), nil
 		}
 	}
 	return "", fmt.Errorf("failed to find free name for %s", path)
 }
+
+// ClaimPath atomically creates an empty placeholder at path (a directory
+// if mode is one, a file otherwise) so no other process can take the name
+// between choosing and writing it. It fails with an os.ErrExist error if
+// path already exists.
+func ClaimPath(path string, mode os.FileMode) error {
+	if mode.IsDir() {
+		return fs.Mkdir(path, mode.Perm())
+	}
+	f, err := fs.Create(path, mode.Perm(), true)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,80 @@
+//go:build unix
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"lazycd/internal/fs"
+)
+
+// deviceID returns the device number of the filesystem holding path.
+func deviceID(path string) (uint64, bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// inodeOf returns the inode number of info, 0 if unknown.
+func inodeOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
+
+// sameDevice reports whether a and b live on the same filesystem, i.e.
+// whether a rename between them can succeed without copying.
+func sameDevice(a, b string) bool {
+	if !fs.IsLocal(a) || !fs.IsLocal(b) {
+		return fs.SameFS(a, b)
+	}
+	da, ok := deviceID(a)
+	if !ok {
+		return false
+	}
+	db, ok := deviceID(b)
+	return ok && da == db
+}
+
+// freeSpace returns the bytes available to unprivileged users on the
+// filesystem holding path.
+func freeSpace(path string) (uint64, error) {
+	if !fs.IsLocal(path) {
+		return 0, fmt.Errorf("free space of %s is unknown", path)
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// canWrite reports whether entries can be created or removed in dir.
+// Archives are read-only; permissions on mounted filesystems only show
+// when writing.
+func canWrite(dir string) bool {
+	if !fs.IsLocal(dir) {
+		return !fs.InArchive(dir)
+	}
+	return unix.Access(dir, unix.W_OK|unix.X_OK) == nil
+}
+
+// canRead reports whether path can be read.
+func canRead(path string) bool {
+	host := fs.HostPath(path)
+	if !fs.IsLocal(host) {
+		return true
+	}
+	return unix.Access(host, unix.R_OK) == nil
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+func deviceID(path string) (uint64, bool) { return 0, false }
+
+func inodeOf(info os.FileInfo) uint64 { return 0 }
+
+func sameDevice(a, b string) bool { return false }
+
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space check not supported on this platform")
+}
+
+func canWrite(dir string) bool { return true }
+
+func canRead(path string) bool { return true }
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"lazycd/internal/fs"
+)
+
+// caseCache remembers CaseSensitive per directory. Case folding can be
+// set per directory (e.g. ext4 casefold), so the device is not enough.
+var caseCache sync.Map // dir -> bool
+
+// CaseSensitive reports whether names in dir are case sensitive. It looks
+// for an existing entry whose swapped-case name resolves to the same file;
+// if dir has none, the filesystem type decides (see guessCaseSensitive).
+// Nothing is created, as planning must not touch the filesystem. Remote
+// directories count as case sensitive.
+func CaseSensitive(dir string) bool {
+	if !fs.IsLocal(dir) {
+		return true
+	}
+	if v, ok := caseCache.Load(dir); ok {
+		return v.(bool)
+	}
+	sensitive, ok := probeCaseSensitive(dir)
+	if !ok {
+		// Not cached: a later entry can still tell for sure
+		return guessCaseSensitive(dir)
+	}
+	caseCache.Store(dir, sensitive)
+	return sensitive
+}
+
+// probeCaseSensitive checks the entries of dir. ok is false if none of
+// them has a name with case to swap.
+func probeCaseSensitive(dir string) (sensitive, ok bool) {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return true, false
+	}
+	for _, entry := range entries {
+		swapped := swapCase(entry.Name())
+		if swapped == entry.Name() {
+			continue
+		}
+		orig, err := fs.Lstat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		other, err := fs.Lstat(filepath.Join(dir, swapped))
+		if err != nil {
+			return true, true
+		}
+		return !os.SameFile(orig, other), true
+	}
+	return true, false
+}
+
+// guessCaseSensitive goes by the filesystem holding dir: FAT, exFAT, NTFS
+// and the macOS defaults ignore case, as does anything on Windows.
+func guessCaseSensitive(dir string) bool {
+	fsType := FilesystemType(dir)
+	switch {
+	case Restrictive(fsType), fsType == "apfs", fsType == "hfs":
+		return false
+	case runtime.GOOS == "windows":
+		return false
+	}
+	return true
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// foldName returns the key two names collide on: NFC normalized, and
+// lower-cased if the filesystem ignores case.
+func foldName(name string, caseSensitive bool) string {
+	name = norm.NFC.String(name)
+	if !caseSensitive {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// FindExisting returns the path dst would collide with: dst itself, or a
+// sibling whose name differs only in Unicode normalization (NFC vs NFD)
+// or, on case-insensitive filesystems, in case. It returns "" if dst is
+// free.
+func FindExisting(dst string) (string, error) {
+	_, err := fs.Lstat(dst)
+	if err == nil {
+		return dst, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	dir := filepath.Dir(dst)
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	sensitive := CaseSensitive(dir)
+	want := foldName(filepath.Base(dst), sensitive)
+	for _, entry := range entries {
+		if foldName(entry.Name(), sensitive) == want {
+			return filepath.Join(dir, entry.Name()), nil
+		}
+	}
+	return "", nil
+}
+
+// samePathName reports whether a and b name the same entry once case and
+// normalization rules of their directory are applied.
+func samePathName(a, b string) bool {
+	if a == b {
+		return true
+	}
+	dir := filepath.Dir(a)
+	if dir != filepath.Dir(b) {
+		return false
+	}
+	sensitive := CaseSensitive(dir)
+	return foldName(filepath.Base(a), sensitive) == foldName(filepath.Base(b), sensitive)
+}
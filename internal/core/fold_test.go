@@ -0,0 +1,32 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaseSensitiveCreatesNothing(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "123"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	CaseSensitive(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d entries, want only the existing one", len(entries))
+	}
+}
+
+func TestCaseSensitiveRemote(t *testing.T) {
+	root := mountMem(t, "remote")
+	writeFile(t, filepath.Join(root, "File"), "x")
+
+	if !CaseSensitive(root) {
+		t.Error("remote directory reported case insensitive")
+	}
+}
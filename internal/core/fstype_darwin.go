@@ -0,0 +1,25 @@
+//go:build darwin
+
+package core
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+
+	"lazycd/internal/fs"
+)
+
+// FilesystemType returns the name of the filesystem holding path, or ""
+// if it cannot be determined.
+func FilesystemType(path string) string {
+	if !fs.IsLocal(path) {
+		return ""
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(existingAncestor(path), &st); err != nil {
+		return ""
+	}
+	name, _, _ := bytes.Cut(st.Fstypename[:], []byte{0})
+	return string(name)
+}
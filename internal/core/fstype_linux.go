@@ -0,0 +1,81 @@
+//go:build linux
+
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"lazycd/internal/fs"
+)
+
+// Filesystem magic numbers from statfs(2) that matter for naming rules.
+// exfat, ntfs3 and fuse are not defined by x/sys.
+var fsMagic = map[int64]string{
+	unix.MSDOS_SUPER_MAGIC: "vfat",
+	0x2011BAB0:             "exfat",
+	0x5346544e:             "ntfs",
+	0x7366746e:             "ntfs",
+	0x65735546:             "fuse",
+	unix.EXT4_SUPER_MAGIC:  "ext4",
+	unix.BTRFS_SUPER_MAGIC: "btrfs",
+	unix.XFS_SUPER_MAGIC:   "xfs",
+	unix.TMPFS_MAGIC:       "tmpfs",
+}
+
+// FilesystemType returns the name of the filesystem holding path, or ""
+// if it cannot be determined. FUSE mounts are named by their type in
+// /proc/self/mountinfo, such as "fuseblk" or "fuse.exfat", as the magic
+// number is the same for all of them.
+func FilesystemType(path string) string {
+	if !fs.IsLocal(path) {
+		return ""
+	}
+	dir := existingAncestor(path)
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	fsType := fsMagic[int64(st.Type)]
+	if fsType == "fuse" {
+		if mounted := mountType(dir); mounted != "" {
+			return mounted
+		}
+	}
+	return fsType
+}
+
+// mountType returns the type /proc/self/mountinfo lists for the mount
+// holding dir, or "" if it cannot be found.
+func mountType(dir string) string {
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return ""
+	}
+	dev := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// ID parent major:minor root mountpoint options [optional...] - type source ...
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[2] != dev {
+			continue
+		}
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) {
+				return fields[i+1]
+			}
+		}
+	}
+	return ""
+}
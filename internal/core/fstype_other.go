@@ -0,0 +1,6 @@
+//go:build !linux && !darwin
+
+package core
+
+// FilesystemType returns "" where the filesystem type cannot be queried.
+func FilesystemType(path string) string { return "" }
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// indexFile is the name of the job index inside JobsDir, indexLockFile
+// that of the lock serializing its updates between lazycd instances.
+const (
+	indexFile     = "index.json"
+	indexLockFile = "index.lock"
+)
+
+// JobSummary is the index entry of a saved job, enough to pick jobs for
+// undo, recovery and pruning without reading every job file.
+type JobSummary struct {
+	ID        string    `json:"id"`
+	Type      JobType   `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	State     JobState  `json:"state,omitempty"`
+	Items     int       `json:"items"`
+	Undoable  bool      `json:"undoable"`  // Some item changed the filesystem
+	Unsettled bool      `json:"unsettled"` // Recover has something to do
+}
+
+// summary returns the index entry of job. The caller holds job.mu.
+func (job *Job) summary() JobSummary {
+	sum := JobSummary{
+		ID:        job.ID,
+		Type:      job.Type,
+		CreatedAt: job.CreatedAt,
+		State:     job.State,
+		Items:     len(job.Items),
+		Unsettled: !job.State.Done(),
+	}
+	for _, item := range job.Items {
+		if item.undoable() {
+			sum.Undoable = true
+		}
+		if item.needsSettling() {
+			sum.Unsettled = true
+		}
+	}
+	return sum
+}
+
+// isJobFile reports whether a JobsDir entry is a saved job.
+func isJobFile(name string) bool {
+	return filepath.Ext(name) == ".json" && name != indexFile
+}
+
+func (jm *JobManager) jobPath(id string) string {
+	return filepath.Join(jm.JobsDir, id+".json")
+}
+
+// jobLockPath is the file lockJob locks. It is separate from the job file,
+// which SaveJob replaces by a rename.
+func (jm *JobManager) jobLockPath(id string) string {
+	return filepath.Join(jm.JobsDir, id+".lock")
+}
+
+// loadJob reads a saved job.
+func (jm *JobManager) loadJob(id string) (*Job, error) {
+	data, err := os.ReadFile(jm.jobPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// withIndex runs fn with the index loaded and up to date. jm.indexMu and
+// the index lock file keep other goroutines and other instances from
+// changing it in between, so fn may write it.
+func (jm *JobManager) withIndex(fn func() error) error {
+	jm.indexMu.Lock()
+	defer jm.indexMu.Unlock()
+	lock, err := jm.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := jm.loadIndex(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// loadIndex reads the index on first use, and again whenever another
+// instance wrote it since, and reconciles it with the job files on disk:
+// jobs missing from the index (e.g. saved by an older version) are read
+// once, entries without a file are dropped. The caller holds jm.indexMu
+// and the index lock.
+func (jm *JobManager) loadIndex() error {
+	path := filepath.Join(jm.JobsDir, indexFile)
+	info, err := os.Stat(path)
+	if jm.index != nil && jm.indexUnchanged(info, err) {
+		return nil
+	}
+
+	index := make(map[string]JobSummary)
+	if data, err := os.ReadFile(path); err == nil {
+		var entries []JobSummary
+		if json.Unmarshal(data, &entries) == nil {
+			for _, sum := range entries {
+				index[sum.ID] = sum
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(jm.JobsDir)
+	if err != nil {
+		return err
+	}
+	onDisk := make(map[string]bool)
+	changed := false
+	for _, entry := range entries {
+		if !isJobFile(entry.Name()) {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		onDisk[id] = true
+		if _, ok := index[id]; ok {
+			continue
+		}
+		job, err := jm.loadJob(id)
+		if err != nil {
+			continue // Unreadable; left for gc to report
+		}
+		index[id] = job.summary()
+		changed = true
+	}
+	for id := range index {
+		if !onDisk[id] {
+			delete(index, id)
+			changed = true
+		}
+	}
+
+	jm.index = index
+	jm.indexMod = time.Time{}
+	if info != nil {
+		jm.indexMod = info.ModTime()
+	}
+	if changed {
+		return jm.writeIndex()
+	}
+	return nil
+}
+
+// indexUnchanged reports whether the index file, as found by os.Stat,
+// is still the one the cached index was read from or written to.
+func (jm *JobManager) indexUnchanged(info os.FileInfo, err error) bool {
+	if err != nil {
+		return os.IsNotExist(err) && jm.indexMod.IsZero()
+	}
+	return info.ModTime().Equal(jm.indexMod)
+}
+
+// writeIndex saves the index atomically. The caller holds jm.indexMu and
+// the index lock.
+func (jm *JobManager) writeIndex() error {
+	entries := make([]JobSummary, 0, len(jm.index))
+	for _, sum := range jm.index {
+		entries = append(entries, sum)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(jm.JobsDir, indexFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		jm.indexMod = info.ModTime()
+	}
+	return nil
+}
+
+// indexJob records sum in the index, writing it only if the entry changed.
+func (jm *JobManager) indexJob(sum JobSummary) error {
+	return jm.withIndex(func() error {
+		if old, ok := jm.index[sum.ID]; ok && old == sum {
+			return nil
+		}
+		jm.index[sum.ID] = sum
+		return jm.writeIndex()
+	})
+}
+
+// Summaries returns the index entries of all saved jobs, newest first.
+func (jm *JobManager) Summaries() ([]JobSummary, error) {
+	var sums []JobSummary
+	err := jm.withIndex(func() error {
+		sums = make([]JobSummary, 0, len(jm.index))
+		for _, sum := range jm.index {
+			sums = append(sums, sum)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sums, func(i, j int) bool {
+		return sums[i].CreatedAt.After(sums[j].CreatedAt)
+	})
+	return sums, nil
+}
+
+// DeleteJob removes a saved job and its index entry. Its trash is left
+// alone; see Prune.
+func (jm *JobManager) DeleteJob(id string) error {
+	return jm.withIndex(func() error {
+		err := os.Remove(jm.jobPath(id))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(jm.jobLockPath(id))
+		delete(jm.index, id)
+		return jm.writeIndex()
+	})
+}
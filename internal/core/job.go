@@ -2,10 +2,11 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -24,28 +25,100 @@ const (
 	StatusOK      JobItemStatus = "ok"
 	StatusSkipped JobItemStatus = "skipped"
 	StatusError   JobItemStatus = "error"
+	StatusPending JobItemStatus = "pending" // Saved mid-operation
+	StatusUndone  JobItemStatus = "undone"  // Reverted by Undo
 )
 
 type JobItem struct {
 	Src         string        `json:"src"`
 	Dst         string        `json:"dst,omitempty"`
-	Op          string        `json:"op"` // copy, move, delete
+	Op          string        `json:"op"` // copy, move, delete, archive
 	Status      JobItemStatus `json:"status"`
 	Error       string        `json:"error,omitempty"`
 	CreatedPath string        `json:"created_path,omitempty"` // For copy/move
 	BackupPath  string        `json:"backup_path,omitempty"`  // For overwrite
 	TrashPath   string        `json:"trash_path,omitempty"`   // For delete
+	HashAlgo    HashAlgo      `json:"hash_algo,omitempty"`    // Verify mode used
+	SrcHash     string        `json:"src_hash,omitempty"`
+	DstHash     string        `json:"dst_hash,omitempty"`
+	Phase       MovePhase     `json:"phase,omitempty"`      // Last phase a move reached
+	TempPath    string        `json:"temp_path,omitempty"`  // Staging copy of a cross-device move
+	Comparison  Comparison    `json:"comparison,omitempty"` // Decision of a content-aware policy
+
+	// What the job left at CreatedPath (TrashPath for deletes), so undo
+	// can tell whether it was modified since
+	Fingerprint *Fingerprint `json:"fingerprint,omitempty"`
+
+	// Entries below Src put under sanitized names: original -> new
+	// relative path. Undo of a move renames them back.
+	Renamed map[string]string `json:"renamed,omitempty"`
+}
+
+// Succeeded returns the sources of all items of the given op that
+// finished successfully.
+func (job *Job) Succeeded(op string) map[string]struct{} {
+	srcs := make(map[string]struct{})
+	for _, item := range job.Items {
+		if item.Op == op && item.Status == StatusOK {
+			srcs[item.Src] = struct{}{}
+		}
+	}
+	return srcs
+}
+
+// SetChecksum records the digests of a verified transfer.
+func (ji *JobItem) SetChecksum(sum *Checksum) {
+	if sum == nil {
+		return
+	}
+	ji.HashAlgo = sum.Algo
+	ji.SrcHash = sum.Src
+	ji.DstHash = sum.Dst
 }
 
 type Job struct {
-	ID        string    `json:"id"`
-	Type      JobType   `json:"type"`
-	CreatedAt time.Time `json:"created_at"`
-	Items     []JobItem `json:"items"`
+	ID         string    `json:"id"`
+	Type       JobType   `json:"type"`
+	CreatedAt  time.Time `json:"created_at"`
+	Items      []JobItem `json:"items"`
+	State      JobState  `json:"state,omitempty"`
+	TargetDir  string    `json:"target_dir,omitempty"`  // For put jobs
+	TotalBytes int64     `json:"total_bytes,omitempty"` // Bytes the plan expected to write
+
+	mu      sync.Mutex  // Guards Items and State while workers run
+	saveMu  sync.Mutex  // Serializes SaveJob
+	plan    *Plan       // Plan the job executes
+	opts    PutOptions  // Options it runs with
+	pending []int       // Indexes of the items that run
+	ctl     *jobControl // Pause/cancel of a queued job
+	started bool
+	saveErr error // Last SaveJob failure of a queued job
+}
+
+// updateItem applies fn to job.Items[idx] under the job lock.
+func (job *Job) updateItem(idx int, fn func(item *JobItem)) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	fn(&job.Items[idx])
 }
 
 type JobManager struct {
 	JobsDir string
+
+	// MaxRunning is how many queued jobs run at the same time, < 1 means 1.
+	MaxRunning int
+	// OnChange, if set, is called from any goroutine when a queued job
+	// changes state or finishes an item.
+	OnChange func(job *Job)
+
+	mu      sync.Mutex
+	queue   []*Job // Jobs enqueued this session, in run order
+	running int
+	wg      sync.WaitGroup
+
+	indexMu  sync.Mutex
+	index    map[string]JobSummary // Loaded on first use, see loadIndex
+	indexMod time.Time             // Modification time of the file index was read from
 }
 
 func NewJobManager() (*JobManager, error) {
@@ -69,96 +142,172 @@ func (jm *JobManager) CreateJob(jType JobType) *Job {
 	}
 }
 
+// SaveJob writes job to its file and updates the index. Saves of the same
+// job are serialized and the file is replaced by a rename, so concurrent
+// workers never leave a stale or torn record behind.
 func (jm *JobManager) SaveJob(job *Job) error {
-	path := filepath.Join(jm.JobsDir, job.ID+".json")
+	job.saveMu.Lock()
+	defer job.saveMu.Unlock()
+
+	job.mu.Lock()
 	data, err := json.MarshalIndent(job, "", "  ")
+	sum := job.summary()
+	job.mu.Unlock()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	path := jm.jobPath(job.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return jm.indexJob(sum)
 }
 
+// GetRecentJobs returns the n newest saved jobs. Only their files are read;
+// the index picks them.
 func (jm *JobManager) GetRecentJobs(n int) ([]*Job, error) {
-	entries, err := os.ReadDir(jm.JobsDir)
+	sums, err := jm.Summaries()
 	if err != nil {
 		return nil, err
 	}
 
 	var jobs []*Job
-	for _, entry := range entries {
-		if filepath.Ext(entry.Name()) == ".json" {
-			data, err := os.ReadFile(filepath.Join(jm.JobsDir, entry.Name()))
-			if err != nil {
-				continue
-			}
-			var job Job
-			if err := json.Unmarshal(data, &job); err == nil {
-				jobs = append(jobs, &job)
-			}
+	for _, sum := range sums {
+		if len(jobs) >= n {
+			break
+		}
+		if job, err := jm.loadJob(sum.ID); err == nil {
+			jobs = append(jobs, job)
 		}
 	}
+	return jobs, nil
+}
+
+// SetMoveResult records the phase a move reached and its checksum.
+func (ji *JobItem) SetMoveResult(res *MoveResult) {
+	if res == nil {
+		return
+	}
+	ji.Phase = res.Phase
+	ji.TempPath = res.TempPath
+	ji.SetChecksum(res.Checksum)
+}
 
-	// Sort by CreatedAt desc
-	sort.Slice(jobs, func(i, j int) bool {
-		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
-	})
+// TrackMove returns a PhaseFunc that checkpoints job.Items[idx] to disk
+// on every phase change, so a crash mid-move leaves a recoverable record.
+func (jm *JobManager) TrackMove(job *Job, idx int) PhaseFunc {
+	return func(phase MovePhase, tempPath string) {
+		job.updateItem(idx, func(item *JobItem) {
+			item.Phase = phase
+			item.TempPath = tempPath
+		})
+		if phase != PhaseRenamed {
+			_ = jm.SaveJob(job) // Best effort; the final SaveJob reports errors
+		}
+	}
+}
 
-	if len(jobs) > n {
-		jobs = jobs[:n]
+// needsSettling reports whether a move stopped in a phase that left
+// something on disk (a staged copy, or a placed dst with src not removed).
+func (ji *JobItem) needsSettling() bool {
+	switch ji.Phase {
+	case PhaseCopying, PhaseCopied, PhasePlaced:
+		return true
 	}
-	return jobs, nil
+	return false
 }
 
-// Undo reverses the operations in the job.
-func (jm *JobManager) Undo(job *Job) error {
-	// Reverse items to undo in reverse order
-	for i := len(job.Items) - 1; i >= 0; i-- {
-		item := job.Items[i]
-		if item.Status != StatusOK {
+// Recover settles every interrupted move in the job (see RecoverMove),
+// marks a job cut short while queued or running as failed and saves the
+// updated job. It returns the number of items (and jobs) it settled.
+func (jm *JobManager) Recover(job *Job) (int, error) {
+	settled := 0
+	var firstErr error
+	for i := range job.Items {
+		item := &job.Items[i]
+		if !item.needsSettling() {
 			continue
 		}
-
-		var err error
-		switch item.Op {
-		case "copy":
-			// Delete created file/dir
-			if item.CreatedPath != "" {
-				err = os.RemoveAll(item.CreatedPath)
-			}
-		case "move":
-			// Move back from dst check (CreatedPath) to src
-			if item.CreatedPath != "" {
-				// Try move back
-				// If src exists (unexpected?), we might need conflict resolution logic even for undo?
-				// For MVP, simplistic fallback:
-				err = Move(item.CreatedPath, item.Src)
-			}
-		case "delete":
-			// Move from trash back to src
-			if item.TrashPath != "" {
-				err = Move(item.TrashPath, item.Src)
+		dst := item.CreatedPath
+		if item.Op == "delete" {
+			dst = item.TrashPath
+		}
+		phase, err := RecoverMove(item.Src, dst, item.Phase, item.TempPath)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
 			}
+			continue
 		}
-		
-		// Overwrite undo
-		if item.BackupPath != "" {
-			// Restore backup to dst (overwrite current dst)
-			// Move backup -> dst
-			// We might need to delete current dst first if it's there
-			if item.Dst != "" {
-				_ = os.RemoveAll(item.Dst) // Remove the "new" file
-				err = Move(item.BackupPath, item.Dst)
+		item.Phase = phase
+		item.TempPath = ""
+		if phase == PhaseDone {
+			item.Status = StatusOK
+			item.Error = ""
+		} else if item.Status == StatusPending {
+			item.Status = StatusError
+			item.Error = "interrupted; rolled back"
+		}
+		settled++
+	}
+
+	// A job saved while queued or running was cut short by a crash
+	if !job.State.Done() {
+		for i := range job.Items {
+			if item := &job.Items[i]; item.Status == StatusPending && !item.needsSettling() {
+				item.Status = StatusError
+				item.Error = "interrupted; not run"
 			}
 		}
+		job.State = JobFailed
+		settled++
+	}
+	if settled > 0 {
+		if err := jm.SaveJob(job); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return settled, firstErr
+}
 
+// errJobLocked is returned by lockJob for a job another instance is
+// running.
+var errJobLocked = errors.New("job is running in another instance")
+
+// RecoverAll runs Recover on every saved job the index marks unsettled.
+// Jobs another lazycd instance is still running hold their lock and are
+// left alone.
+func (jm *JobManager) RecoverAll() (int, error) {
+	sums, err := jm.Summaries()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	var firstErr error
+	for _, sum := range sums {
+		if !sum.Unsettled {
+			continue
+		}
+		lock, err := jm.lockJob(sum.ID)
+		if err != nil {
+			continue // Running elsewhere, or gone
+		}
+		job, err := jm.loadJob(sum.ID)
 		if err != nil {
-			// Log error but continue?
-			fmt.Printf("Undo error for %s: %v\n", item.Src, err)
+			lock.Close()
+			continue
+		}
+		n, err := jm.Recover(job)
+		lock.Close()
+		total += n
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("recover job %s: %w", job.ID, err)
 		}
 	}
-	
-	// Remove job file after undo? Or mark as undone?
-	// For now, let's remove it to prevent double undo
-	path := filepath.Join(jm.JobsDir, job.ID+".json")
-	return os.Remove(path)
+	return total, firstErr
 }
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSaveJobConcurrent(t *testing.T) {
+	jm := newJobManager(t)
+	job := jm.CreateJob(JobPut)
+	for i := 0; i < 8; i++ {
+		job.Items = append(job.Items, JobItem{Src: fmt.Sprintf("/src/%d", i), Op: "move", Status: StatusPending})
+	}
+
+	var wg sync.WaitGroup
+	for i := range job.Items {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			track := jm.TrackMove(job, idx)
+			for _, phase := range []MovePhase{PhaseCopying, PhaseCopied, PhasePlaced, PhaseDone} {
+				track(phase, "")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	saved, err := jm.loadJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range saved.Items {
+		if item.Phase != PhaseDone {
+			t.Errorf("item %d: phase %q, want %q", i, item.Phase, PhaseDone)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockJob takes the lock of the saved job id, held by the instance running
+// it so that another instance does not recover the job midway (see
+// RecoverAll). It fails with errJobLocked while another holder has it.
+// Closing the returned file releases the lock.
+func (jm *JobManager) lockJob(id string) (*os.File, error) {
+	if _, err := os.Stat(jm.jobPath(id)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(jm.jobLockPath(id), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, errJobLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// lockIndex takes the lock serializing index updates between instances,
+// waiting while another holder has it. Closing the returned file releases
+// the lock.
+func (jm *JobManager) lockIndex() (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(jm.JobsDir, indexLockFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
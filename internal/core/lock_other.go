@@ -0,0 +1,23 @@
+//go:build !unix
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockJob opens the lock file of the saved job id. Without flock there is
+// no lock, so another instance may recover a job that is still running.
+func (jm *JobManager) lockJob(id string) (*os.File, error) {
+	if _, err := os.Stat(jm.jobPath(id)); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(jm.jobLockPath(id), os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// lockIndex opens the index lock file. Without flock there is no lock;
+// the index is still re-read when another instance changed it.
+func (jm *JobManager) lockIndex() (*os.File, error) {
+	return os.OpenFile(filepath.Join(jm.JobsDir, indexLockFile), os.O_RDWR|os.O_CREATE, 0644)
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLockJobSurvivesSave(t *testing.T) {
+	jm := newJobManager(t)
+	job := jm.CreateJob(JobPut)
+	if err := jm.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := jm.lockJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Close()
+
+	// Saving replaces the job file, the lock stays
+	if err := jm.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jm.lockJob(job.ID); !errors.Is(err, errJobLocked) {
+		t.Errorf("second lock: got %v, want errJobLocked", err)
+	}
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lazycd/internal/fs"
+)
+
+// mountMem mounts an empty MemFS for the duration of the test and returns
+// its root. Paths below the root are read and written in memory.
+func mountMem(t *testing.T, name string) string {
+	t.Helper()
+	root := filepath.Join("/lazycd-test", t.Name(), name)
+	fs.Mount(root, fs.NewMemFS())
+	t.Cleanup(func() { fs.Unmount(root) })
+	return root
+}
+
+// newJobManager returns a job manager saving into a temporary directory.
+// HOME is redirected too, so trash and backups stay inside the test.
+func newJobManager(t *testing.T) *JobManager {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	return &JobManager{JobsDir: t.TempDir()}
+}
+
+// writeTree creates files below root. A name ending in "/" is a
+// directory, any other name a file with the given contents.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if strings.HasSuffix(name, "/") {
+			if err := fs.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		writeFile(t, path, data)
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := fs.Create(path, 0644, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTree returns what is below root in the form writeTree takes.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := fs.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			files[rel+"/"] = ""
+			return nil
+		}
+		files[rel] = readFile(t, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	r, err := fs.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// assertTree fails the test unless root holds exactly want.
+func assertTree(t *testing.T, root string, want map[string]string) {
+	t.Helper()
+	got := readTree(t, root)
+	for name, data := range want {
+		if g, ok := got[name]; !ok {
+			t.Errorf("%s: missing", name)
+		} else if g != data {
+			t.Errorf("%s: got %q, want %q", name, g, data)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s: unexpected", name)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := fs.Lstat(path)
+	return err == nil
+}
+
+// setModTime dates path back by age.
+func setModTime(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	mtime := time.Now().Add(-age)
+	if err := fs.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"lazycd/internal/fs"
+)
+
+// MovePhase records how far a move got, so an interrupted or failed move
+// can be undone or recovered from the job file.
+type MovePhase string
+
+const (
+	PhaseNone    MovePhase = ""
+	PhaseRenamed MovePhase = "renamed" // Same-device rename, complete
+	PhaseCopying MovePhase = "copying" // Copy into TempPath in progress
+	PhaseCopied  MovePhase = "copied"  // TempPath holds a full (verified) copy
+	PhasePlaced  MovePhase = "placed"  // TempPath renamed to dst, src still present
+	PhaseDone    MovePhase = "done"    // Source removed
+)
+
+// PhaseFunc is called every time a move enters a new phase.
+type PhaseFunc func(phase MovePhase, tempPath string)
+
+// MoveResult describes the outcome of MoveVerified.
+type MoveResult struct {
+	Phase    MovePhase
+	TempPath string
+	Checksum *Checksum
+}
+
+// placed reports whether the data has reached dst.
+func (res *MoveResult) placed() bool {
+	switch res.Phase {
+	case PhaseRenamed, PhasePlaced, PhaseDone:
+		return true
+	}
+	return false
+}
+
+// Move tries to rename, falls back to copy+delete.
+func Move(src, dst string) error {
+	_, err := MoveVerified(src, dst, HashNone, nil)
+	return err
+}
+
+// MoveVerified tries an atomic rename first. Across devices or
+// filesystems (see fs.Rename) it copies src
+// into a hidden temporary sibling of dst, verifies it with algo (unless
+// HashNone), renames it into place and only then removes src.
+//
+// A failed or mismatched copy removes the temporary copy and leaves src
+// untouched. onPhase, if not nil, is told about each phase as it starts.
+func MoveVerified(src, dst string, algo HashAlgo, onPhase PhaseFunc) (*MoveResult, error) {
+	return moveVerified(src, dst, algo, nil, onPhase)
+}
+
+// moveVerified is MoveVerified with the given per-transfer settings.
+func moveVerified(src, dst string, algo HashAlgo, co *copyOpts, onPhase PhaseFunc) (*MoveResult, error) {
+	res := &MoveResult{}
+	enter := func(phase MovePhase) {
+		res.Phase = phase
+		if onPhase != nil {
+			onPhase(phase, res.TempPath)
+		}
+	}
+
+	// Try atomic rename
+	err := renameInto(src, dst)
+	if err == nil {
+		enter(PhaseRenamed)
+		return res, renameTree(dst, co.renamed(), true)
+	}
+
+	// Fallback to staged Copy + Delete
+	if _, err := fs.Lstat(src); err != nil {
+		return res, err
+	}
+
+	res.TempPath = TempSibling(dst)
+	enter(PhaseCopying)
+
+	sum, err := copyVerified(src, res.TempPath, algo, co)
+	res.Checksum = sum
+	if err != nil {
+		if rmErr := removeTemp(res.TempPath); rmErr != nil {
+			return res, fmt.Errorf("%v (cleanup of %s failed: %v)", err, res.TempPath, rmErr)
+		}
+		res.TempPath = ""
+		enter(PhaseNone)
+		return res, err
+	}
+	enter(PhaseCopied)
+
+	if err := renameInto(res.TempPath, dst); err != nil {
+		return res, err
+	}
+	res.TempPath = ""
+	enter(PhasePlaced)
+
+	if err := fs.RemoveAll(src); err != nil {
+		return res, err
+	}
+	enter(PhaseDone)
+	return res, nil
+}
+
+// renameInto renames src to dst, replacing dst if it is an empty
+// directory such as the placeholder taken by ClaimPath; fs.Rename refuses
+// to replace directories.
+func renameInto(src, dst string) error {
+	err := fs.Rename(src, dst)
+	if err == nil || !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if info, statErr := fs.Lstat(dst); statErr != nil || !info.IsDir() {
+		return err
+	}
+	if fs.Remove(dst) != nil {
+		return err // Not empty
+	}
+	return fs.Rename(src, dst)
+}
+
+// removeTemp removes the temporary copy of a move, including the partial
+// file a large file is copied through (see copyFileResumable): a move
+// stages into a fresh name each time, so it is never resumed.
+func removeTemp(tempPath string) error {
+	if err := fs.RemoveAll(tempPath); err != nil {
+		return err
+	}
+	if fs.IsLocal(tempPath) {
+		return removePartial(tempPath)
+	}
+	return nil
+}
+
+// TempSibling returns a hidden, unique path next to dst used to stage copies.
+func TempSibling(dst string) string {
+	name := fmt.Sprintf(".%s.lazycd-tmp-%s", filepath.Base(dst), uuid.New().String()[:8])
+	return filepath.Join(filepath.Dir(dst), name)
+}
+
+// isTempSibling reports whether name is that of a TempSibling or of a file
+// derived from one.
+func isTempSibling(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".lazycd-tmp-")
+}
+
+// RecoverMove settles a move that stopped before PhaseDone. Unfinished
+// copies are rolled back (the temporary copy is removed, src is intact);
+// moves that were already placed are rolled forward by removing src.
+func RecoverMove(src, dst string, phase MovePhase, tempPath string) (MovePhase, error) {
+	switch phase {
+	case PhaseCopying, PhaseCopied:
+		if tempPath != "" {
+			if err := removeTemp(tempPath); err != nil {
+				return phase, err
+			}
+		}
+		return PhaseNone, nil
+	case PhasePlaced:
+		if err := fs.RemoveAll(src); err != nil {
+			return phase, err
+		}
+		return PhaseDone, nil
+	default:
+		return phase, nil
+	}
+}
+
+// UndoMove moves dst back to src for a move that reached the given phase.
+func UndoMove(src, dst string, phase MovePhase, tempPath string) error {
+	switch phase {
+	case PhaseCopying, PhaseCopied:
+		// Nothing was placed; just drop the staged copy
+		if tempPath == "" {
+			return nil
+		}
+		return removeTemp(tempPath)
+	case PhasePlaced:
+		// dst is complete but src may be partially deleted: replace it
+		if err := fs.RemoveAll(src); err != nil {
+			return err
+		}
+		return Move(dst, src)
+	default:
+		return Move(dst, src)
+	}
+}
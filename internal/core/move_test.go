@@ -0,0 +1,92 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveVerifiedRename(t *testing.T) {
+	root := mountMem(t, "disk")
+	src := filepath.Join(root, "src")
+	writeTree(t, src, map[string]string{"f": "1"})
+
+	var phases []MovePhase
+	res, err := MoveVerified(src, filepath.Join(root, "dst"), HashXXH64, func(phase MovePhase, tempPath string) {
+		phases = append(phases, phase)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Phase != PhaseRenamed {
+		t.Errorf("phase: got %q, want %q", res.Phase, PhaseRenamed)
+	}
+	if len(phases) != 1 || phases[0] != PhaseRenamed {
+		t.Errorf("phases: got %v", phases)
+	}
+	if exists(src) {
+		t.Error("source still exists")
+	}
+	assertTree(t, filepath.Join(root, "dst"), map[string]string{"f": "1"})
+}
+
+func TestMoveVerifiedAcrossFilesystems(t *testing.T) {
+	a, b := mountMem(t, "a"), mountMem(t, "b")
+	src := filepath.Join(a, "src")
+	tree := map[string]string{"f": "1", "sub/": "", "sub/g": "2"}
+	writeTree(t, src, tree)
+
+	var phases []MovePhase
+	res, err := MoveVerified(src, filepath.Join(b, "dst"), HashXXH64, func(phase MovePhase, tempPath string) {
+		phases = append(phases, phase)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MovePhase{PhaseCopying, PhaseCopied, PhasePlaced, PhaseDone}
+	if len(phases) != len(want) {
+		t.Fatalf("phases: got %v, want %v", phases, want)
+	}
+	for i := range want {
+		if phases[i] != want[i] {
+			t.Fatalf("phases: got %v, want %v", phases, want)
+		}
+	}
+	if res.Checksum == nil {
+		t.Error("no checksum recorded")
+	}
+	if exists(src) {
+		t.Error("source still exists")
+	}
+	// Only dst is left, no temporary sibling
+	assertTree(t, b, map[string]string{"dst/": "", "dst/f": "1", "dst/sub/": "", "dst/sub/g": "2"})
+}
+
+func TestMoveVerifiedFailedCopy(t *testing.T) {
+	a, b := mountMem(t, "a"), mountMem(t, "b")
+	src := filepath.Join(a, "src")
+	writeFile(t, src, "data")
+	ctl := newJobControl()
+	ctl.cancel()
+
+	res, err := moveVerified(src, filepath.Join(b, "dst"), HashNone, &copyOpts{ctl: ctl}, nil)
+	if !errors.Is(err, ErrCanceled) {
+		t.Fatalf("got %v, want ErrCanceled", err)
+	}
+	if res.Phase != PhaseNone || res.TempPath != "" {
+		t.Errorf("result: got phase %q, temp %q", res.Phase, res.TempPath)
+	}
+	if got := readFile(t, src); got != "data" {
+		t.Errorf("source: got %q", got)
+	}
+	// The temporary copy is gone as well
+	assertTree(t, b, map[string]string{})
+}
+
+func TestMoveVerifiedMissingSource(t *testing.T) {
+	root := mountMem(t, "disk")
+
+	if _, err := MoveVerified(filepath.Join(root, "missing"), filepath.Join(root, "dst"), HashNone, nil); err == nil {
+		t.Fatal("moving a missing file succeeded")
+	}
+}
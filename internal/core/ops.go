@@ -4,54 +4,102 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"time"
+
+	"lazycd/internal/fs"
 )
 
 // CopyFile copies a file from src to dst, preserving attributes if possible.
 func CopyFile(src, dst string) error {
-	sourceFileStat, err := os.Lstat(src)
+	return copyFile(src, dst, nil)
+}
+
+// copyOpts carries per-transfer settings through the copy functions. A
+// nil *copyOpts copies plainly.
+type copyOpts struct {
+	names map[string]string // Sanitized names, see SanitizeTree
+	ctl   *jobControl       // Pause/cancel and byte counting of the job
+}
+
+func (co *copyOpts) renamed() map[string]string {
+	if co == nil {
+		return nil
+	}
+	return co.names
+}
+
+// writer wraps w with the global rate limit and the job's control.
+func (co *copyOpts) writer(w io.Writer) io.Writer {
+	w = throttled(w)
+	if co == nil || co.ctl == nil {
+		return w
+	}
+	return controlledWriter{w: w, ctl: co.ctl}
+}
+
+func copyFile(src, dst string, co *copyOpts) error {
+	sourceFileStat, err := fs.Lstat(src)
 	if err != nil {
 		return err
 	}
 
 	// Handle symlinks
 	if sourceFileStat.Mode()&os.ModeSymlink != 0 {
-		linkTarget, err := os.Readlink(src)
+		linkTarget, err := fs.Readlink(src)
 		if err != nil {
 			return err
 		}
-		return os.Symlink(linkTarget, dst)
+		return fs.Symlink(linkTarget, dst)
 	}
 
 	if !sourceFileStat.Mode().IsRegular() {
 		return fmt.Errorf("%s is not a regular file", src)
 	}
 
-	source, err := os.Open(src)
+	// Large files go through a resumable .lazycd-partial file; only local
+	// files can be read and written from an offset
+	if sourceFileStat.Size() >= ResumeThreshold && fs.IsLocal(src) && fs.IsLocal(dst) {
+		return copyFileResumable(src, dst, sourceFileStat, co)
+	}
+
+	source, err := fs.Open(src)
 	if err != nil {
 		return err
 	}
 	defer source.Close()
 
 	// Create destination
-	destination, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, sourceFileStat.Mode())
+	destination, err := fs.Create(dst, sourceFileStat.Mode(), false)
 	if err != nil {
 		return err
 	}
-	defer destination.Close()
 
-	if _, err := io.Copy(destination, source); err != nil {
+	if _, err := io.Copy(co.writer(destination), source); err != nil {
+		fs.Abort(destination)
+		return err
+	}
+	// Remote files are only complete once closed
+	if err := destination.Close(); err != nil {
 		return err
 	}
 
 	// Preserve timestamps
-	return os.Chtimes(dst, time.Now(), sourceFileStat.ModTime())
+	return fs.Chtimes(dst, time.Now(), sourceFileStat.ModTime())
 }
 
 // CopyDir recursively copies a directory tree.
 func CopyDir(src, dst string) error {
-	srcStat, err := os.Stat(src)
+	return copyDir(src, dst, "", nil)
+}
+
+// copyDir copies the directory src, found at the relative path rel of the
+// tree being copied, to dst. Entries renamed in co (see SanitizeTree) are
+// given their sanitized names.
+func copyDir(src, dst, rel string, co *copyOpts) error {
+	srcStat, err := fs.Stat(src)
 	if err != nil {
 		return err
 	}
@@ -61,25 +109,26 @@ func CopyDir(src, dst string) error {
 	}
 
 	// Create destination directory
-	if err := os.MkdirAll(dst, srcStat.Mode()); err != nil {
+	if err := fs.MkdirAll(dst, srcStat.Mode()); err != nil {
 		return err
 	}
 
-	entries, err := os.ReadDir(src)
+	entries, err := fs.ReadDir(src)
 	if err != nil {
 		return err
 	}
 
 	for _, entry := range entries {
+		childRel := path.Join(rel, entry.Name())
 		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+		dstPath := filepath.Join(dst, mapName(co.renamed(), childRel))
 
 		if entry.IsDir() {
-			if err := CopyDir(srcPath, dstPath); err != nil {
+			if err := copyDir(srcPath, dstPath, childRel, co); err != nil {
 				return err
 			}
 		} else {
-			if err := CopyFile(srcPath, dstPath); err != nil {
+			if err := copyFile(srcPath, dstPath, co); err != nil {
 				return err
 			}
 		}
@@ -87,63 +136,103 @@ func CopyDir(src, dst string) error {
 	return nil
 }
 
-// Move tries to rename, falls back to copy+delete.
-func Move(src, dst string) error {
-	// Try atomic rename
-	err := os.Rename(src, dst)
-	if err == nil {
-		return nil
-	}
-	
-	// Fallback to Copy + Delete
-	// Check if source is dir
-	info, err := os.Stat(src)
+// Copy copies a file, symlink or directory tree from src to dst.
+func Copy(src, dst string) error {
+	return copyWith(src, dst, nil)
+}
+
+// copyWith is Copy with the given per-transfer settings.
+func copyWith(src, dst string, co *copyOpts) error {
+	info, err := fs.Lstat(src)
 	if err != nil {
 		return err
 	}
-	
 	if info.IsDir() {
-		if err := CopyDir(src, dst); err != nil {
-			return err // If copy fails, do not delete
-		}
-	} else {
-		if err := CopyFile(src, dst); err != nil {
-			return err
-		}
+		return copyDir(src, dst, "", co)
 	}
-	
-	// Delete source
-	return os.RemoveAll(src)
+	return copyFile(src, dst, co)
+}
+
+// CopyVerified copies src to dst and, unless algo is HashNone, hashes both
+// afterwards. On mismatch the returned error wraps ErrChecksumMismatch.
+func CopyVerified(src, dst string, algo HashAlgo) (*Checksum, error) {
+	return copyVerified(src, dst, algo, nil)
+}
+
+func copyVerified(src, dst string, algo HashAlgo, co *copyOpts) (*Checksum, error) {
+	if err := copyWith(src, dst, co); err != nil {
+		return nil, err
+	}
+	if algo == HashNone {
+		return nil, nil
+	}
+	return verifyCopy(src, dst, algo, co.renamed())
 }
 
-// GetTrashPath determines where to move deleted items: ~/.config/lazycd/trash/<jobID>/<filename>
-func GetTrashPath(jobID, originalPath string) (string, error) {
+// TrashDir returns the directory holding a job's deleted items and
+// backups: ~/.config/lazycd/trash/<jobID>. An empty jobID gives the trash root.
+func TrashDir(jobID string) (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	
-	base := filepath.Base(originalPath)
-	return filepath.Join(home, ".config", "lazycd", "trash", jobID, base), nil
+	return filepath.Join(home, ".config", "lazycd", "trash", jobID), nil
 }
 
-// DeleteToTrash moves the item to the trash location for the given job.
-func DeleteToTrash(src, jobID string) (string, error) {
-	trashPath, err := GetTrashPath(jobID, src)
+// GetTrashPath determines where to move the item at index of a job:
+// ~/.config/lazycd/trash/<jobID>/<index>/<filename>. The index keeps items
+// with the same name apart. Jobs saved before it was added recorded
+// <jobID>/<filename>; undo reads TrashPath, so those still restore.
+func GetTrashPath(jobID string, index int, originalPath string) (string, error) {
+	dir, err := TrashDir(jobID)
 	if err != nil {
 		return "", err
 	}
+	return filepath.Join(dir, strconv.Itoa(index), filepath.Base(originalPath)), nil
+}
+
+// DeleteToTrash moves the item at index of the given job to its trash
+// location. The trash path and move result are returned even on failure
+// so the job can record how far the move got.
+func DeleteToTrash(src, jobID string, index int, onPhase PhaseFunc) (string, *MoveResult, error) {
+	trashPath, err := GetTrashPath(jobID, index, src)
+	if err != nil {
+		return "", nil, err
+	}
 	
 	// Ensure trash dir exists
 	trashDir := filepath.Dir(trashPath)
-	if err := os.MkdirAll(trashDir, 0755); err != nil {
-		return "", err
+	if err := fs.MkdirAll(trashDir, 0755); err != nil {
+		return "", nil, err
 	}
 	
 	// Use Move logic
-	if err := Move(src, trashPath); err != nil {
+	res, err := MoveVerified(src, trashPath, HashNone, onPhase)
+	return trashPath, res, err
+}
+
+// GetBackupPath determines where a destination replaced by an overwrite is
+// kept: ~/.config/lazycd/trash/<jobID>/backup/<index>/<filename>
+func GetBackupPath(jobID string, index int, dst string) (string, error) {
+	dir, err := TrashDir(jobID)
+	if err != nil {
 		return "", err
 	}
-	
-	return trashPath, nil
+	return filepath.Join(dir, "backup", strconv.Itoa(index), filepath.Base(dst)), nil
+}
+
+// backupExisting moves dst out of the way before it is overwritten and
+// returns where it went.
+func backupExisting(dst, jobID string, index int) (string, error) {
+	backupPath, err := GetBackupPath(jobID, index, dst)
+	if err != nil {
+		return "", err
+	}
+	if err := fs.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return "", err
+	}
+	if err := Move(dst, backupPath); err != nil {
+		return "", err
+	}
+	return backupPath, nil
 }
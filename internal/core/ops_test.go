@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lazycd/internal/fs"
+)
+
+func TestCopyFile(t *testing.T) {
+	root := mountMem(t, "disk")
+	src := filepath.Join(root, "src.txt")
+	writeFile(t, src, "hello")
+	setModTime(t, src, time.Hour)
+
+	dst := filepath.Join(root, "dst.txt")
+	if err := copyFile(src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dst); got != "hello" {
+		t.Errorf("contents: got %q", got)
+	}
+	srcInfo, _ := fs.Lstat(src)
+	dstInfo, err := fs.Lstat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+		t.Errorf("mtime: got %v, want %v", dstInfo.ModTime(), srcInfo.ModTime())
+	}
+}
+
+func TestCopyFileSymlink(t *testing.T) {
+	root := mountMem(t, "disk")
+	link := filepath.Join(root, "link")
+	if err := fs.Symlink("target.txt", link); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(root, "copy")
+	if err := copyFile(link, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	target, err := fs.Readlink(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "target.txt" {
+		t.Errorf("target: got %q", target)
+	}
+}
+
+func TestCopyFileAcrossFilesystems(t *testing.T) {
+	src := filepath.Join(mountMem(t, "a"), "f")
+	dst := filepath.Join(mountMem(t, "b"), "f")
+	writeFile(t, src, "data")
+
+	if err := copyFile(src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dst); got != "data" {
+		t.Errorf("contents: got %q", got)
+	}
+}
+
+func TestCopyFileCanceled(t *testing.T) {
+	root := mountMem(t, "disk")
+	src := filepath.Join(root, "src")
+	writeFile(t, src, "data")
+	ctl := newJobControl()
+	ctl.cancel()
+
+	err := copyFile(src, filepath.Join(root, "dst"), &copyOpts{ctl: ctl})
+	if !errors.Is(err, ErrCanceled) {
+		t.Fatalf("got %v, want ErrCanceled", err)
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	root := mountMem(t, "disk")
+	tree := map[string]string{
+		"a.txt":       "a",
+		"empty/":      "",
+		"sub/":        "",
+		"sub/b.txt":   "b",
+		"sub/deep/":   "",
+		"sub/deep/c":  "c",
+		"sub/deep/d/": "",
+	}
+	writeTree(t, filepath.Join(root, "src"), tree)
+
+	if err := copyWith(filepath.Join(root, "src"), filepath.Join(root, "dst"), nil); err != nil {
+		t.Fatal(err)
+	}
+	assertTree(t, filepath.Join(root, "dst"), tree)
+	assertTree(t, filepath.Join(root, "src"), tree)
+}
+
+func TestCopyDirRenamed(t *testing.T) {
+	root := mountMem(t, "disk")
+	writeTree(t, filepath.Join(root, "src"), map[string]string{
+		"a:b/":    "",
+		"a:b/c?d": "x",
+	})
+
+	co := &copyOpts{names: map[string]string{"a:b": "a_b", "a:b/c?d": "a_b/c_d"}}
+	if err := copyWith(filepath.Join(root, "src"), filepath.Join(root, "dst"), co); err != nil {
+		t.Fatal(err)
+	}
+	assertTree(t, filepath.Join(root, "dst"), map[string]string{
+		"a_b/":    "",
+		"a_b/c_d": "x",
+	})
+}
+
+func TestDeleteToTrash(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := mountMem(t, "disk")
+	src := filepath.Join(root, "dir")
+	tree := map[string]string{"f": "1", "sub/": "", "sub/g": "2"}
+	writeTree(t, src, tree)
+
+	trashPath, res, err := DeleteToTrash(src, "job1", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists(src) {
+		t.Error("source still exists")
+	}
+	want, _ := GetTrashPath("job1", 0, src)
+	if trashPath != want {
+		t.Errorf("trash path: got %s, want %s", trashPath, want)
+	}
+	// The trash is on the local disk, so the move was staged
+	if res.Phase != PhaseDone {
+		t.Errorf("phase: got %q, want %q", res.Phase, PhaseDone)
+	}
+	assertTree(t, trashPath, tree)
+}
+
+func TestDeleteToTrashMissing(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := mountMem(t, "disk")
+
+	if _, _, err := DeleteToTrash(filepath.Join(root, "missing"), "job1", 0, nil); err == nil {
+		t.Fatal("deleting a missing file succeeded")
+	}
+}
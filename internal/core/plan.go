@@ -0,0 +1,431 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lazycd/internal/fs"
+)
+
+// PlanOutcome is what a planned item is going to do with its destination.
+type PlanOutcome string
+
+const (
+	OutcomeCreate    PlanOutcome = "create"    // No conflict
+	OutcomeSkip      PlanOutcome = "skip"      // Left untouched
+	OutcomeRename    PlanOutcome = "rename"    // Put under a free name
+	OutcomeOverwrite PlanOutcome = "overwrite" // Replace existing file
+	OutcomeTrash     PlanOutcome = "trash"     // Moved to trash (delete)
+	OutcomeMerge     PlanOutcome = "merge"     // Directory merged entry by entry
+	OutcomeResume    PlanOutcome = "resume"    // Interrupted copy continued
+	OutcomeError     PlanOutcome = "error"     // Cannot be executed
+)
+
+// PlanItem is the predicted result of a single Put or Delete item.
+type PlanItem struct {
+	Src        string      `json:"src"`
+	Target     string      `json:"target,omitempty"`   // Destination before conflict handling
+	Dst        string      `json:"dst,omitempty"`      // Resolved destination
+	Existing   string      `json:"existing,omitempty"` // Entry Target collides with (may differ in case/normalization)
+	Op         string      `json:"op"`                 // copy, move, delete
+	Conflict   bool        `json:"conflict"`
+	Comparison Comparison  `json:"comparison,omitempty"` // For content-aware policies
+	Outcome    PlanOutcome `json:"outcome"`
+	Bytes      int64       `json:"bytes"`       // Bytes that will be written
+	SameDevice bool        `json:"same_device"` // Move is a plain rename
+	Errors     []string    `json:"errors,omitempty"`
+
+	// Sanitized entries below Src: original -> new relative path
+	Renamed map[string]string `json:"renamed,omitempty"`
+}
+
+// Sanitized reports whether the item or entries below it are put under
+// sanitized names.
+func (pi *PlanItem) Sanitized() bool {
+	return len(pi.Renamed) > 0 || (pi.Target != "" && filepath.Base(pi.Target) != filepath.Base(pi.Src))
+}
+
+// Plan is a reviewable description of a Put or Delete before it runs.
+type Plan struct {
+	Type       JobType        `json:"type"`
+	TargetDir  string         `json:"target_dir,omitempty"`
+	Policy     ConflictPolicy `json:"policy,omitempty"`
+	Template   string         `json:"rename_template,omitempty"`
+	Items      []PlanItem     `json:"items"`
+	TotalBytes int64          `json:"total_bytes"`
+	Preflight  *Preflight     `json:"preflight,omitempty"`
+	FSType     string         `json:"fs_type,omitempty"`  // Filesystem of TargetDir
+	Sanitize   bool           `json:"sanitize,omitempty"` // Names are sanitized for FSType
+	Archive    *ArchiveSpec   `json:"archive,omitempty"`  // Archive written by an archive plan
+}
+
+// Runnable reports whether the item will touch the filesystem.
+func (pi *PlanItem) Runnable() bool {
+	switch pi.Outcome {
+	case OutcomeCreate, OutcomeRename, OutcomeOverwrite, OutcomeTrash, OutcomeResume:
+		return true
+	}
+	return false
+}
+
+func (pi *PlanItem) addError(format string, args ...any) {
+	pi.Errors = append(pi.Errors, fmt.Sprintf(format, args...))
+}
+
+// PlanPut predicts what ExecutePut would do with items and opts without
+// touching the filesystem.
+func PlanPut(items []PutItem, opts PutOptions) *Plan {
+	plan := &Plan{
+		Type:      JobPut,
+		TargetDir: opts.TargetDir,
+		Policy:    opts.Policy,
+		Template:  opts.RenameTemplate,
+		FSType:    FilesystemType(opts.TargetDir),
+	}
+	plan.Sanitize = opts.Sanitize.enabled(plan.FSType)
+
+	for _, item := range items {
+		plan.add(item.Src, item.Op, opts.TargetDir, opts)
+	}
+
+	plan.predict()
+	return plan
+}
+
+// add plans putting src into dir. Under a content-aware policy a
+// directory that meets an existing one is merged into it: the item gets
+// OutcomeMerge and its entries are planned one by one after it, so the
+// policy decides per file.
+func (p *Plan) add(src, op, dir string, opts PutOptions) {
+	p.Items = append(p.Items, PlanItem{Src: src, Op: op})
+	i := len(p.Items) - 1
+	pi := &p.Items[i]
+	name := filepath.Base(src)
+	if p.Sanitize {
+		name = SanitizeName(name)
+	}
+	pi.Target = filepath.Join(dir, name)
+
+	info, err := fs.Lstat(src)
+	if err != nil {
+		pi.Outcome = OutcomeError
+		pi.addError("source: %v", err)
+		return
+	}
+	if op == "move" && fs.InArchive(src) {
+		pi.Outcome = OutcomeError
+		pi.addError("archive members can only be copied")
+		return
+	}
+	pi.Conflict = p.taken(pi, i)
+	if pi.Conflict && opts.Policy.Compares() && info.IsDir() && isDir(pi.Existing) {
+		pi.Outcome = OutcomeMerge
+		p.merge(src, op, pi.Existing, opts)
+		return
+	}
+	if p.Sanitize {
+		renamed, err := SanitizeTree(src)
+		if err != nil {
+			pi.Outcome = OutcomeError
+			pi.addError("sanitize: %v", err)
+			return
+		}
+		pi.Renamed = renamed
+	}
+	outcome := outcomeFor(opts.Policy, pi.Conflict)
+	if pi.Conflict && opts.Policy.Compares() {
+		outcome = compareOutcome(pi, opts)
+	}
+	p.resolve(i, outcome)
+}
+
+// merge plans the entries of the directory src into the existing
+// directory dir.
+func (p *Plan) merge(src, op, dir string, opts PutOptions) {
+	entries, err := fs.ReadDir(src)
+	if err != nil {
+		pi := &p.Items[len(p.Items)-1]
+		pi.Outcome = OutcomeError
+		pi.addError("source: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		p.add(filepath.Join(src, entry.Name()), op, dir, opts)
+	}
+}
+
+// isDir reports whether path is a directory, not following symlinks.
+func isDir(path string) bool {
+	info, err := fs.Lstat(path)
+	return err == nil && info.IsDir()
+}
+
+// PlanDelete predicts moving paths to the trash of a delete job.
+func PlanDelete(paths []string) *Plan {
+	plan := &Plan{
+		Type:  JobDelete,
+		Items: make([]PlanItem, len(paths)),
+	}
+
+	trashDir, _ := TrashDir("")
+	for i, path := range paths {
+		pi := &plan.Items[i]
+		pi.Src = path
+		pi.Op = "delete"
+		pi.Outcome = OutcomeTrash
+
+		if _, err := fs.Lstat(path); err != nil {
+			pi.Outcome = OutcomeError
+			pi.addError("source: %v", err)
+			continue
+		}
+		if fs.InArchive(path) {
+			pi.Outcome = OutcomeError
+			pi.addError("archive members cannot be deleted")
+			continue
+		}
+		if !canWrite(filepath.Dir(path)) {
+			pi.addError("no permission to remove from %s", filepath.Dir(path))
+		}
+		pi.SameDevice = sameDevice(path, existingAncestor(trashDir))
+		if !pi.SameDevice {
+			pi.Bytes, _ = PathSize(path)
+		}
+		plan.TotalBytes += pi.Bytes
+	}
+
+	plan.preflight()
+	return plan
+}
+
+// outcomeFor maps a conflict policy to the initial outcome of an item.
+func outcomeFor(policy ConflictPolicy, conflict bool) PlanOutcome {
+	if !conflict {
+		return OutcomeCreate
+	}
+	switch policy {
+	case PolicyRename:
+		return OutcomeRename
+	case PolicyOverwrite:
+		return OutcomeOverwrite
+	default:
+		return OutcomeSkip
+	}
+}
+
+// compareOutcome decides a conflicting item under a content-aware policy
+// and records the comparison on it.
+func compareOutcome(pi *PlanItem, opts PutOptions) PlanOutcome {
+	if pi.Existing == "" {
+		return OutcomeSkip // Claimed by an earlier item, nothing to compare with
+	}
+	overwrite, cmp, err := Compare(pi.Src, pi.Existing, opts.Policy, opts.Verify)
+	if err != nil {
+		pi.addError("compare: %v", err)
+		return OutcomeError
+	}
+	pi.Comparison = cmp
+	if overwrite {
+		return OutcomeOverwrite
+	}
+	return OutcomeSkip
+}
+
+// taken reports whether the target of pi exists on disk (recording the
+// colliding entry in pi.Existing) or is claimed by an earlier runnable
+// item of the plan than idx. Names are compared with FindExisting rules.
+func (p *Plan) taken(pi *PlanItem, idx int) bool {
+	existing, err := FindExisting(pi.Target)
+	if err != nil {
+		return true
+	}
+	pi.Existing = existing
+	if existing != "" {
+		return true
+	}
+	for i := 0; i < idx; i++ {
+		if p.Items[i].Runnable() && samePathName(p.Items[i].Dst, pi.Target) {
+			return true
+		}
+	}
+	return false
+}
+
+// reserved returns the destinations claimed by runnable items except idx.
+func (p *Plan) reserved(idx int) map[string]struct{} {
+	reserved := make(map[string]struct{})
+	for i := range p.Items {
+		if i != idx && p.Items[i].Runnable() {
+			reserved[p.Items[i].Dst] = struct{}{}
+		}
+	}
+	return reserved
+}
+
+// resolve sets the outcome of item idx and computes its destination.
+func (p *Plan) resolve(idx int, outcome PlanOutcome) {
+	pi := &p.Items[idx]
+	pi.Outcome = outcome
+	pi.Dst = ""
+
+	switch outcome {
+	case OutcomeCreate:
+		pi.Dst = pi.Target
+	case OutcomeRename:
+		dst, err := findFreeName(pi.Target, p.reserved(idx), p.Template)
+		if err != nil {
+			pi.Outcome = OutcomeError
+			pi.addError("%v", err)
+			return
+		}
+		pi.Dst = dst
+	case OutcomeOverwrite:
+		existing := pi.Target
+		if pi.Existing != "" {
+			existing = pi.Existing
+		}
+		if info, err := fs.Stat(existing); err == nil && info.IsDir() {
+			pi.Outcome = OutcomeError
+			pi.addError("cannot overwrite directory '%s'", existing)
+			return
+		}
+		for claimed := range p.reserved(idx) {
+			if samePathName(claimed, pi.Target) {
+				pi.Outcome = OutcomeError
+				pi.addError("'%s' is already a destination of this put", pi.Target)
+				return
+			}
+		}
+		pi.Dst = pi.Target
+	}
+}
+
+// Cycle switches item idx to its next possible outcome: a conflicting
+// item goes skip -> rename -> overwrite, anything else toggles skip.
+func (p *Plan) Cycle(idx int) {
+	if idx < 0 || idx >= len(p.Items) {
+		return
+	}
+	pi := &p.Items[idx]
+	if _, err := fs.Lstat(pi.Src); err != nil {
+		return // Source errors cannot be fixed here
+	}
+	if pi.Outcome == OutcomeMerge {
+		return // Decided by the items of its entries
+	}
+
+	if p.Type == JobDelete {
+		if pi.Outcome == OutcomeSkip {
+			pi.Outcome = OutcomeTrash
+		} else {
+			pi.Outcome = OutcomeSkip
+		}
+		p.preflight()
+		return
+	}
+	if p.Type == JobArchive {
+		if pi.Outcome == OutcomeSkip {
+			pi.Outcome = OutcomeCreate
+		} else if pi.Outcome == OutcomeCreate {
+			pi.Outcome = OutcomeSkip
+		}
+		p.predictArchive()
+		return
+	}
+
+	next := OutcomeSkip
+	switch {
+	case !pi.Conflict && pi.Outcome == OutcomeSkip:
+		next = OutcomeCreate
+	case pi.Conflict && pi.Outcome == OutcomeSkip:
+		next = OutcomeRename
+	case pi.Conflict && pi.Outcome == OutcomeRename:
+		next = OutcomeOverwrite
+	}
+
+	pi.Errors = nil
+	p.resolve(idx, next)
+	p.predict()
+}
+
+// predict fills in bytes, same-device flags and predicted errors for all
+// runnable items of a put plan.
+func (p *Plan) predict() {
+	p.TotalBytes = 0
+	targetOK := canWrite(p.TargetDir)
+	free, freeErr := freeSpace(p.TargetDir)
+	var needed uint64
+
+	for i := range p.Items {
+		pi := &p.Items[i]
+		if !pi.Runnable() {
+			pi.Bytes = 0
+			continue
+		}
+		pi.Errors = nil
+
+		pi.SameDevice = pi.Op == "move" && sameDevice(pi.Src, p.TargetDir)
+		pi.Bytes = 0
+		if !pi.SameDevice {
+			pi.Bytes, _ = PathSize(pi.Src)
+		}
+		p.TotalBytes += pi.Bytes
+
+		if !targetOK {
+			pi.addError("no permission to write to %s", p.TargetDir)
+		}
+		if !canRead(pi.Src) {
+			pi.addError("no permission to read %s", pi.Src)
+		}
+		if pi.Op == "move" && !canWrite(filepath.Dir(pi.Src)) {
+			pi.addError("no permission to remove from %s", filepath.Dir(pi.Src))
+		}
+		if !p.Sanitize && Restrictive(p.FSType) {
+			if bad := invalidNames(pi.Src, 3); len(bad) > 0 {
+				pi.addError("names not valid on %s: %s (enable sanitization)", p.FSType, strings.Join(bad, ", "))
+			}
+		}
+
+		needed += uint64(pi.Bytes)
+		if freeErr == nil && needed > free {
+			pi.addError("not enough free space (%d bytes needed, %d available)", needed, free)
+		}
+	}
+
+	p.preflight()
+}
+
+// PathSize returns the total size of the regular files at or below path.
+func PathSize(path string) (int64, error) {
+	var total int64
+	err := fs.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// existingAncestor returns path or the closest parent of it that exists.
+func existingAncestor(path string) string {
+	for {
+		if _, err := fs.Lstat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
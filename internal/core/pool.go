@@ -0,0 +1,100 @@
+package core
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runPool calls fn(i) for every i in [0, n) using at most parallelism
+// concurrent workers. It returns once all calls have finished.
+func runPool(parallelism, n int, fn func(i int)) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	parallelism = min(parallelism, n)
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// rateLimiter spaces out writes so that, across all goroutines, no more
+// than rate bytes per second are copied.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+var limiter atomic.Pointer[rateLimiter]
+
+// SetRateLimit caps the combined copy throughput of all transfers in
+// bytes per second. Zero or less disables throttling.
+func SetRateLimit(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		limiter.Store(nil)
+		return
+	}
+	limiter.Store(&rateLimiter{rate: bytesPerSec})
+}
+
+// throttleChunk is the largest write issued between limiter waits.
+const throttleChunk = 64 << 10
+
+type throttledWriter struct {
+	w io.Writer
+	l *rateLimiter
+}
+
+func (tw throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), throttleChunk)]
+		tw.l.wait(len(chunk))
+		n, err := tw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// throttled wraps w with the global rate limit, if one is set.
+func throttled(w io.Writer) io.Writer {
+	if l := limiter.Load(); l != nil {
+		return throttledWriter{w: w, l: l}
+	}
+	return w
+}
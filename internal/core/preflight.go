@@ -0,0 +1,157 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"lazycd/internal/fs"
+)
+
+// ErrPreflightBlocked is returned by ExecutePlan when the plan's preflight
+// found a problem that would make the operation fail part-way.
+var ErrPreflightBlocked = errors.New("preflight check failed")
+
+type Severity string
+
+const (
+	SeverityWarn  Severity = "warn"  // Operation may partly fail
+	SeverityBlock Severity = "block" // Operation must not start
+)
+
+// PreflightIssue is one problem found before executing a plan.
+type PreflightIssue struct {
+	Severity Severity `json:"severity"`
+	Path     string   `json:"path,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// Preflight summarizes whether a plan can run on the destination
+// filesystem: how many bytes it needs, how many are free, and what would
+// go wrong.
+type Preflight struct {
+	DestDir string           `json:"dest_dir"`
+	Needed  int64            `json:"needed"`
+	Free    int64            `json:"free"` // -1 if unknown
+	Issues  []PreflightIssue `json:"issues,omitempty"`
+}
+
+// freeSpaceMargin is the share of free space a plan may use before a
+// warning is raised; filesystem overhead makes the last bytes unreliable.
+const freeSpaceMargin = 0.9
+
+func (pf *Preflight) add(sev Severity, path, format string, args ...any) {
+	pf.Issues = append(pf.Issues, PreflightIssue{Severity: sev, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Blocked reports whether any issue must stop the plan from running.
+func (pf *Preflight) Blocked() bool {
+	if pf == nil {
+		return false
+	}
+	for _, issue := range pf.Issues {
+		if issue.Severity == SeverityBlock {
+			return true
+		}
+	}
+	return false
+}
+
+// Report renders the preflight as human readable lines.
+func (pf *Preflight) Report() []string {
+	if pf == nil {
+		return nil
+	}
+	free := "unknown"
+	if pf.Free >= 0 {
+		free = fmt.Sprintf("%d bytes", pf.Free)
+	}
+	lines := []string{fmt.Sprintf("Preflight %s: %d bytes needed, %s free", pf.DestDir, pf.Needed, free)}
+	for _, issue := range pf.Issues {
+		line := fmt.Sprintf("  [%s] %s", issue.Severity, issue.Message)
+		if issue.Path != "" {
+			line += " (" + issue.Path + ")"
+		}
+		lines = append(lines, line)
+	}
+	if len(pf.Issues) == 0 {
+		lines = append(lines, "  OK")
+	}
+	return lines
+}
+
+// err returns an error wrapping ErrPreflightBlocked that lists all
+// blocking issues.
+func (pf *Preflight) err() error {
+	var msgs []string
+	for _, issue := range pf.Issues {
+		if issue.Severity == SeverityBlock {
+			msgs = append(msgs, issue.Message)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrPreflightBlocked, strings.Join(msgs, "; "))
+}
+
+// preflight checks the destination of the plan before anything is
+// written. Same-device moves need no space; everything else needs its
+// full recursive size on the destination filesystem.
+func (p *Plan) preflight() {
+	dest := p.TargetDir
+	if p.Type == JobDelete {
+		trashDir, _ := TrashDir("")
+		dest = existingAncestor(trashDir)
+	}
+
+	pf := &Preflight{DestDir: dest, Free: -1}
+	p.Preflight = pf
+
+	if info, err := fs.Stat(dest); err != nil {
+		pf.add(SeverityBlock, dest, "destination is not accessible: %v", err)
+		return
+	} else if !info.IsDir() {
+		pf.add(SeverityBlock, dest, "destination is not a directory")
+		return
+	}
+	if !canWrite(dest) {
+		pf.add(SeverityBlock, dest, "destination is not writable")
+	}
+
+	for _, item := range p.Items {
+		if !item.Runnable() {
+			continue
+		}
+		pf.Needed += item.Bytes
+
+		if !canRead(item.Src) {
+			pf.add(SeverityWarn, item.Src, "source is not readable; this item will fail")
+		}
+		if item.Op == "move" || item.Op == "delete" {
+			if !canWrite(filepath.Dir(item.Src)) {
+				if item.SameDevice {
+					pf.add(SeverityWarn, item.Src, "source cannot be removed; this item will fail")
+				} else {
+					// The copy would succeed and leave a duplicate behind
+					pf.add(SeverityBlock, item.Src, "source cannot be removed after copying; skip this item")
+				}
+			}
+		}
+	}
+
+	if !fs.IsLocal(dest) {
+		return // Free space of mounted filesystems is not known
+	}
+	free, err := freeSpace(dest)
+	if err != nil {
+		pf.add(SeverityWarn, dest, "cannot determine free space: %v", err)
+		return
+	}
+	pf.Free = int64(min(free, math.MaxInt64))
+	switch {
+	case pf.Needed > pf.Free:
+		pf.add(SeverityBlock, dest, "not enough free space: %d bytes needed, %d available", pf.Needed, pf.Free)
+	case float64(pf.Needed) > float64(pf.Free)*freeSpaceMargin:
+		pf.add(SeverityWarn, dest, "nearly out of space: %d bytes needed, %d available", pf.Needed, pf.Free)
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PruneOptions selects the saved jobs Prune removes. Jobs that are queued,
+// running or still need recovery are always kept.
+type PruneOptions struct {
+	KeepJobs int           // Newest jobs kept, 0 = no limit
+	MaxAge   time.Duration // Older jobs are removed, 0 = no limit
+	Orphans  bool          // Also remove trash of unknown jobs that still holds files
+	DryRun   bool          // Report only
+}
+
+// PruneReport lists what Prune removed (or would remove on a dry run).
+type PruneReport struct {
+	Jobs    []JobSummary
+	Orphans []string // Trash directories without a job
+	Bytes   int64    // Trash and backups freed
+}
+
+// Prune removes obsolete saved jobs (nothing left to undo) and jobs beyond
+// the retention limits, together with their trash and backups, then
+// removes trash directories no job refers to. Empty ones always go; ones
+// holding files only with opts.Orphans.
+func (jm *JobManager) Prune(opts PruneOptions) (*PruneReport, error) {
+	sums, err := jm.Summaries()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PruneReport{}
+	known := make(map[string]bool)
+	kept := 0
+	for _, sum := range sums {
+		known[sum.ID] = true
+		if sum.Unsettled || !sum.State.Done() || jm.IsActive(sum.ID) {
+			continue
+		}
+		expired := opts.MaxAge > 0 && time.Since(sum.CreatedAt) > opts.MaxAge
+		if sum.Undoable && !expired && (opts.KeepJobs <= 0 || kept < opts.KeepJobs) {
+			kept++
+			continue
+		}
+
+		trash, err := TrashDir(sum.ID)
+		if err != nil {
+			return report, err
+		}
+		size, _ := PathSize(trash)
+		if !opts.DryRun {
+			if err := os.RemoveAll(trash); err != nil {
+				return report, err
+			}
+			if err := jm.DeleteJob(sum.ID); err != nil {
+				return report, err
+			}
+		}
+		report.Jobs = append(report.Jobs, sum)
+		report.Bytes += size
+	}
+
+	err = jm.pruneOrphans(known, opts, report)
+	return report, err
+}
+
+// pruneOrphans removes the trash directories of jobs not in known.
+func (jm *JobManager) pruneOrphans(known map[string]bool, opts PruneOptions, report *PruneReport) error {
+	root, err := TrashDir("")
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		id := entry.Name()
+		if known[id] || !entry.IsDir() {
+			continue
+		}
+		// A job file the index skipped (unreadable) still owns its trash
+		if _, err := os.Stat(jm.jobPath(id)); err == nil {
+			continue
+		}
+		dir := filepath.Join(root, id)
+		if hasFiles(dir) && !opts.Orphans {
+			continue
+		}
+		size, _ := PathSize(dir)
+		if !opts.DryRun {
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+		}
+		report.Orphans = append(report.Orphans, dir)
+		report.Bytes += size
+	}
+	return nil
+}
+
+// hasFiles reports whether anything but directories is at or below dir.
+func hasFiles(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,307 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"lazycd/internal/fs"
+)
+
+// PutItem is a single source to be copied or moved by ExecutePut.
+type PutItem struct {
+	Src string
+	Op  string // copy, move
+}
+
+// PutOptions configures ExecutePut.
+type PutOptions struct {
+	TargetDir      string
+	Policy         ConflictPolicy
+	RenameTemplate string // For PolicyRename, DefaultRenameTemplate if empty
+	Verify         HashAlgo
+	Parallelism    int          // Concurrent items, < 1 means 1
+	Force          bool         // Run even if the preflight is blocked
+	Sanitize       SanitizeMode // Rewrite names the target cannot store, "" = auto
+}
+
+// ExecutePut copies or moves items into opts.TargetDir and records the
+// result as a saved job. It is ExecutePlan on an unedited PlanPut.
+func (jm *JobManager) ExecutePut(items []PutItem, opts PutOptions) (*Job, error) {
+	return jm.ExecutePlan(PlanPut(items, opts), opts)
+}
+
+// ExecutePlan runs a (possibly edited) put or delete plan and records the
+// result as a saved job. Unlike Enqueue it blocks until the job is done.
+//
+// Destinations were resolved by the planner in item order, so job.Items
+// always matches plan.Items and two items never claim the same path. The
+// transfers themselves run on a pool of opts.Parallelism workers.
+//
+// Nothing is written if the plan's preflight is blocked, unless
+// opts.Force is set; the returned error then wraps ErrPreflightBlocked.
+func (jm *JobManager) ExecutePlan(plan *Plan, opts PutOptions) (*Job, error) {
+	if plan.Preflight.Blocked() && !opts.Force {
+		return nil, plan.Preflight.err()
+	}
+	job := jm.prepareJob(plan, opts)
+	job.start()
+	return job, jm.runJob(job)
+}
+
+// prepareJob creates the job for plan with one item per plan item. Items
+// that will not run are settled right away.
+func (jm *JobManager) prepareJob(plan *Plan, opts PutOptions) *Job {
+	job := jm.CreateJob(plan.Type)
+	job.Items = make([]JobItem, len(plan.Items))
+	job.TargetDir = plan.TargetDir
+	job.TotalBytes = plan.TotalBytes
+	job.plan = plan
+	job.opts = opts
+	created := false // Archive jobs record their archive on the first item
+
+	for i, pi := range plan.Items {
+		ji := &job.Items[i]
+		ji.Src = pi.Src
+		ji.Dst = pi.Target
+		ji.Op = pi.Op
+		ji.Comparison = pi.Comparison
+
+		switch {
+		case pi.Outcome == OutcomeError:
+			ji.Status = StatusError
+			ji.Error = strings.Join(pi.Errors, "; ")
+		case !pi.Runnable():
+			ji.Status = StatusSkipped
+		default:
+			switch plan.Type {
+			case JobPut:
+				ji.Dst = pi.Dst
+				ji.CreatedPath = pi.Dst
+				ji.Renamed = pi.Renamed
+			case JobArchive:
+				ji.Dst = pi.Dst
+				if !created {
+					ji.CreatedPath = plan.ArchivePath()
+					created = true
+				}
+			}
+			ji.Status = StatusPending
+			job.pending = append(job.pending, i)
+		}
+	}
+	return job
+}
+
+// runJob runs the pending items of a started job and saves the result.
+// Items not started when the job is canceled are skipped.
+func (jm *JobManager) runJob(job *Job) error {
+	// Nothing runs without a record to undo it from
+	if err := jm.SaveJob(job); err != nil {
+		job.mu.Lock()
+		for _, idx := range job.pending {
+			job.Items[idx].Status = StatusError
+			job.Items[idx].Error = "not run: " + err.Error()
+		}
+		job.mu.Unlock()
+		job.finish()
+		return err
+	}
+	// Keep other instances from recovering the job while it runs
+	if lock, err := jm.lockJob(job.ID); err == nil {
+		defer lock.Close()
+	}
+
+	if job.Type == JobArchive {
+		jm.archiveAll(job)
+		job.finish()
+		return jm.SaveJob(job)
+	}
+
+	runPool(job.opts.Parallelism, len(job.pending), func(n int) {
+		idx := job.pending[n]
+		if err := job.ctl.wait(); err != nil {
+			job.updateItem(idx, func(ji *JobItem) {
+				ji.Status = StatusSkipped
+				ji.Error = err.Error()
+			})
+			return
+		}
+		if job.Type == JobDelete {
+			jm.deleteOne(job, idx)
+		} else {
+			jm.putOne(job, idx, job.plan.Items[idx], job.plan.Template, job.opts.Verify)
+		}
+		jm.changed(job)
+	})
+
+	job.finish()
+	return jm.SaveJob(job)
+}
+
+// putOne executes the already resolved job.Items[idx].
+func (jm *JobManager) putOne(job *Job, idx int, planned PlanItem, tmpl string, verify HashAlgo) {
+	job.mu.Lock()
+	item := job.Items[idx]
+	job.mu.Unlock()
+
+	co := &copyOpts{names: planned.Renamed, ctl: job.ctl}
+	var opErr error
+	var res *MoveResult
+	var sum *Checksum
+	var backup, existing string
+	claimed := false
+
+	if planned.Outcome == OutcomeOverwrite {
+		// Keep the replaced file so undo can restore it. It may be named
+		// differently (case/normalization) from the new dst.
+		existing = item.Dst
+		if planned.Existing != "" {
+			existing = planned.Existing
+		}
+		backup, opErr = backupExisting(existing, job.ID, idx)
+	} else if planned.Outcome != OutcomeResume {
+		claimed, opErr = claimDst(&item, planned, tmpl)
+	}
+
+	if opErr == nil {
+		switch {
+		case planned.Outcome == OutcomeResume:
+			// The partial holds the name; canceling keeps it for later
+			sum, opErr = resumeCopy(item.Src, item.Dst, verify, co)
+		case item.Op == "move":
+			res, opErr = moveVerified(item.Src, item.Dst, verify, co, jm.TrackMove(job, idx))
+		default:
+			sum, opErr = copyVerified(item.Src, item.Dst, verify, co)
+		}
+	}
+
+	// Drop the placeholder, or the partial file or tree copied so far,
+	// unless the data reached dst. What cannot be removed stays reported.
+	if opErr != nil && claimed && (res == nil || !res.placed()) {
+		if err := fs.RemoveAll(item.Dst); err != nil {
+			opErr = fmt.Errorf("%v (cleanup of %s failed: %v)", opErr, item.Dst, err)
+		}
+	}
+	// Put the replaced entry back if the new one did not take its place.
+	// Should that fail the item keeps BackupPath, for undo to restore it.
+	if opErr != nil && backup != "" && (res == nil || !res.placed()) {
+		if err := restoreBackup(backup, existing, item.Dst); err != nil {
+			opErr = fmt.Errorf("%v (restoring the replaced '%s' failed: %v)", opErr, existing, err)
+		} else {
+			backup = ""
+		}
+	}
+
+	// Fingerprint the result outside the lock, directories are walked
+	var fp *Fingerprint
+	if opErr == nil {
+		fp, _ = TakeFingerprint(item.CreatedPath)
+	}
+
+	job.updateItem(idx, func(ji *JobItem) {
+		ji.Dst = item.Dst
+		ji.CreatedPath = item.CreatedPath
+		ji.BackupPath = backup
+		ji.SetMoveResult(res)
+		ji.SetChecksum(sum)
+		ji.setResult(opErr)
+		ji.Fingerprint = fp
+	})
+}
+
+// restoreBackup moves the backup of an overwritten entry back to existing,
+// removing what a failed transfer left at dst first.
+func restoreBackup(backup, existing, dst string) error {
+	if err := fs.RemoveAll(dst); err != nil {
+		return err
+	}
+	if fs.IsLocal(dst) {
+		if err := removePartial(dst); err != nil {
+			return err
+		}
+	}
+	return Move(backup, existing)
+}
+
+// setResult sets the status of a finished item from its error. Items
+// stopped by Cancel wrote nothing that stays and count as skipped; one
+// whose leftovers could not be removed carries a wrapped error instead
+// and counts as failed.
+func (ji *JobItem) setResult(err error) {
+	switch {
+	case err == nil:
+		ji.Status = StatusOK
+	case errors.Is(err, ErrCanceled):
+		ji.Status = StatusSkipped
+		ji.Error = err.Error()
+	default:
+		ji.Status = StatusError
+		ji.Error = err.Error()
+	}
+}
+
+// claimDst takes item.Dst with ClaimPath so nothing else can create it
+// in the meantime. A renamed item whose name was taken since planning
+// moves on to the next free name; any other item fails. Symlinks are not
+// claimed since creating them is exclusive already.
+func claimDst(item *JobItem, planned PlanItem, tmpl string) (bool, error) {
+	info, err := fs.Lstat(item.Src)
+	if err != nil {
+		return false, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if exists, err := CheckConflict(item.Dst); err != nil || exists {
+			return false, conflictSincePlanning(item.Dst, err)
+		}
+		return false, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := ClaimPath(item.Dst, info.Mode())
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsExist(err) || planned.Outcome != OutcomeRename || attempt >= maxClaimAttempts {
+			return false, conflictSincePlanning(item.Dst, err)
+		}
+		dst, err := findFreeName(planned.Target, nil, tmpl)
+		if err != nil {
+			return false, err
+		}
+		item.Dst = dst
+		item.CreatedPath = dst
+	}
+}
+
+// maxClaimAttempts bounds how often a renamed item retries after losing
+// its name to a concurrent writer.
+const maxClaimAttempts = 16
+
+func conflictSincePlanning(dst string, err error) error {
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	return fmt.Errorf("'%s' appeared since planning", dst)
+}
+
+// deleteOne moves job.Items[idx].Src to the job's trash.
+func (jm *JobManager) deleteOne(job *Job, idx int) {
+	job.mu.Lock()
+	src := job.Items[idx].Src
+	job.mu.Unlock()
+
+	trashPath, res, err := DeleteToTrash(src, job.ID, idx, jm.TrackMove(job, idx))
+	var fp *Fingerprint
+	if err == nil {
+		fp, _ = TakeFingerprint(trashPath)
+	}
+
+	job.updateItem(idx, func(ji *JobItem) {
+		ji.TrashPath = trashPath
+		ji.SetMoveResult(res)
+		ji.setResult(err)
+		ji.Fingerprint = fp
+	})
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lazycd/internal/fs"
+)
+
+func TestExecutePlanPolicies(t *testing.T) {
+	tests := []struct {
+		policy   ConflictPolicy
+		src      string
+		existing string
+		srcAge   time.Duration // How much older than the existing file src is
+		status   JobItemStatus
+		want     map[string]string // Target afterwards
+	}{
+		{PolicySkip, "new", "old", 0, StatusSkipped, map[string]string{"f.txt": "old"}},
+		{PolicyRename, "new", "old", 0, StatusOK, map[string]string{"f.txt": "old", "f (1).txt": "new"}},
+		{PolicyOverwrite, "new", "old", 0, StatusOK, map[string]string{"f.txt": "new"}},
+		{PolicyNewer, "new", "old", -time.Hour, StatusOK, map[string]string{"f.txt": "new"}},
+		{PolicyNewer, "new", "old", time.Hour, StatusSkipped, map[string]string{"f.txt": "old"}},
+		{PolicyLarger, "newer", "old", 0, StatusOK, map[string]string{"f.txt": "newer"}},
+		{PolicyLarger, "ne", "old", 0, StatusSkipped, map[string]string{"f.txt": "old"}},
+		{PolicySizeDiffers, "ne", "old", 0, StatusOK, map[string]string{"f.txt": "ne"}},
+		{PolicySizeDiffers, "new", "old", 0, StatusSkipped, map[string]string{"f.txt": "old"}},
+		{PolicySkipIdentical, "new", "old", 0, StatusOK, map[string]string{"f.txt": "new"}},
+		{PolicySkipIdentical, "old", "old", 0, StatusSkipped, map[string]string{"f.txt": "old"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			jm := newJobManager(t)
+			src := filepath.Join(mountMem(t, "src"), "f.txt")
+			target := mountMem(t, "target")
+			writeFile(t, src, tt.src)
+			writeFile(t, filepath.Join(target, "f.txt"), tt.existing)
+			setModTime(t, filepath.Join(target, "f.txt"), 2*time.Hour)
+			setModTime(t, src, 2*time.Hour+tt.srcAge)
+
+			opts := PutOptions{TargetDir: target, Policy: tt.policy}
+			job, err := jm.ExecutePut([]PutItem{{Src: src, Op: "copy"}}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item := job.Items[0]; item.Status != tt.status {
+				t.Errorf("status: got %s (%s), want %s", item.Status, item.Error, tt.status)
+			}
+			assertTree(t, target, tt.want)
+		})
+	}
+}
+
+func TestExecutePlanOverwriteKeepsBackup(t *testing.T) {
+	jm := newJobManager(t)
+	src := filepath.Join(mountMem(t, "src"), "f")
+	target := mountMem(t, "target")
+	writeFile(t, src, "new")
+	writeFile(t, filepath.Join(target, "f"), "old")
+
+	job, err := jm.ExecutePut([]PutItem{{Src: src, Op: "copy"}}, PutOptions{TargetDir: target, Policy: PolicyOverwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := job.Items[0]
+	if item.BackupPath == "" {
+		t.Fatal("no backup recorded")
+	}
+	if got := readFile(t, item.BackupPath); got != "old" {
+		t.Errorf("backup: got %q", got)
+	}
+}
+
+func TestExecutePlanOverwriteFailureRestores(t *testing.T) {
+	jm := newJobManager(t)
+	src := filepath.Join(mountMem(t, "src"), "f")
+	target := mountMem(t, "target")
+	writeFile(t, src, "new")
+	writeFile(t, filepath.Join(target, "f"), "old")
+
+	opts := PutOptions{TargetDir: target, Policy: PolicyOverwrite}
+	plan := PlanPut([]PutItem{{Src: src, Op: "copy"}}, opts)
+	if err := fs.Remove(src); err != nil {
+		t.Fatal(err)
+	}
+	job, err := jm.ExecutePlan(plan, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item := job.Items[0]; item.Status != StatusError || item.BackupPath != "" {
+		t.Errorf("item: got status %s, backup %q", item.Status, item.BackupPath)
+	}
+	assertTree(t, target, map[string]string{"f": "old"})
+}
+
+func TestExecutePlanMergesDirectories(t *testing.T) {
+	jm := newJobManager(t)
+	src := filepath.Join(mountMem(t, "src"), "d")
+	target := mountMem(t, "target")
+	writeTree(t, src, map[string]string{"a": "new", "b": "new", "sub/": "", "sub/c": "new"})
+	writeTree(t, filepath.Join(target, "d"), map[string]string{"a": "old", "b": "newer", "sub/": ""})
+	setModTime(t, filepath.Join(target, "d", "a"), 2*time.Hour)
+	setModTime(t, filepath.Join(src, "b"), 2*time.Hour)
+
+	opts := PutOptions{TargetDir: target, Policy: PolicyNewer}
+	plan := PlanPut([]PutItem{{Src: src, Op: "copy"}}, opts)
+	if plan.Items[0].Outcome != OutcomeMerge {
+		t.Fatalf("outcome: got %s, want %s", plan.Items[0].Outcome, OutcomeMerge)
+	}
+	if _, err := jm.ExecutePlan(plan, opts); err != nil {
+		t.Fatal(err)
+	}
+	assertTree(t, target, map[string]string{
+		"d/":      "",
+		"d/a":     "new",
+		"d/b":     "newer",
+		"d/sub/":  "",
+		"d/sub/c": "new",
+	})
+}
+
+func TestExecutePlanMove(t *testing.T) {
+	jm := newJobManager(t)
+	srcDir := mountMem(t, "src")
+	target := mountMem(t, "target")
+	writeTree(t, srcDir, map[string]string{"f": "1", "d/": "", "d/g": "2"})
+
+	items := []PutItem{
+		{Src: filepath.Join(srcDir, "f"), Op: "move"},
+		{Src: filepath.Join(srcDir, "d"), Op: "move"},
+	}
+	job, err := jm.ExecutePut(items, PutOptions{TargetDir: target, Verify: HashXXH64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range job.Items {
+		if item.Status != StatusOK {
+			t.Errorf("%s: %s (%s)", item.Src, item.Status, item.Error)
+		}
+	}
+	if job.State != JobFinished {
+		t.Errorf("state: got %s", job.State)
+	}
+	assertTree(t, srcDir, map[string]string{})
+	assertTree(t, target, map[string]string{"f": "1", "d/": "", "d/g": "2"})
+}
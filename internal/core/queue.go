@@ -0,0 +1,388 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrCanceled is the error of transfers stopped by canceling their job.
+var ErrCanceled = errors.New("canceled")
+
+// JobState is where a job is in its lifecycle.
+type JobState string
+
+const (
+	JobQueued   JobState = "queued"
+	JobRunning  JobState = "running"
+	JobPaused   JobState = "paused"
+	JobFinished JobState = "finished" // All runnable items succeeded
+	JobFailed   JobState = "failed"   // At least one item failed
+	JobCanceled JobState = "canceled"
+)
+
+// Done reports whether a job in state s will not change anymore. Jobs
+// saved before job states existed have no state and count as done.
+func (s JobState) Done() bool {
+	switch s {
+	case JobQueued, JobRunning, JobPaused:
+		return false
+	}
+	return true
+}
+
+// jobControl lets a running job be paused, resumed and canceled between
+// writes, and counts the bytes the job wrote.
+type jobControl struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	paused   bool
+	canceled bool
+	written  atomic.Int64
+}
+
+func newJobControl() *jobControl {
+	c := &jobControl{}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// wait blocks while the job is paused and returns ErrCanceled once it is
+// canceled. A nil control never blocks.
+func (c *jobControl) wait() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.paused && !c.canceled {
+		c.cond.Wait()
+	}
+	if c.canceled {
+		return ErrCanceled
+	}
+	return nil
+}
+
+func (c *jobControl) setPaused(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = paused
+	c.cond.Broadcast()
+}
+
+func (c *jobControl) cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.canceled = true
+	c.cond.Broadcast()
+}
+
+func (c *jobControl) isCanceled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.canceled
+}
+
+// controlledWriter honors pause/cancel before every write and counts the
+// bytes written.
+type controlledWriter struct {
+	w   io.Writer
+	ctl *jobControl
+}
+
+func (cw controlledWriter) Write(p []byte) (int, error) {
+	if err := cw.ctl.wait(); err != nil {
+		return 0, err
+	}
+	n, err := cw.w.Write(p)
+	cw.ctl.written.Add(int64(n))
+	return n, err
+}
+
+// JobProgress is a snapshot of a job's state and progress.
+type JobProgress struct {
+	State     JobState
+	Items     int // Items that run (not skipped by the plan)
+	ItemsDone int
+	Failed    int
+	Bytes     int64
+	BytesDone int64
+}
+
+// Progress returns a consistent snapshot of the job's progress.
+func (job *Job) Progress() JobProgress {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	p := JobProgress{State: job.State, Items: len(job.pending), Bytes: job.TotalBytes}
+	for _, idx := range job.pending {
+		if job.Items[idx].Status != StatusPending {
+			p.ItemsDone++
+		}
+	}
+	for _, item := range job.Items {
+		if item.Status == StatusError {
+			p.Failed++
+		}
+	}
+	switch {
+	case p.State == JobFinished:
+		p.BytesDone = p.Bytes
+	case job.ctl != nil:
+		p.BytesDone = min(job.ctl.written.Load(), p.Bytes)
+	}
+	return p
+}
+
+func (job *Job) state() JobState {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.State
+}
+
+// start marks the job running; it reports false if the job was paused or
+// canceled before it could start.
+func (job *Job) start() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.State != JobQueued && job.State != "" {
+		return false
+	}
+	job.State = JobRunning
+	job.started = true
+	return true
+}
+
+// finish sets the final state from the item results.
+func (job *Job) finish() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.State = JobFinished
+	for _, item := range job.Items {
+		if item.Status == StatusError {
+			job.State = JobFailed
+		}
+	}
+	if job.ctl != nil && job.ctl.isCanceled() {
+		job.State = JobCanceled
+	}
+}
+
+// SaveErr returns the error saving a queued job's record, if any. The job
+// ran (or was refused) but its record on disk may be missing or outdated.
+func (job *Job) SaveErr() error {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.saveErr
+}
+
+// skipPending marks every item that has not run yet as skipped.
+func (job *Job) skipPending(reason string) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	for _, idx := range job.pending {
+		if item := &job.Items[idx]; item.Status == StatusPending && item.Phase == PhaseNone {
+			item.Status = StatusSkipped
+			item.Error = reason
+		}
+	}
+}
+
+// Enqueue adds a put or delete plan to the job queue and returns its job
+// without waiting for it. Queued jobs run in queue order, MaxRunning at a
+// time; OnChange is told about their progress. Like ExecutePlan, a
+// blocked preflight is refused unless opts.Force is set.
+func (jm *JobManager) Enqueue(plan *Plan, opts PutOptions) (*Job, error) {
+	if plan.Preflight.Blocked() && !opts.Force {
+		return nil, plan.Preflight.err()
+	}
+	job := jm.prepareJob(plan, opts)
+	job.State = JobQueued
+	job.ctl = newJobControl()
+
+	jm.mu.Lock()
+	jm.queue = append(jm.queue, job)
+	jm.mu.Unlock()
+
+	jm.changed(job)
+	jm.schedule()
+	return job, nil
+}
+
+// schedule starts queued jobs while fewer than MaxRunning are running.
+func (jm *JobManager) schedule() {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	for _, job := range jm.queue {
+		if jm.running >= max(jm.MaxRunning, 1) {
+			return
+		}
+		if job.state() == JobQueued && job.start() {
+			jm.running++
+			jm.wg.Add(1)
+			go jm.runQueued(job)
+		}
+	}
+}
+
+func (jm *JobManager) runQueued(job *Job) {
+	defer jm.wg.Done()
+	if err := jm.runJob(job); err != nil {
+		job.mu.Lock()
+		job.saveErr = err
+		job.mu.Unlock()
+	}
+
+	jm.mu.Lock()
+	jm.running--
+	jm.mu.Unlock()
+	jm.changed(job)
+	jm.schedule()
+}
+
+// Jobs returns the jobs queued this session in queue order, including
+// the ones that have finished.
+func (jm *JobManager) Jobs() []*Job {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return append([]*Job(nil), jm.queue...)
+}
+
+// Active returns the number of queued, running and paused jobs.
+func (jm *JobManager) Active() int {
+	n := 0
+	for _, job := range jm.Jobs() {
+		if !job.state().Done() {
+			n++
+		}
+	}
+	return n
+}
+
+// IsActive reports whether the job with the given ID is still queued,
+// running or paused.
+func (jm *JobManager) IsActive(id string) bool {
+	for _, job := range jm.Jobs() {
+		if job.ID == id {
+			return !job.state().Done()
+		}
+	}
+	return false
+}
+
+// Pause stops a queued job from starting, or a running job at its next
+// write. A paused running job keeps its slot.
+func (jm *JobManager) Pause(job *Job) {
+	job.mu.Lock()
+	switch job.State {
+	case JobQueued, JobRunning:
+		job.State = JobPaused
+		if job.started {
+			job.ctl.setPaused(true)
+		}
+	}
+	job.mu.Unlock()
+	jm.changed(job)
+}
+
+// Resume continues a paused job.
+func (jm *JobManager) Resume(job *Job) {
+	job.mu.Lock()
+	if job.State == JobPaused {
+		if job.started {
+			job.State = JobRunning
+			job.ctl.setPaused(false)
+		} else {
+			job.State = JobQueued
+		}
+	}
+	job.mu.Unlock()
+	jm.changed(job)
+	jm.schedule()
+}
+
+// Cancel stops a job. A job that has not started is dropped with all items
+// skipped; a running one stops at its next write, cleans up the
+// interrupted item like a failed one and keeps the completed items.
+func (jm *JobManager) Cancel(job *Job) {
+	job.mu.Lock()
+	if job.State.Done() {
+		job.mu.Unlock()
+		return
+	}
+	started := job.started
+	if !started {
+		job.State = JobCanceled
+	}
+	if job.ctl != nil {
+		job.ctl.cancel()
+	}
+	job.mu.Unlock()
+
+	if !started {
+		job.skipPending("canceled")
+	}
+	jm.changed(job)
+}
+
+// CancelAll cancels every active job and waits for the running ones to
+// stop.
+func (jm *JobManager) CancelAll() {
+	for _, job := range jm.Jobs() {
+		jm.Cancel(job)
+	}
+	jm.wg.Wait()
+}
+
+// MoveQueued moves a job that has not started yet by delta places among
+// the other waiting jobs. It reports whether the job moved.
+func (jm *JobManager) MoveQueued(job *Job, delta int) bool {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	waiting := func(j *Job) bool {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		return !j.started && !j.State.Done()
+	}
+	if !waiting(job) {
+		return false
+	}
+
+	i := -1
+	for k, j := range jm.queue {
+		if j == job {
+			i = k
+		}
+	}
+	if i < 0 {
+		return false
+	}
+
+	step := 1
+	if delta < 0 {
+		step, delta = -1, -delta
+	}
+	moved := false
+	for ; delta > 0; delta-- {
+		k := i + step
+		for k >= 0 && k < len(jm.queue) && !waiting(jm.queue[k]) {
+			k += step
+		}
+		if k < 0 || k >= len(jm.queue) {
+			break
+		}
+		jm.queue[i], jm.queue[k] = jm.queue[k], jm.queue[i]
+		i = k
+		moved = true
+	}
+	return moved
+}
+
+func (jm *JobManager) changed(job *Job) {
+	if jm.OnChange != nil {
+		jm.OnChange(job)
+	}
+}
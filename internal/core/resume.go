@@ -0,0 +1,256 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lazycd/internal/fs"
+)
+
+const (
+	// PartialSuffix marks a file that is still being transferred.
+	PartialSuffix = ".lazycd-partial"
+	// partialMetaSuffix is appended to the partial path for its sidecar.
+	partialMetaSuffix = ".json"
+)
+
+// ResumeThreshold is the file size from which CopyFile writes through a
+// resumable partial file. Smaller files are cheap enough to start over.
+var ResumeThreshold int64 = 64 << 20
+
+// resumeChunk is how much is copied between sidecar checkpoints.
+const resumeChunk = 16 << 20
+
+// ErrSourceChanged is returned when resuming a partial whose source no
+// longer matches the size/mtime it had when the transfer started.
+var ErrSourceChanged = errors.New("source changed since transfer started")
+
+// PartialInfo is the sidecar stored next to a .lazycd-partial file.
+type PartialInfo struct {
+	Src     string    `json:"src"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Done    int64     `json:"done"` // Bytes safely written to the partial
+}
+
+// PartialPath returns the in-progress path used while transferring to dst.
+func PartialPath(dst string) string {
+	return dst + PartialSuffix
+}
+
+func partialMetaPath(partial string) string {
+	return partial + partialMetaSuffix
+}
+
+// removePartial removes the partial file of a transfer to dst and its
+// sidecar, if any.
+func removePartial(dst string) error {
+	partial := PartialPath(dst)
+	for _, path := range []string{partial, partialMetaPath(partial)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPartialInfo loads the sidecar of a partial file.
+func ReadPartialInfo(partial string) (*PartialInfo, error) {
+	data, err := os.ReadFile(partialMetaPath(partial))
+	if err != nil {
+		return nil, err
+	}
+	var info PartialInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func writePartialInfo(partial string, info *PartialInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partialMetaPath(partial), data, 0644)
+}
+
+// matches reports whether the source still looks like it did when the
+// transfer started.
+func (pi *PartialInfo) matches(src string, stat os.FileInfo) bool {
+	return pi.Src == src && pi.Size == stat.Size() && pi.ModTime.Equal(stat.ModTime())
+}
+
+// copyFileResumable copies src to dst via PartialPath(dst). If a partial
+// with a matching sidecar already exists, copying continues from the last
+// checkpoint instead of starting from zero.
+func copyFileResumable(src, dst string, stat os.FileInfo, co *copyOpts) error {
+	partial := PartialPath(dst)
+
+	var offset int64
+	if prev, err := ReadPartialInfo(partial); err == nil && prev.matches(src, stat) {
+		if pStat, err := os.Stat(partial); err == nil {
+			offset = min(prev.Done, pStat.Size())
+		}
+	}
+
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE, stat.Mode())
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	// Drop anything written after the last checkpoint
+	if err := destination.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := source.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := destination.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	info := &PartialInfo{Src: src, Size: stat.Size(), ModTime: stat.ModTime(), Done: offset}
+	if err := writePartialInfo(partial, info); err != nil {
+		return err
+	}
+
+	for info.Done < info.Size {
+		n, err := io.CopyN(co.writer(destination), source, resumeChunk)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err := destination.Sync(); err != nil {
+			return err
+		}
+		info.Done += n
+		if err := writePartialInfo(partial, info); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%s: %w (short read at %d bytes)", src, ErrSourceChanged, info.Done)
+		}
+	}
+
+	if err := destination.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(partial, time.Now(), stat.ModTime()); err != nil {
+		return err
+	}
+	if err := os.Rename(partial, dst); err != nil {
+		return err
+	}
+	return os.Remove(partialMetaPath(partial))
+}
+
+// PlanResume plans continuing the interrupted copies of partials (see
+// FindPartials) in targetDir as a put: each item copies the source named in
+// the sidecar to the file the partial is named after, from where it
+// stopped. A source modified in the meantime fails with ErrSourceChanged.
+func PlanResume(partials []string, targetDir string) *Plan {
+	plan := &Plan{
+		Type:      JobPut,
+		TargetDir: targetDir,
+		Items:     make([]PlanItem, len(partials)),
+	}
+	for i, partial := range partials {
+		pi := &plan.Items[i]
+		pi.Src = partial
+		pi.Op = "copy"
+		pi.Target = strings.TrimSuffix(partial, PartialSuffix)
+		pi.Outcome = OutcomeError
+
+		info, err := ReadPartialInfo(partial)
+		if err != nil {
+			pi.addError("%v", err)
+			continue
+		}
+		pi.Src = info.Src
+		stat, err := os.Stat(info.Src)
+		switch {
+		case err != nil:
+			pi.addError("source: %v", err)
+		case !info.matches(info.Src, stat):
+			pi.addError("%s: %v", info.Src, ErrSourceChanged)
+		default:
+			pi.Outcome = OutcomeResume
+			pi.Dst = pi.Target
+			pi.Bytes = max(info.Size-info.Done, 0)
+			plan.TotalBytes += pi.Bytes
+		}
+	}
+	plan.preflight()
+	return plan
+}
+
+// resumeCopy continues the interrupted copy of src to dst, checking
+// the result like copyVerified.
+func resumeCopy(src, dst string, algo HashAlgo, co *copyOpts) (*Checksum, error) {
+	info, err := ReadPartialInfo(PartialPath(dst))
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.matches(src, stat) {
+		return nil, fmt.Errorf("%s: %w", src, ErrSourceChanged)
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return nil, fmt.Errorf("'%s' appeared since the copy was interrupted", dst)
+	}
+
+	if err := copyFileResumable(src, dst, stat, co); err != nil {
+		return nil, err
+	}
+	if algo == HashNone {
+		return nil, nil
+	}
+	return verifyCopy(src, dst, algo, nil)
+}
+
+// FindPartials returns the partial files in dir and its subdirectories
+// that have a sidecar and can therefore be resumed; each completes the
+// file it is named after. Partials of the temporary copy of a move are left
+// out: the move cannot be resumed, startup recovery removes them. Only
+// local transfers leave partials, so other filesystems have none.
+func FindPartials(dir string) ([]string, error) {
+	if !fs.IsLocal(dir) {
+		return nil, nil
+	}
+
+	var partials []string
+	err := filepath.WalkDir(dir, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil // Skip what cannot be read below dir
+		}
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, PartialSuffix) || isTempSibling(name) {
+			return nil
+		}
+		if _, err := os.Stat(partialMetaPath(path)); err == nil {
+			partials = append(partials, path)
+		}
+		return nil
+	})
+	return partials, err
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/cespare/xxhash/v2"
+
+	"lazycd/internal/fs"
+)
+
+// SanitizeMode controls whether Put rewrites names the target filesystem
+// cannot store.
+type SanitizeMode string
+
+const (
+	SanitizeOff    SanitizeMode = "off"
+	SanitizeAuto   SanitizeMode = "auto"   // Only on restrictive filesystems (default)
+	SanitizeAlways SanitizeMode = "always" // Even where the names would work
+)
+
+// SanitizeModes lists every sanitize mode in cycling order.
+var SanitizeModes = []SanitizeMode{SanitizeAuto, SanitizeAlways, SanitizeOff}
+
+// Valid reports whether m is a known mode.
+func (m SanitizeMode) Valid() bool {
+	for _, known := range SanitizeModes {
+		if m == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Restrictive reports whether filesystems of the given type (see
+// FilesystemType) only accept FAT-style names. fuseblk mounts are
+// block-device FUSE drivers, which in practice means ntfs-3g or exfat.
+func Restrictive(fsType string) bool {
+	switch fsType {
+	case "vfat", "msdos", "exfat", "ntfs", "fuseblk", "fuse.exfat", "fuse.ntfs-3g", "ntfs-3g":
+		return true
+	}
+	return false
+}
+
+// enabled reports whether names put into a directory on fsType get
+// sanitized under mode m.
+func (m SanitizeMode) enabled(fsType string) bool {
+	switch m {
+	case SanitizeAlways:
+		return true
+	case SanitizeOff:
+		return false
+	default:
+		return Restrictive(fsType)
+	}
+}
+
+// maxNameUnits is the longest FAT/exFAT name, in UTF-16 code units.
+const maxNameUnits = 255
+
+// illegalNameChars cannot appear in FAT, exFAT or Windows names.
+const illegalNameChars = `<>:"/\|?*`
+
+// reservedNames are DOS device names, invalid with any extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeName maps name to one that FAT and exFAT accept. Illegal and
+// control characters become "_", trailing dots and spaces are dropped,
+// DOS device names get a "_" appended and over-long names are truncated
+// with a short hash of the original name, so the result is deterministic
+// and distinct names stay distinct. Valid names are returned unchanged.
+func SanitizeName(name string) string {
+	clean := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(illegalNameChars, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	clean = strings.TrimRight(clean, ". ")
+	if clean == "" {
+		clean = "_"
+	}
+
+	base, ext := SplitExt(clean)
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		base += "_"
+	}
+	clean = base + ext
+
+	if utf16Len(clean) > maxNameUnits {
+		suffix := fmt.Sprintf("~%06x", xxhash.Sum64String(name)&0xffffff)
+		if utf16Len(ext) > maxNameUnits/8 {
+			ext = "" // Absurd extension, truncate it with the rest
+			base = clean
+		}
+		base = truncateUTF16(base, maxNameUnits-utf16Len(suffix)-utf16Len(ext))
+		clean = strings.TrimRight(base, ". ") + suffix + ext
+	}
+	return clean
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// truncateUTF16 cuts s to at most max UTF-16 code units without
+// splitting a rune.
+func truncateUTF16(s string, max int) string {
+	n := 0
+	for i, r := range s {
+		n += utf16.RuneLen(r)
+		if n > max {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// SanitizeTree returns the entries below the directory src whose names
+// SanitizeName changes, as a map from original to sanitized relative
+// slash-separated paths. Sanitized names that would collide with a
+// sibling (ignoring case, as FAT does) get a hash suffix.
+func SanitizeTree(src string) (map[string]string, error) {
+	info, err := fs.Lstat(src)
+	if err != nil || !info.IsDir() {
+		return nil, err
+	}
+	names := make(map[string]string)
+	if err := sanitizeDir(src, "", "", names); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return names, nil
+}
+
+// sanitizeDir records renames for the entries of dir, whose original and
+// sanitized relative paths are rel and newRel.
+func sanitizeDir(dir, rel, newRel string, names map[string]string) error {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// Unchanged names win collisions, so claim them first
+	used := make(map[string]bool)
+	for _, entry := range entries {
+		if SanitizeName(entry.Name()) == entry.Name() {
+			used[strings.ToLower(entry.Name())] = true
+		}
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		clean := SanitizeName(name)
+		if clean != name {
+			if used[strings.ToLower(clean)] {
+				base, ext := SplitExt(clean)
+				clean = fmt.Sprintf("%s~%06x%s", base, xxhash.Sum64String(name)&0xffffff, ext)
+			}
+			used[strings.ToLower(clean)] = true
+		}
+
+		childRel, childNew := path.Join(rel, name), path.Join(newRel, clean)
+		if clean != name {
+			names[childRel] = childNew
+		}
+		if entry.IsDir() {
+			if err := sanitizeDir(filepath.Join(dir, name), childRel, childNew, names); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mapName returns the name the entry at the original relative path rel
+// gets in the destination tree.
+func mapName(names map[string]string, rel string) string {
+	if newRel, ok := names[rel]; ok {
+		return path.Base(newRel)
+	}
+	return path.Base(rel)
+}
+
+// renameTree applies names to the tree at root in place: forward renames
+// original entries to their sanitized names, otherwise sanitized entries
+// are renamed back. Deeper entries go first so their parents' paths are
+// still valid.
+func renameTree(root string, names map[string]string, forward bool) error {
+	type rename struct{ from, to string }
+	var renames []rename
+	for orig, clean := range names {
+		if forward {
+			renames = append(renames, rename{orig, path.Join(path.Dir(orig), path.Base(clean))})
+		} else {
+			renames = append(renames, rename{clean, path.Join(path.Dir(clean), path.Base(orig))})
+		}
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		di, dj := strings.Count(renames[i].from, "/"), strings.Count(renames[j].from, "/")
+		if di != dj {
+			return di > dj
+		}
+		return renames[i].from < renames[j].from
+	})
+
+	for _, r := range renames {
+		from := filepath.Join(root, filepath.FromSlash(r.from))
+		to := filepath.Join(root, filepath.FromSlash(r.to))
+		if err := fs.Rename(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invalidNames returns the names at or below src (relative to the parent
+// of src) that SanitizeName would change, up to limit of them.
+func invalidNames(src string, limit int) []string {
+	var bad []string
+	parent := filepath.Dir(src)
+	_ = fs.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil || len(bad) >= limit {
+			return filepath.SkipAll
+		}
+		if SanitizeName(d.Name()) != d.Name() {
+			rel, _ := filepath.Rel(parent, p)
+			bad = append(bad, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return bad
+}
@@ -0,0 +1,329 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"lazycd/internal/fs"
+)
+
+// Fingerprint identifies what a job left on disk. Directories are
+// measured by the total size of the files below them.
+type Fingerprint struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Inode   uint64    `json:"inode,omitempty"`
+}
+
+// TakeFingerprint records the current state of path.
+func TakeFingerprint(path string) (*Fingerprint, error) {
+	info, err := fs.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if info.IsDir() {
+		if size, err = PathSize(path); err != nil {
+			return nil, err
+		}
+	}
+	return &Fingerprint{Size: size, ModTime: info.ModTime(), Inode: inodeOf(info)}, nil
+}
+
+// Drift describes how path differs from the fingerprint, "" if it does not.
+func (fp *Fingerprint) Drift(path string) string {
+	now, err := TakeFingerprint(path)
+	switch {
+	case os.IsNotExist(err):
+		return "no longer exists"
+	case err != nil:
+		return err.Error()
+	case fp.Inode != 0 && now.Inode != 0 && fp.Inode != now.Inode:
+		return "replaced since the job"
+	case fp.Size != now.Size:
+		return fmt.Sprintf("size changed (%d -> %d bytes)", fp.Size, now.Size)
+	case !fp.ModTime.Equal(now.ModTime):
+		return "modified since the job"
+	}
+	return ""
+}
+
+// UndoOptions controls how Undo treats paths changed since the job.
+type UndoOptions struct {
+	Force  bool           // Undo items even if they changed since the job
+	Verify bool           // Also compare contents with the checksums of verify mode
+	Policy ConflictPolicy // For entries now occupying a restore target, PolicySkip if empty
+}
+
+// UndoOutcome is what Undo did with one job item.
+type UndoOutcome string
+
+const (
+	UndoRestored UndoOutcome = "restored" // Reverted
+	UndoSkipped  UndoOutcome = "skipped"  // Restore target taken; left by the conflict policy
+	UndoChanged  UndoOutcome = "changed"  // Refused: modified since the job
+	UndoFailed   UndoOutcome = "failed"
+)
+
+// UndoItem reports the undo of one job item.
+type UndoItem struct {
+	Index   int    // Index in job.Items
+	Op      string // copy, move, delete
+	Src     string // Original path
+	Path    string // Where the job left it
+	Outcome UndoOutcome
+	Reason  string // Why it changed, failed or was skipped
+
+	// Where the item or a backup went back to if the conflict policy
+	// renamed it, and where an entry it overwrote was set aside
+	RestoredTo string
+	SetAside   string
+}
+
+// UndoResult reports the undo of a job item by item, newest item first.
+type UndoResult struct {
+	JobID string
+	Items []UndoItem
+}
+
+// Count returns the number of items with the outcome.
+func (r *UndoResult) Count(outcome UndoOutcome) int {
+	n := 0
+	for _, item := range r.Items {
+		if item.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// undoable reports whether Undo has something to revert for the item. A
+// failed item has if its move is unsettled or it holds the backup of a
+// replaced entry that could not be put back (see putOne).
+func (ji *JobItem) undoable() bool {
+	if ji.Status == StatusOK {
+		return true
+	}
+	return ji.Status != StatusUndone && (ji.needsSettling() || ji.BackupPath != "")
+}
+
+// undoPath returns where the job left the item. Only the first item of
+// an archive job records the archive; the others are its members.
+func (ji *JobItem) undoPath() string {
+	switch {
+	case ji.Op == "delete":
+		return ji.TrashPath
+	case ji.Op == "archive" && ji.CreatedPath == "":
+		return ji.Dst
+	}
+	return ji.CreatedPath
+}
+
+// drift describes how the item's path changed since the job, "" if it
+// did not or there is nothing to compare against.
+func (ji *JobItem) drift(verify bool) string {
+	path := ji.undoPath()
+	if ji.Fingerprint == nil || path == "" || ji.needsSettling() {
+		return "" // Interrupted moves and jobs of older versions
+	}
+	if reason := ji.Fingerprint.Drift(path); reason != "" {
+		return reason
+	}
+	if verify && ji.DstHash != "" && ji.Op != "delete" {
+		sum, err := HashPath(path, ji.HashAlgo)
+		if err != nil {
+			return err.Error()
+		}
+		if sum != ji.DstHash {
+			return fmt.Sprintf("contents changed (%s mismatch)", ji.HashAlgo)
+		}
+	}
+	return ""
+}
+
+// CheckUndo returns the items of job that changed since it ran, the ones
+// Undo refuses without opts.Force.
+func (jm *JobManager) CheckUndo(job *Job, opts UndoOptions) []UndoItem {
+	var changed []UndoItem
+	for i := len(job.Items) - 1; i >= 0; i-- {
+		item := &job.Items[i]
+		if !item.undoable() {
+			continue
+		}
+		if reason := item.drift(opts.Verify); reason != "" {
+			changed = append(changed, UndoItem{
+				Index:   i,
+				Op:      item.Op,
+				Src:     item.Src,
+				Path:    item.undoPath(),
+				Outcome: UndoChanged,
+				Reason:  reason,
+			})
+		}
+	}
+	return changed
+}
+
+// Undo reverses the operations in the job, newest item first. Items
+// changed since the job are left alone unless opts.Force is set; entries
+// that took a restore target meanwhile go through ResolveConflict with
+// opts.Policy. The job is removed once every item is undone, otherwise
+// saved with the undone items marked so a later Undo retries the rest. A
+// job with nothing to undo is left alone.
+func (jm *JobManager) Undo(job *Job, opts UndoOptions) (*UndoResult, error) {
+	if opts.Policy == "" {
+		opts.Policy = PolicySkip
+	}
+	result := &UndoResult{JobID: job.ID}
+	remaining := 0
+
+	for i := len(job.Items) - 1; i >= 0; i-- {
+		item := &job.Items[i]
+		if !item.undoable() {
+			continue
+		}
+
+		res := UndoItem{Index: i, Op: item.Op, Src: item.Src, Path: item.undoPath()}
+		if reason := item.drift(opts.Verify); reason != "" && !opts.Force {
+			res.Outcome = UndoChanged
+			res.Reason = reason
+		} else if err := jm.undoItem(job.ID, i, item, opts.Policy, &res); err != nil {
+			res.Outcome = UndoFailed
+			res.Reason = err.Error()
+		}
+
+		if res.Outcome == UndoRestored {
+			item.Status = StatusUndone
+			item.Phase = ""
+			item.TempPath = ""
+		} else {
+			remaining++
+		}
+		result.Items = append(result.Items, res)
+	}
+
+	if len(result.Items) == 0 {
+		return result, nil // Nothing to undo; the record stays as it is
+	}
+	if remaining > 0 {
+		return result, jm.SaveJob(job)
+	}
+	return result, jm.DeleteJob(job.ID)
+}
+
+// LastUndoable returns the newest saved job that has something left to
+// undo and is neither active nor in skip, or nil if there is none.
+func (jm *JobManager) LastUndoable(skip map[string]struct{}) (*Job, error) {
+	sums, err := jm.Summaries()
+	if err != nil {
+		return nil, err
+	}
+	for _, sum := range sums {
+		if _, skipped := skip[sum.ID]; skipped || !sum.Undoable || jm.IsActive(sum.ID) {
+			continue
+		}
+		job, err := jm.loadJob(sum.ID)
+		if err != nil {
+			return nil, err
+		}
+		return job, nil
+	}
+	return nil, nil
+}
+
+// undoItem reverts one item and sets res.Outcome unless it fails.
+func (jm *JobManager) undoItem(jobID string, idx int, item *JobItem, policy ConflictPolicy, res *UndoItem) error {
+	res.Outcome = UndoRestored
+	failed := item.Status != StatusOK && !item.needsSettling()
+	switch {
+	case failed:
+		// Nothing of the item stayed, only its backup is left to restore
+	case item.Op == "copy" || item.Op == "archive":
+		// Delete created file/dir (the archive, for an archive job)
+		if item.CreatedPath != "" {
+			if err := fs.RemoveAll(item.CreatedPath); err != nil {
+				return err
+			}
+		}
+	case item.Op == "move" || item.Op == "delete":
+		// Move back from dst (or trash) to src
+		from := item.undoPath()
+		if from == "" {
+			break
+		}
+		to := item.Src
+		if item.needsSettling() {
+			// Src is missing or partial, nothing else can hold it
+			if err := UndoMove(item.Src, from, item.Phase, item.TempPath); err != nil {
+				return err
+			}
+			if item.Phase != PhasePlaced {
+				break // Only a staged copy was dropped
+			}
+		} else {
+			var err error
+			to, err = restore(from, item.Src, policy, jobID, idx, res)
+			if err != nil || to == "" {
+				return err
+			}
+		}
+		if err := renameTree(to, item.Renamed, false); err != nil {
+			return err
+		}
+	}
+
+	// Overwrite undo: put the replaced entry back where the new one was
+	if item.BackupPath != "" && item.Dst != "" {
+		if _, err := restore(item.BackupPath, item.Dst, policy, jobID, idx, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore moves from back to to. If something took to meanwhile, policy
+// decides: skip leaves from where it is (res.Outcome becomes UndoSkipped),
+// rename restores under a free name and overwrite sets the entry aside in
+// the job's trash first. It returns where from went, "" if skipped.
+func restore(from, to string, policy ConflictPolicy, jobID string, idx int, res *UndoItem) (string, error) {
+	target, err := ResolveConflict(from, to, policy)
+	if err != nil {
+		return "", err
+	}
+	if target == "" {
+		res.Outcome = UndoSkipped
+		res.Reason = fmt.Sprintf("'%s' is taken", to)
+		return "", nil
+	}
+
+	if _, err := fs.Lstat(target); err == nil {
+		// Overwrite: keep what took the name since the job
+		aside, err := TrashDir(jobID)
+		if err != nil {
+			return "", err
+		}
+		aside = filepath.Join(aside, "undo", strconv.Itoa(idx), filepath.Base(target))
+		if err := fs.MkdirAll(filepath.Dir(aside), 0755); err != nil {
+			return "", err
+		}
+		if err := Move(target, aside); err != nil {
+			return "", err
+		}
+		res.SetAside = aside
+		target = to
+	}
+
+	if err := fs.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+	if err := Move(from, target); err != nil {
+		return "", err
+	}
+	if target != to {
+		res.RestoredTo = target
+	}
+	return target, nil
+}
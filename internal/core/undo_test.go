@@ -0,0 +1,241 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// put runs a put of items into target and fails the test unless every
+// item succeeds.
+func put(t *testing.T, jm *JobManager, items []PutItem, opts PutOptions) *Job {
+	t.Helper()
+	job, err := jm.ExecutePut(items, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range job.Items {
+		if item.Status != StatusOK {
+			t.Fatalf("%s: %s (%s)", item.Src, item.Status, item.Error)
+		}
+	}
+	return job
+}
+
+// undo undoes job and returns the outcome of each item, newest first.
+func undo(t *testing.T, jm *JobManager, job *Job, opts UndoOptions) []UndoOutcome {
+	t.Helper()
+	result, err := jm.Undo(job, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcomes := make([]UndoOutcome, len(result.Items))
+	for i, item := range result.Items {
+		outcomes[i] = item.Outcome
+	}
+	return outcomes
+}
+
+func TestUndoCopy(t *testing.T) {
+	jm := newJobManager(t)
+	srcDir := mountMem(t, "src")
+	target := mountMem(t, "target")
+	tree := map[string]string{"f": "1", "d/": "", "d/g": "2"}
+	writeTree(t, srcDir, tree)
+	writeFile(t, filepath.Join(target, "other"), "kept")
+
+	job := put(t, jm, []PutItem{
+		{Src: filepath.Join(srcDir, "f"), Op: "copy"},
+		{Src: filepath.Join(srcDir, "d"), Op: "copy"},
+	}, PutOptions{TargetDir: target})
+
+	outcomes := undo(t, jm, job, UndoOptions{})
+	for _, outcome := range outcomes {
+		if outcome != UndoRestored {
+			t.Errorf("outcomes: got %v", outcomes)
+		}
+	}
+	assertTree(t, target, map[string]string{"other": "kept"})
+	assertTree(t, srcDir, tree)
+
+	// A fully undone job is deleted
+	if sums, _ := jm.Summaries(); len(sums) != 0 {
+		t.Errorf("%d jobs left", len(sums))
+	}
+}
+
+func TestUndoMove(t *testing.T) {
+	jm := newJobManager(t)
+	srcDir := mountMem(t, "src")
+	target := mountMem(t, "target")
+	tree := map[string]string{"f": "1", "d/": "", "d/g": "2"}
+	writeTree(t, srcDir, tree)
+
+	job := put(t, jm, []PutItem{
+		{Src: filepath.Join(srcDir, "f"), Op: "move"},
+		{Src: filepath.Join(srcDir, "d"), Op: "move"},
+	}, PutOptions{TargetDir: target})
+	undo(t, jm, job, UndoOptions{})
+
+	assertTree(t, srcDir, tree)
+	assertTree(t, target, map[string]string{})
+}
+
+func TestUndoOverwrite(t *testing.T) {
+	jm := newJobManager(t)
+	src := filepath.Join(mountMem(t, "src"), "f")
+	target := mountMem(t, "target")
+	writeFile(t, src, "new")
+	writeFile(t, filepath.Join(target, "f"), "old")
+
+	job := put(t, jm, []PutItem{{Src: src, Op: "copy"}}, PutOptions{TargetDir: target, Policy: PolicyOverwrite})
+	undo(t, jm, job, UndoOptions{})
+
+	assertTree(t, target, map[string]string{"f": "old"})
+}
+
+func TestUndoChanged(t *testing.T) {
+	jm := newJobManager(t)
+	src := filepath.Join(mountMem(t, "src"), "f")
+	target := mountMem(t, "target")
+	writeFile(t, src, "data")
+
+	job := put(t, jm, []PutItem{{Src: src, Op: "copy"}}, PutOptions{TargetDir: target})
+	dst := filepath.Join(target, "f")
+	writeFile(t, dst, "edited")
+	setModTime(t, dst, -time.Hour)
+
+	if changed := jm.CheckUndo(job, UndoOptions{}); len(changed) != 1 {
+		t.Fatalf("changed: got %d items, want 1", len(changed))
+	}
+	if outcomes := undo(t, jm, job, UndoOptions{}); outcomes[0] != UndoChanged {
+		t.Fatalf("outcome: got %s, want %s", outcomes[0], UndoChanged)
+	}
+	if !exists(dst) {
+		t.Fatal("changed item was undone")
+	}
+
+	// The job was kept, Force undoes the item
+	if outcomes := undo(t, jm, job, UndoOptions{Force: true}); outcomes[0] != UndoRestored {
+		t.Fatalf("forced outcome: got %s", outcomes[0])
+	}
+	if exists(dst) {
+		t.Error("forced undo left the item")
+	}
+}
+
+func TestUndoMoveTaken(t *testing.T) {
+	tests := []struct {
+		policy  ConflictPolicy
+		outcome UndoOutcome
+		want    map[string]string // Source directory afterwards
+	}{
+		{PolicySkip, UndoSkipped, map[string]string{"f": "other"}},
+		{PolicyRename, UndoRestored, map[string]string{"f": "other", "f (1)": "moved"}},
+		{PolicyOverwrite, UndoRestored, map[string]string{"f": "moved"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			jm := newJobManager(t)
+			srcDir := mountMem(t, "src")
+			target := mountMem(t, "target")
+			writeFile(t, filepath.Join(srcDir, "f"), "moved")
+
+			job := put(t, jm, []PutItem{{Src: filepath.Join(srcDir, "f"), Op: "move"}}, PutOptions{TargetDir: target})
+			writeFile(t, filepath.Join(srcDir, "f"), "other")
+
+			if outcomes := undo(t, jm, job, UndoOptions{Policy: tt.policy}); outcomes[0] != tt.outcome {
+				t.Fatalf("outcome: got %s, want %s", outcomes[0], tt.outcome)
+			}
+			assertTree(t, srcDir, tt.want)
+		})
+	}
+}
+
+func TestUndoDelete(t *testing.T) {
+	jm := newJobManager(t)
+	root := mountMem(t, "disk")
+	tree := map[string]string{"f": "1", "d/": "", "d/g": "2"}
+	writeTree(t, root, tree)
+
+	plan := PlanDelete([]string{filepath.Join(root, "f"), filepath.Join(root, "d")})
+	job, err := jm.ExecutePlan(plan, PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTree(t, root, map[string]string{})
+
+	undo(t, jm, job, UndoOptions{})
+	assertTree(t, root, tree)
+}
+
+func TestUndoDeleteSameName(t *testing.T) {
+	jm := newJobManager(t)
+	root := mountMem(t, "disk")
+	tree := map[string]string{"a/": "", "a/notes.txt": "a", "b/": "", "b/notes.txt": "b", "backup": "c"}
+	writeTree(t, root, tree)
+
+	plan := PlanDelete([]string{
+		filepath.Join(root, "a", "notes.txt"),
+		filepath.Join(root, "b", "notes.txt"),
+		filepath.Join(root, "backup"),
+	})
+	job, err := jm.ExecutePlan(plan, PutOptions{Parallelism: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, item := range job.Items {
+		if seen[item.TrashPath] {
+			t.Errorf("trash path used twice: %s", item.TrashPath)
+		}
+		seen[item.TrashPath] = true
+	}
+
+	undo(t, jm, job, UndoOptions{})
+	assertTree(t, root, tree)
+}
+
+func TestLastUndoable(t *testing.T) {
+	jm := newJobManager(t)
+	srcDir := mountMem(t, "src")
+	target := mountMem(t, "target")
+	writeFile(t, filepath.Join(srcDir, "f"), "1")
+	writeFile(t, filepath.Join(target, "f"), "taken")
+
+	copied := put(t, jm, []PutItem{{Src: filepath.Join(srcDir, "f"), Op: "copy"}}, PutOptions{TargetDir: target, Policy: PolicyRename})
+	skippedJob, err := jm.ExecutePut([]PutItem{{Src: filepath.Join(srcDir, "f"), Op: "copy"}}, PutOptions{TargetDir: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCreated(t, jm, skippedJob, time.Now().Add(time.Hour))
+
+	// The newer job skipped everything, so the one before it is picked
+	job, err := jm.LastUndoable(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != copied.ID {
+		t.Fatalf("got %v, want job %s", job, copied.ID)
+	}
+	if job, _ := jm.LastUndoable(map[string]struct{}{copied.ID: {}}); job != nil {
+		t.Errorf("skipped job picked: %s", job.ID)
+	}
+
+	// Undoing a job with nothing to undo keeps its record
+	if outcomes := undo(t, jm, skippedJob, UndoOptions{}); len(outcomes) != 0 {
+		t.Errorf("outcomes: got %v", outcomes)
+	}
+	if sums, _ := jm.Summaries(); len(sums) != 2 {
+		t.Errorf("%d jobs left, want 2", len(sums))
+	}
+}
+
+// setCreated moves the creation time of a saved job, which orders jobs.
+func setCreated(t *testing.T, jm *JobManager, job *Job, at time.Time) {
+	t.Helper()
+	job.CreatedAt = at
+	if err := jm.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	"lukechampine.com/blake3"
+
+	"lazycd/internal/fs"
+)
+
+type HashAlgo string
+
+const (
+	HashNone   HashAlgo = ""
+	HashXXH64  HashAlgo = "xxhash"
+	HashBLAKE3 HashAlgo = "blake3"
+	HashSHA256 HashAlgo = "sha256"
+)
+
+// HashAlgos lists the selectable verify modes in cycling order.
+var HashAlgos = []HashAlgo{HashNone, HashXXH64, HashBLAKE3, HashSHA256}
+
+// ErrChecksumMismatch is returned when a copy does not hash to its source.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Checksum holds the digests computed while verifying a transfer.
+type Checksum struct {
+	Algo HashAlgo
+	Src  string
+	Dst  string
+}
+
+func (a HashAlgo) String() string {
+	if a == HashNone {
+		return "off"
+	}
+	return string(a)
+}
+
+func newHasher(algo HashAlgo) (hash.Hash, error) {
+	switch algo {
+	case HashXXH64:
+		return xxhash.New(), nil
+	case HashBLAKE3:
+		return blake3.New(32, nil), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm: %s", algo)
+	}
+}
+
+// HashPath returns the hex digest of a file, symlink or directory tree.
+// Directories are hashed over their sorted entries (relative path, type and
+// content digest), so two trees with identical contents hash the same.
+func HashPath(path string, algo HashAlgo) (string, error) {
+	return hashPath(path, algo, nil)
+}
+
+// hashPath is HashPath with the entries below path renamed as in names
+// (see SanitizeTree), so a tree hashes like its sanitized copy.
+func hashPath(path string, algo HashAlgo, names map[string]string) (string, error) {
+	h, err := newHasher(algo)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := fs.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() {
+		if err := hashEntry(h, path, info.Mode()); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	fmt.Fprintf(h, "%s\x00%s\x00", ".", info.Mode().Type())
+	if err := hashDir(h, path, ".", ".", algo, names); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir writes the entries below dir into h in lexical order of their
+// (mapped) names without following symlinks. rel and newRel are the
+// original and mapped relative paths of dir.
+func hashDir(h hash.Hash, dir, rel, newRel string, algo HashAlgo, names map[string]string) error {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		d      os.DirEntry
+		rel    string
+		newRel string
+	}
+	mapped := make([]entry, len(entries))
+	for i, d := range entries {
+		childRel := path.Join(rel, d.Name())
+		mapped[i] = entry{d, childRel, path.Join(newRel, mapName(names, childRel))}
+	}
+	sort.Slice(mapped, func(i, j int) bool { return mapped[i].newRel < mapped[j].newRel })
+
+	for _, e := range mapped {
+		fmt.Fprintf(h, "%s\x00%s\x00", e.newRel, e.d.Type())
+		p := filepath.Join(dir, e.d.Name())
+		if e.d.IsDir() {
+			if err := hashDir(h, p, e.rel, e.newRel, algo, names); err != nil {
+				return err
+			}
+			continue
+		}
+		sum, err := HashPath(p, algo)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(h, sum+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashEntry writes the content of a single non-directory entry into h.
+func hashEntry(h hash.Hash, path string, mode os.FileMode) error {
+	if mode&os.ModeSymlink != 0 {
+		target, err := fs.Readlink(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(h, target)
+		return err
+	}
+
+	f, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// VerifyCopy hashes src and dst with algo and returns ErrChecksumMismatch
+// (together with both digests) if they differ.
+func VerifyCopy(src, dst string, algo HashAlgo) (*Checksum, error) {
+	return verifyCopy(src, dst, algo, nil)
+}
+
+// verifyCopy is VerifyCopy for a copy whose entries were renamed as in names.
+func verifyCopy(src, dst string, algo HashAlgo, names map[string]string) (*Checksum, error) {
+	srcSum, err := hashPath(src, algo, names)
+	if err != nil {
+		return nil, err
+	}
+	dstSum, err := HashPath(dst, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &Checksum{Algo: algo, Src: srcSum, Dst: dstSum}
+	if srcSum != dstSum {
+		return sum, fmt.Errorf("%w: %s (%s) != %s (%s)", ErrChecksumMismatch, src, srcSum, dst, dstSum)
+	}
+	return sum, nil
+}
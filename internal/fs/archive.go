@@ -0,0 +1,566 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveFormats maps the extensions of readable archives to their format.
+var archiveFormats = []struct{ ext, format string }{
+	{".zip", "zip"},
+	{".tar", "tar"},
+	{".tar.gz", "tar.gz"},
+	{".tgz", "tar.gz"},
+	{".tar.bz2", "tar.bz2"},
+	{".tbz2", "tar.bz2"},
+	{".tar.zst", "tar.zst"},
+	{".tzst", "tar.zst"},
+}
+
+// ArchiveFormat names the archive format of path by its extension, "" if
+// it is none that can be browsed.
+func ArchiveFormat(path string) string {
+	lower := strings.ToLower(path)
+	for _, f := range archiveFormats {
+		if strings.HasSuffix(lower, f.ext) {
+			return f.format
+		}
+	}
+	return ""
+}
+
+// IsArchive reports whether path is a local archive file that can be
+// entered like a directory.
+func IsArchive(path string) bool {
+	if ArchiveFormat(path) == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Archive is a zip or tar file as a read-only VFS. Its members are indexed
+// when it is opened; their contents are read from the file on Open.
+type Archive struct {
+	path    string
+	format  string
+	root    *archiveEntry
+	members []Member
+	added   int // Entries added so far, see nextOrder
+
+	mu     sync.Mutex
+	stream *tarStream  // Idle stream of a compressed tar, see openTarMember
+	idle   *time.Timer // Closes stream when no member follows soon
+}
+
+// tarStream is a compressed tar read up to the header of member seq.
+type tarStream struct {
+	closer io.Closer
+	tr     *tar.Reader
+	seq    int // -1 before the first header
+}
+
+// streamIdle is how long a compressed tar stays open after a member was
+// read, for the next one to continue from there.
+const streamIdle = 2 * time.Second
+
+// Member is an entry stored in an archive, in archive order.
+type Member struct {
+	Name  string // Slash-separated path in the archive
+	Size  int64
+	IsDir bool
+}
+
+type archiveEntry struct {
+	name     string // Base name
+	size     int64
+	mode     os.FileMode
+	modTime  time.Time
+	link     string // Symlink target
+	stored   string // Header name, to find the contents on Open
+	seq      int    // Position of the header in a tar, -1 if not stored
+	offset   int64  // Start of the contents in an uncompressed tar, -1 if unknown
+	order    int    // Position among the entries, for ReadDir
+	children map[string]*archiveEntry
+}
+
+// archiveCache keeps the index of recently opened archives, so browsing
+// one does not re-read it on every step. Entries are dropped when the
+// file changes.
+var archiveCache = struct {
+	sync.Mutex
+	archives map[string]cachedArchive
+}{archives: make(map[string]cachedArchive)}
+
+type cachedArchive struct {
+	size    int64
+	modTime time.Time
+	archive *Archive
+}
+
+// maxCachedArchives bounds the archive cache.
+const maxCachedArchives = 16
+
+// OpenArchive indexes the archive file at path.
+func OpenArchive(path string) (*Archive, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveCache.Lock()
+	cached, ok := archiveCache.archives[path]
+	archiveCache.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.archive, nil
+	}
+
+	a := &Archive{path: path, format: ArchiveFormat(path)}
+	a.root = &archiveEntry{name: ".", mode: os.ModeDir | 0755, modTime: info.ModTime(), seq: -1, offset: -1, children: make(map[string]*archiveEntry)}
+	if a.format == "zip" {
+		err = a.indexZip()
+	} else {
+		err = a.indexTar()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	archiveCache.Lock()
+	if len(archiveCache.archives) >= maxCachedArchives {
+		archiveCache.archives = make(map[string]cachedArchive)
+	}
+	archiveCache.archives[path] = cachedArchive{size: info.Size(), modTime: info.ModTime(), archive: a}
+	archiveCache.Unlock()
+	return a, nil
+}
+
+// Path returns the archive file.
+func (a *Archive) Path() string { return a.path }
+
+// Format returns the archive format, see ArchiveFormat.
+func (a *Archive) Format() string { return a.format }
+
+// Members lists the entries stored in the archive.
+func (a *Archive) Members() []Member { return a.members }
+
+func (a *Archive) indexZip() error {
+	r, err := zip.OpenReader(a.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		info := f.FileInfo()
+		e := &archiveEntry{size: info.Size(), mode: info.Mode(), modTime: info.ModTime(), stored: f.Name, seq: -1, offset: -1}
+		if e.mode&os.ModeSymlink != 0 {
+			// Zip stores the target as the contents
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			target, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			e.link = string(target)
+		}
+		a.add(f.Name, e)
+	}
+	return nil
+}
+
+func (a *Archive) indexTar() error {
+	f, tr, err := a.openTar()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// An uncompressed tar is read straight from the file, which is left
+	// at the contents of the member after its header
+	seeker, _ := f.(io.Seeker)
+	if a.format != "tar" {
+		seeker = nil
+	}
+
+	for seq := 0; ; seq++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := &archiveEntry{size: hdr.Size, mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime, stored: hdr.Name, seq: seq, offset: -1}
+		if seeker != nil && !isSparse(hdr) {
+			if e.offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeDir:
+		case tar.TypeSymlink:
+			e.link = hdr.Linkname
+		case tar.TypeLink:
+			// A hard link reads as the file it links to
+			target := a.lookup(cleanMember(hdr.Linkname))
+			if target == nil {
+				continue
+			}
+			e.size, e.mode, e.stored = target.size, target.mode, target.stored
+			e.seq, e.offset = target.seq, target.offset
+		default:
+			continue // Devices, FIFOs and the like are not extracted
+		}
+		a.add(hdr.Name, e)
+	}
+}
+
+// isSparse reports whether hdr is a GNU sparse file, whose contents are not
+// stored as one run of bytes.
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// openTar opens the archive file and returns a tar reader on its
+// decompressed contents. Closing the returned closer closes both.
+func (a *Archive) openTar() (io.Closer, *tar.Reader, error) {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var r io.Reader = f
+	switch a.format {
+	case "tar.gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		r = gz
+	case "tar.bz2":
+		r = bzip2.NewReader(f)
+	case "tar.zst":
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return readCloser{f, func() error { zr.Close(); return f.Close() }}, tar.NewReader(zr), nil
+	}
+	return f, tar.NewReader(r), nil
+}
+
+// cleanMember turns a stored name such as "./dir/file" or "dir/" into a
+// member name; "" is the root. Names cannot escape the archive root.
+func cleanMember(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// add inserts e under the stored name, creating parent directories that
+// are not stored themselves.
+func (a *Archive) add(stored string, e *archiveEntry) {
+	name := cleanMember(stored)
+	if name == "" {
+		return
+	}
+	parent := a.root
+	parts := strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		child := parent.children[part]
+		if child == nil || child.children == nil {
+			child = &archiveEntry{name: part, mode: os.ModeDir | 0755, modTime: a.root.modTime, seq: -1, offset: -1, order: a.nextOrder(), children: make(map[string]*archiveEntry)}
+			parent.children[part] = child
+		}
+		parent = child
+	}
+
+	e.name = parts[len(parts)-1]
+	e.order = a.nextOrder()
+	if e.mode.IsDir() {
+		if existing := parent.children[e.name]; existing != nil && existing.children != nil {
+			e.children = existing.children // Stored after its contents
+			e.order = existing.order
+		} else {
+			e.children = make(map[string]*archiveEntry)
+		}
+	}
+	parent.children[e.name] = e
+	a.members = append(a.members, Member{Name: name, Size: e.size, IsDir: e.mode.IsDir()})
+}
+
+// nextOrder numbers the entries as they are added.
+func (a *Archive) nextOrder() int {
+	a.added++
+	return a.added
+}
+
+// lookup finds the entry of a cleaned member name, nil if there is none.
+func (a *Archive) lookup(name string) *archiveEntry {
+	e := a.root
+	if name == "" || name == "." {
+		return e
+	}
+	for _, part := range strings.Split(name, "/") {
+		if e.children == nil {
+			return nil
+		}
+		if e = e.children[part]; e == nil {
+			return nil
+		}
+	}
+	return e
+}
+
+// entry finds the entry of name, following symlinks within the archive
+// if follow is set.
+func (a *Archive) entry(op, name string, follow bool) (*archiveEntry, error) {
+	name = cleanMember(name)
+	e := a.lookup(name)
+	for hops := 0; follow && e != nil && e.link != ""; hops++ {
+		if hops == 8 || path.IsAbs(e.link) {
+			e = nil
+			break
+		}
+		name = cleanMember(path.Join(path.Dir(name), e.link))
+		e = a.lookup(name)
+	}
+	if e == nil {
+		return nil, a.pathError(op, name, os.ErrNotExist)
+	}
+	return e, nil
+}
+
+func (a *Archive) pathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: filepath.Join(a.path, filepath.FromSlash(name)), Err: err}
+}
+
+func (a *Archive) Lstat(name string) (os.FileInfo, error) {
+	e, err := a.entry("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return archiveInfo{e}, nil
+}
+
+func (a *Archive) Stat(name string) (os.FileInfo, error) {
+	e, err := a.entry("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return archiveInfo{e}, nil
+}
+
+func (a *Archive) ReadDir(name string) ([]os.DirEntry, error) {
+	e, err := a.entry("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, a.pathError("readdir", name, fmt.Errorf("not a directory"))
+	}
+	// In archive order, so walking a tree reads a tar front to back
+	children := make([]*archiveEntry, 0, len(e.children))
+	for _, child := range e.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].order < children[j].order })
+	entries := make([]os.DirEntry, len(children))
+	for i, child := range children {
+		entries[i] = iofs.FileInfoToDirEntry(archiveInfo{child})
+	}
+	return entries, nil
+}
+
+func (a *Archive) Readlink(name string) (string, error) {
+	e, err := a.entry("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if e.link == "" {
+		return "", a.pathError("readlink", name, fmt.Errorf("not a symlink"))
+	}
+	return e.link, nil
+}
+
+// Open reads the contents of a file member. Members of an uncompressed tar
+// are read at their offset, those of a compressed tar by reading the
+// archive up to them (see openTarMember).
+func (a *Archive) Open(name string) (io.ReadCloser, error) {
+	e, err := a.entry("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsRegular() {
+		return nil, a.pathError("open", name, fmt.Errorf("not a regular file"))
+	}
+
+	if a.format == "zip" {
+		r, err := zip.OpenReader(a.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range r.File {
+			if f.Name == e.stored {
+				rc, err := f.Open()
+				if err != nil {
+					r.Close()
+					return nil, err
+				}
+				return readCloser{rc, func() error { rc.Close(); return r.Close() }}, nil
+			}
+		}
+		r.Close()
+		return nil, a.pathError("open", name, os.ErrNotExist)
+	}
+
+	if e.offset >= 0 {
+		f, err := os.Open(a.path)
+		if err != nil {
+			return nil, err
+		}
+		return readCloser{io.NewSectionReader(f, e.offset, e.size), f.Close}, nil
+	}
+	return a.openTarMember(name, e)
+}
+
+// openTarMember reads the archive up to e. The stream is kept for a moment
+// after the member is closed, so reading the following members (as a copy
+// of a directory does, see ReadDir) decompresses the archive only once.
+func (a *Archive) openTarMember(name string, e *archiveEntry) (io.ReadCloser, error) {
+	st := a.takeStream(e.seq)
+	if st == nil {
+		f, tr, err := a.openTar()
+		if err != nil {
+			return nil, err
+		}
+		st = &tarStream{closer: f, tr: tr, seq: -1}
+	}
+	for st.seq < e.seq {
+		hdr, err := st.tr.Next()
+		if err != nil {
+			st.closer.Close()
+			if err == io.EOF {
+				err = os.ErrNotExist
+			}
+			return nil, a.pathError("open", name, err)
+		}
+		st.seq++
+		if st.seq == e.seq && hdr.Name != e.stored {
+			st.closer.Close()
+			return nil, a.pathError("open", name, fmt.Errorf("archive changed"))
+		}
+	}
+	var once sync.Once
+	return readCloser{st.tr, func() error { once.Do(func() { a.putStream(st) }); return nil }}, nil
+}
+
+// takeStream returns the idle stream if it has not passed member seq yet.
+func (a *Archive) takeStream(seq int) *tarStream {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := a.stream
+	a.stream = nil
+	if st != nil && st.seq >= seq {
+		st.closer.Close()
+		return nil
+	}
+	return st
+}
+
+// putStream keeps st as the idle stream until streamIdle passes.
+func (a *Archive) putStream(st *tarStream) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stream != nil {
+		a.stream.closer.Close()
+	}
+	a.stream = st
+	if a.idle != nil {
+		a.idle.Stop()
+	}
+	a.idle = time.AfterFunc(streamIdle, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.stream == st {
+			a.stream = nil
+			st.closer.Close()
+		}
+	})
+}
+
+// Archives are read-only; the writing methods fail with ErrReadOnly.
+
+func (a *Archive) Create(name string, perm os.FileMode, excl bool) (io.WriteCloser, error) {
+	return nil, a.pathError("create", name, ErrReadOnly)
+}
+
+func (a *Archive) Mkdir(name string, perm os.FileMode) error {
+	return a.pathError("mkdir", name, ErrReadOnly)
+}
+
+func (a *Archive) MkdirAll(name string, perm os.FileMode) error {
+	return a.pathError("mkdir", name, ErrReadOnly)
+}
+
+func (a *Archive) Rename(oldname, newname string) error {
+	return a.pathError("rename", oldname, ErrReadOnly)
+}
+
+func (a *Archive) Remove(name string) error {
+	return a.pathError("remove", name, ErrReadOnly)
+}
+
+func (a *Archive) RemoveAll(name string) error {
+	return a.pathError("remove", name, ErrReadOnly)
+}
+
+func (a *Archive) Symlink(target, name string) error {
+	return a.pathError("symlink", name, ErrReadOnly)
+}
+
+func (a *Archive) Chtimes(name string, atime, mtime time.Time) error {
+	return a.pathError("chtimes", name, ErrReadOnly)
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc readCloser) Close() error { return rc.close() }
+
+// archiveInfo is the os.FileInfo of an archive member.
+type archiveInfo struct{ e *archiveEntry }
+
+func (i archiveInfo) Name() string       { return i.e.name }
+func (i archiveInfo) Size() int64        { return i.e.size }
+func (i archiveInfo) Mode() os.FileMode  { return i.e.mode }
+func (i archiveInfo) ModTime() time.Time { return i.e.modTime }
+func (i archiveInfo) IsDir() bool        { return i.e.mode.IsDir() }
+func (i archiveInfo) Sys() any           { return nil }
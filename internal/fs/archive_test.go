@@ -0,0 +1,156 @@
+package fs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeTar writes members (name -> contents, "/" suffix for directories)
+// in the given order to a tar file at path, gzipped for .tar.gz.
+func writeTar(t *testing.T, path string, names []string, members map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if strings.HasSuffix(path, ".gz") {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(members[name])), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, "/") {
+			hdr.Mode, hdr.Typeflag = 0755, tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, members[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testTar returns member names in archive order, in nested directories
+// and with a name too long for the plain tar header.
+func testTar() ([]string, map[string]string) {
+	names := []string{"d/"}
+	members := map[string]string{"d/": ""}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("d/%c/f%d", 'z'-i%3, i)
+		if i == 7 {
+			name = "d/" + strings.Repeat("long", 40)
+		}
+		names = append(names, name)
+		members[name] = strings.Repeat(fmt.Sprint(i), 1000+i)
+	}
+	return names, members
+}
+
+func readMember(t *testing.T, a *Archive, name string) string {
+	t.Helper()
+	r, err := a.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestArchiveTarOpen(t *testing.T) {
+	for _, ext := range []string{".tar", ".tar.gz"} {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a"+ext)
+			names, members := testTar()
+			writeTar(t, path, names, members)
+			a, err := OpenArchive(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Front to back, back to front and concurrently
+			for _, name := range names[1:] {
+				if got := readMember(t, a, name); got != members[name] {
+					t.Errorf("%s: got %d bytes, want %d", name, len(got), len(members[name]))
+				}
+			}
+			for i := len(names) - 1; i > 0; i-- {
+				if got := readMember(t, a, names[i]); got != members[names[i]] {
+					t.Errorf("%s: contents differ", names[i])
+				}
+			}
+			var wg sync.WaitGroup
+			for _, name := range names[1:] {
+				wg.Add(1)
+				go func(name string) {
+					defer wg.Done()
+					r, err := a.Open(name)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					defer r.Close()
+					if data, _ := io.ReadAll(r); string(data) != members[name] {
+						t.Errorf("%s: contents differ", name)
+					}
+				}(name)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestArchiveReadDirOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.tar")
+	names := []string{"c", "a/", "a/z", "a/b", "b"}
+	writeTar(t, path, names, map[string]string{"c": "c", "a/z": "z", "a/b": "b", "b": "b"})
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = walkArchive(a, "", func(name string) { got = append(got, name) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "c a a/z a/b b"
+	if strings.Join(got, " ") != want {
+		t.Errorf("walk: got %v, want %s", got, want)
+	}
+}
+
+// walkArchive calls fn for every entry below dir, depth first in ReadDir
+// order.
+func walkArchive(a *Archive, dir string, fn func(name string)) error {
+	entries, err := a.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := strings.TrimPrefix(dir+"/"+entry.Name(), "/")
+		fn(name)
+		if entry.IsDir() {
+			if err := walkArchive(a, name, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+package fs
+
+// S3PartSize exposes the part size of multipart uploads to the tests of
+// package fs_test, which cannot import s3test from package fs.
+const S3PartSize = s3PartSize
@@ -1,7 +1,6 @@
 package fs
 
 import (
-	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -15,6 +14,7 @@ type FileItem struct {
 	Name      string
 	Path      string
 	IsDir     bool
+	Archive   bool // Archive file that can be entered like a directory
 	Size      int64
 	Mode      os.FileMode
 	ModTime   time.Time
@@ -22,23 +22,30 @@ type FileItem struct {
 
 // ListDir returns a sorted list of files in the directory.
 // Directories come first, then files. Both are sorted alphabetically.
+// An archive file, or a directory inside one, lists the archive members.
 func ListDir(path string) ([]FileItem, error) {
 	resolvedPath, err := ResolvePath(path)
 	if err != nil {
 		return nil, err
 	}
 
-	files, err := ioutil.ReadDir(resolvedPath)
+	vfs, name := ResolveDir(resolvedPath)
+	entries, err := vfs.ReadDir(name)
 	if err != nil {
 		return nil, err
 	}
 
 	var items []FileItem
-	for _, f := range files {
+	for _, entry := range entries {
+		f, err := entry.Info()
+		if err != nil {
+			continue // Removed since listing
+		}
 		items = append(items, FileItem{
 			Name:    f.Name(),
 			Path:    filepath.Join(resolvedPath, f.Name()),
 			IsDir:   f.IsDir(),
+			Archive: vfs == Local && f.Mode().IsRegular() && ArchiveFormat(f.Name()) != "",
 			Size:    f.Size(),
 			Mode:    f.Mode(),
 			ModTime: f.ModTime(),
@@ -56,7 +63,15 @@ func ListDir(path string) ([]FileItem, error) {
 }
 
 // ResolvePath expands ~ to the user's home directory and returns the absolute path.
+// Remote paths are made absolute on their server, see resolveRemote, and
+// S3 paths are cleaned.
 func ResolvePath(path string) (string, error) {
+	if IsRemote(path) {
+		return resolveRemote(path)
+	}
+	if IsS3(path) {
+		return resolveS3(path), nil
+	}
 	if path == "~" {
 		usr, err := user.Current()
 		if err != nil {
@@ -0,0 +1,420 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is a filesystem held in memory. Mounted with Mount it stands in
+// for the local disk in tests: fs and core functions on paths below the
+// mount point read and write it instead. It is safe for concurrent use.
+type MemFS struct {
+	mu   sync.Mutex
+	root *memNode
+}
+
+type memNode struct {
+	mode     os.FileMode
+	modTime  time.Time
+	data     []byte
+	link     string              // Symlink target
+	children map[string]*memNode // Directories only
+}
+
+// maxMemLinks bounds the symlinks followed while resolving one name.
+const maxMemLinks = 8
+
+var (
+	errNotDir   = errors.New("not a directory")
+	errIsDir    = errors.New("is a directory")
+	errNotLink  = errors.New("not a symlink")
+	errInvalid  = errors.New("invalid argument")
+	errLoop     = errors.New("too many levels of symbolic links")
+	errNotEmpty = memError{"directory not empty", os.ErrExist}
+)
+
+// memError is an error message that also matches a generic os error,
+// like the syscall errors of the local disk.
+type memError struct {
+	msg string
+	is  error
+}
+
+func (e memError) Error() string { return e.msg }
+func (e memError) Unwrap() error { return e.is }
+
+// NewMemFS returns an empty in-memory filesystem.
+func NewMemFS() *MemFS {
+	return &MemFS{root: newMemDir(0755)}
+}
+
+func newMemDir(perm os.FileMode) *memNode {
+	return &memNode{mode: os.ModeDir | perm.Perm(), modTime: time.Now(), children: make(map[string]*memNode)}
+}
+
+// cleanName splits a name into its slash-separated parts; the root has
+// none. Names cannot escape the root.
+func cleanName(name string) []string {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// lookup finds the node of parts. Symlinks on the way are followed, the
+// last one only if follow is set. Absolute symlink targets start at the
+// root of the filesystem.
+func (m *MemFS) lookup(parts []string, follow bool) (*memNode, error) {
+	n := m.root
+	var dir []string // Resolved parts of n
+	hops := 0
+	for i := 0; i < len(parts); i++ {
+		if n.children == nil {
+			return nil, errNotDir
+		}
+		child := n.children[parts[i]]
+		if child == nil {
+			return nil, os.ErrNotExist
+		}
+		if child.link != "" && (follow || i < len(parts)-1) {
+			if hops++; hops > maxMemLinks {
+				return nil, errLoop
+			}
+			target := child.link
+			if !path.IsAbs(target) {
+				target = path.Join(strings.Join(dir, "/"), target)
+			}
+			parts = append(cleanName(target), parts[i+1:]...)
+			n, dir, i = m.root, nil, -1
+			continue
+		}
+		n = child
+		dir = append(dir, parts[i])
+	}
+	return n, nil
+}
+
+// parent finds the directory that holds name and the base name in it.
+func (m *MemFS) parent(name string) (*memNode, string, error) {
+	parts := cleanName(name)
+	if len(parts) == 0 {
+		return nil, "", errInvalid // The root has no parent
+	}
+	dir, err := m.lookup(parts[:len(parts)-1], true)
+	if err != nil {
+		return nil, "", err
+	}
+	if dir.children == nil {
+		return nil, "", errNotDir
+	}
+	return dir, parts[len(parts)-1], nil
+}
+
+func memPathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+func (m *MemFS) stat(op, name string, follow bool) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup(cleanName(name), follow)
+	if err != nil {
+		return nil, memPathError(op, name, err)
+	}
+	base := "."
+	if parts := cleanName(name); len(parts) > 0 {
+		base = parts[len(parts)-1]
+	}
+	return n.info(base), nil
+}
+
+func (m *MemFS) Lstat(name string) (os.FileInfo, error) { return m.stat("lstat", name, false) }
+func (m *MemFS) Stat(name string) (os.FileInfo, error)  { return m.stat("stat", name, true) }
+
+func (m *MemFS) ReadDir(name string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup(cleanName(name), true)
+	if err != nil {
+		return nil, memPathError("readdir", name, err)
+	}
+	if n.children == nil {
+		return nil, memPathError("readdir", name, errNotDir)
+	}
+	entries := make([]os.DirEntry, 0, len(n.children))
+	for childName, child := range n.children {
+		entries = append(entries, iofs.FileInfoToDirEntry(child.info(childName)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Open returns a reader on the contents name has at the time of the call.
+func (m *MemFS) Open(name string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup(cleanName(name), true)
+	if err != nil {
+		return nil, memPathError("open", name, err)
+	}
+	if n.children != nil {
+		return nil, memPathError("open", name, errIsDir)
+	}
+	return io.NopCloser(bytes.NewReader(bytes.Clone(n.data))), nil
+}
+
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup(cleanName(name), false)
+	if err != nil {
+		return "", memPathError("readlink", name, err)
+	}
+	if n.link == "" {
+		return "", memPathError("readlink", name, errNotLink)
+	}
+	return n.link, nil
+}
+
+func (m *MemFS) Create(name string, perm os.FileMode, excl bool) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parts := cleanName(name)
+	if _, err := m.lookup(parts, false); err == nil && excl {
+		return nil, memPathError("open", name, os.ErrExist)
+	}
+	n, err := m.lookup(parts, true)
+	switch {
+	case err == nil:
+		if n.children != nil {
+			return nil, memPathError("open", name, errIsDir)
+		}
+		n.data = nil
+		n.modTime = time.Now()
+	case errors.Is(err, os.ErrNotExist):
+		dir, base, err := m.parent(name)
+		if err != nil {
+			return nil, memPathError("open", name, err)
+		}
+		n = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		dir.children[base] = n
+		dir.modTime = n.modTime
+	default:
+		return nil, memPathError("open", name, err)
+	}
+	return &memWriter{m: m, n: n}, nil
+}
+
+func (m *MemFS) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdir(name, perm)
+}
+
+func (m *MemFS) mkdir(name string, perm os.FileMode) error {
+	dir, base, err := m.parent(name)
+	if err != nil {
+		if len(cleanName(name)) == 0 {
+			err = os.ErrExist
+		}
+		return memPathError("mkdir", name, err)
+	}
+	if dir.children[base] != nil {
+		return memPathError("mkdir", name, os.ErrExist)
+	}
+	n := newMemDir(perm)
+	dir.children[base] = n
+	dir.modTime = n.modTime
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parts := cleanName(name)
+	for i := 1; i <= len(parts); i++ {
+		n, err := m.lookup(parts[:i], true)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			if err := m.mkdir(strings.Join(parts[:i], "/"), perm); err != nil {
+				return err
+			}
+		case err != nil:
+			return memPathError("mkdir", name, err)
+		case n.children == nil:
+			return memPathError("mkdir", name, errNotDir)
+		}
+	}
+	return nil
+}
+
+// Rename replaces a file at newname, or an empty directory if oldname is
+// a directory too.
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fail := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	oldDir, oldBase, err := m.parent(oldname)
+	if err != nil {
+		return fail(err)
+	}
+	n := oldDir.children[oldBase]
+	if n == nil {
+		return fail(os.ErrNotExist)
+	}
+	newDir, newBase, err := m.parent(newname)
+	if err != nil {
+		return fail(err)
+	}
+	existing := newDir.children[newBase]
+	if existing == n {
+		return nil
+	}
+	if n.children != nil && n.contains(newDir) {
+		return fail(errInvalid) // Into itself
+	}
+	if existing != nil {
+		switch {
+		case existing.children != nil && n.children == nil:
+			return fail(errIsDir)
+		case existing.children == nil && n.children != nil:
+			return fail(errNotDir)
+		case len(existing.children) > 0:
+			return fail(errNotEmpty)
+		}
+	}
+
+	delete(oldDir.children, oldBase)
+	newDir.children[newBase] = n
+	oldDir.modTime, newDir.modTime = time.Now(), time.Now()
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, err := m.parent(name)
+	if err != nil {
+		return memPathError("remove", name, err)
+	}
+	n := dir.children[base]
+	switch {
+	case n == nil:
+		return memPathError("remove", name, os.ErrNotExist)
+	case len(n.children) > 0:
+		return memPathError("remove", name, errNotEmpty)
+	}
+	delete(dir.children, base)
+	dir.modTime = time.Now()
+	return nil
+}
+
+// RemoveAll removes name and everything below it. A missing name is not
+// an error.
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, err := m.parent(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return memPathError("remove", name, err)
+	}
+	if dir.children[base] != nil {
+		delete(dir.children, base)
+		dir.modTime = time.Now()
+	}
+	return nil
+}
+
+func (m *MemFS) Symlink(target, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, err := m.parent(name)
+	if err != nil {
+		return memPathError("symlink", name, err)
+	}
+	if dir.children[base] != nil {
+		return memPathError("symlink", name, os.ErrExist)
+	}
+	dir.children[base] = &memNode{mode: os.ModeSymlink | 0777, modTime: time.Now(), link: target}
+	dir.modTime = time.Now()
+	return nil
+}
+
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup(cleanName(name), true)
+	if err != nil {
+		return memPathError("chtimes", name, err)
+	}
+	n.modTime = mtime
+	return nil
+}
+
+// contains reports whether d is n or below it.
+func (n *memNode) contains(d *memNode) bool {
+	if n == d {
+		return true
+	}
+	for _, child := range n.children {
+		if child.children != nil && child.contains(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// info returns a snapshot of the node's metadata under name.
+func (n *memNode) info(name string) os.FileInfo {
+	size := int64(len(n.data))
+	if n.link != "" {
+		size = int64(len(n.link))
+	}
+	return memInfo{name: name, size: size, mode: n.mode, modTime: n.modTime}
+}
+
+// memWriter appends to a file created by MemFS.Create.
+type memWriter struct {
+	m *MemFS
+	n *memNode
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+	w.n.data = append(w.n.data, p...)
+	w.n.modTime = time.Now()
+	return len(p), nil
+}
+
+func (w *memWriter) Close() error { return nil }
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() os.FileMode  { return i.mode }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
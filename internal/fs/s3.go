@@ -0,0 +1,954 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Root is the mount point of object storage. Paths to it look like
+// s3:/bucket/prefix; buckets are the directories of its root.
+const s3Root = "s3:"
+
+// IsS3 reports whether path names an object in S3-compatible storage.
+// s3://bucket/key is accepted as well and made s3:/bucket/key by
+// ResolvePath.
+func IsS3(p string) bool {
+	return p == s3Root || strings.HasPrefix(p, s3Root+"/")
+}
+
+// resolveS3 returns the clean form of an S3 path, s3:/ for the root.
+func resolveS3(p string) string {
+	return s3Root + path.Clean("/"+strings.TrimPrefix(p, s3Root))
+}
+
+// S3Options locates an S3-compatible service and the credentials for it.
+type S3Options struct {
+	Endpoint     string // Base URL, such as http://localhost:9000 for MinIO
+	Region       string
+	AccessKey    string // Requests are sent unsigned without one
+	SecretKey    string
+	SessionToken string
+}
+
+// S3Config returns the options for object storage. The default reads
+// the usual AWS environment variables (AWS_ENDPOINT_URL, AWS_REGION,
+// AWS_ACCESS_KEY_ID, ...); tests replace it to reach an in-process
+// server.
+var S3Config = defaultS3Config
+
+func defaultS3Config() (S3Options, error) {
+	opts := S3Options{
+		Endpoint:     firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		Region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	if opts.AccessKey != "" && opts.SecretKey == "" {
+		return opts, errors.New("AWS_SECRET_ACCESS_KEY is not set")
+	}
+	return opts, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// S3 is the buckets of an S3-compatible service as a VFS. Directories are
+// the key prefixes up to a "/"; Mkdir stores an empty "dir/" object so
+// empty directories persist. Objects cannot be symlinks, and keep their
+// upload time as modification time.
+type S3 struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+}
+
+const (
+	// s3PartSize is the size of the parts of a multipart upload. It
+	// doubles every 1000 parts to stay within the 10000 parts allowed.
+	s3PartSize = 8 << 20
+	// s3CopyPart is the size of the parts copying large objects.
+	s3CopyPart = 512 << 20
+)
+
+// s3CopyLimit is the largest object copied in one request.
+var s3CopyLimit int64 = 5 << 30
+
+// NewS3 returns the storage of the service opts point to. Buckets are
+// addressed in the path (http://endpoint/bucket/key), which both AWS and
+// MinIO accept.
+func NewS3(opts S3Options) (*S3, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", opts.Endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Minute
+	return &S3{opts: opts, endpoint: u, client: &http.Client{Transport: transport}}, nil
+}
+
+// objectStore returns the S3 filesystem, mounting it on first use.
+func objectStore() VFS {
+	remotes.Lock()
+	defer remotes.Unlock()
+	if vfs, _, ok := mounted(s3Root); ok {
+		return vfs
+	}
+	opts, err := S3Config()
+	if err == nil {
+		var s *S3
+		if s, err = NewS3(opts); err == nil {
+			Mount(s3Root, s)
+			return s
+		}
+	}
+	return brokenFS{fmt.Errorf("s3: %w", err)}
+}
+
+// s3Error is an error response of the service.
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Status  int      `xml:"-"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s (HTTP %d)", e.Code, e.Status)
+	}
+	return e.Code + ": " + e.Message
+}
+
+// kind returns the os error e stands for, nil if none does.
+func (e *s3Error) kind() error {
+	switch {
+	case e.Status == http.StatusNotFound, e.Code == "NoSuchKey", e.Code == "NoSuchBucket":
+		return os.ErrNotExist
+	case e.Status == http.StatusForbidden:
+		return os.ErrPermission
+	case e.Status == http.StatusPreconditionFailed:
+		return os.ErrExist
+	}
+	return nil
+}
+
+func (e *s3Error) Unwrap() error { return e.kind() }
+
+// pathError reports err for name by its s3:/ path. Errors meaning a
+// missing, existing or forbidden object become the os errors, so
+// os.IsNotExist and the like work on them.
+func (s *S3) pathError(op, name string, err error) error {
+	var se *s3Error
+	if errors.As(err, &se) && se.kind() != nil {
+		err = se.kind()
+	}
+	return &os.PathError{Op: op, Path: s.path(name), Err: err}
+}
+
+func (s *S3) path(name string) string {
+	return s3Root + "/" + strings.Join(cleanName(name), "/")
+}
+
+// s3Split returns the bucket and key of name. The key is "" for a bucket,
+// both are for the root.
+func s3Split(name string) (bucket, key string) {
+	parts := cleanName(name)
+	if len(parts) == 0 {
+		return "", ""
+	}
+	return parts[0], strings.Join(parts[1:], "/")
+}
+
+// s3Escape encodes s as SigV4 requires: everything but unreserved
+// characters is percent-encoded, and "/" too unless keepSlash.
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// do sends a request for the object key in bucket (or the bucket, or the
+// service) and returns the response of a successful one. Error responses
+// are returned as *s3Error.
+func (s *S3) do(method, bucket, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	p := s.endpoint.Path + "/"
+	if bucket != "" {
+		p += bucket + "/" + key
+	}
+	u := *s.endpoint
+	u.Path, u.RawPath = p, s3Escape(p, true)
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var q []string
+	for _, k := range keys {
+		q = append(q, s3Escape(k, false)+"="+s3Escape(query.Get(k), false))
+	}
+	u.RawQuery = strings.Join(q, "&")
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.ContentLength = http.NoBody, 0
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		e := &s3Error{Status: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		if xml.Unmarshal(data, e) != nil || e.Code == "" {
+			e.Code = http.StatusText(resp.StatusCode)
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+// doXML sends a request and decodes the XML response into v. Some
+// requests, such as copies, fail with an error document in a 200
+// response.
+func (s *S3) doXML(method, bucket, key string, query url.Values, header http.Header, body []byte, v any) error {
+	resp, err := s.do(method, bucket, key, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if e := (&s3Error{Status: resp.StatusCode}); xml.Unmarshal(data, e) == nil && e.Code != "" {
+		return e
+	}
+	if v == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// discard sends a request whose response has no interesting body.
+func (s *S3) discard(method, bucket, key string, query url.Values, header http.Header, body []byte) (http.Header, error) {
+	resp, err := s.do(method, bucket, key, query, header, body)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.Header, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req, signing the host
+// and every header set so far.
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.opts.SessionToken)
+	}
+	if s.opts.AccessKey == "" {
+		return
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), req.URL.RawQuery,
+		canonHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := amzDate[:8] + "/" + s.opts.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + s.opts.SecretKey)
+	for _, part := range []string{amzDate[:8], s.opts.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Object is an object or common prefix of a listing.
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type s3Listing struct {
+	Contents       []s3Object `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list calls fn with each page of the objects below prefix, grouped by
+// "/" if delimit is set, until fn returns false. max limits the keys of
+// a page, 0 leaves it to the service.
+func (s *S3) list(bucket, prefix string, delimit bool, max int, fn func(*s3Listing) bool) error {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if delimit {
+		query.Set("delimiter", "/")
+	}
+	if max > 0 {
+		query.Set("max-keys", strconv.Itoa(max))
+	}
+	for {
+		var page s3Listing
+		if err := s.doXML("GET", bucket, "", query, nil, nil, &page); err != nil {
+			return err
+		}
+		if !fn(&page) || !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// keys returns every object below prefix.
+func (s *S3) keys(bucket, prefix string) ([]s3Object, error) {
+	var objects []s3Object
+	err := s.list(bucket, prefix, false, 0, func(page *s3Listing) bool {
+		objects = append(objects, page.Contents...)
+		return true
+	})
+	return objects, err
+}
+
+// head returns the size and modification time of an object.
+func (s *S3) head(bucket, key string) (os.FileInfo, error) {
+	header, err := s.discard("HEAD", bucket, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	size, _ := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	mtime, _ := http.ParseTime(header.Get("Last-Modified"))
+	return s3Info{name: path.Base(key), size: size, modTime: mtime}, nil
+}
+
+// dirInfo finds the directory key: its "key/" marker, or any object
+// below it. ok is false if there is neither.
+func (s *S3) dirInfo(bucket, key string) (info os.FileInfo, ok bool, err error) {
+	var first *s3Object
+	err = s.list(bucket, key+"/", false, 1, func(page *s3Listing) bool {
+		if len(page.Contents) > 0 {
+			first = &page.Contents[0]
+		}
+		return false
+	})
+	if err != nil || first == nil {
+		return nil, false, err
+	}
+	dir := s3Info{name: path.Base(key), dir: true}
+	if first.Key == key+"/" {
+		dir.modTime = first.LastModified.Truncate(time.Second)
+	}
+	return dir, true, nil
+}
+
+func (s *S3) Stat(name string) (os.FileInfo, error) {
+	bucket, key := s3Split(name)
+	switch {
+	case bucket == "":
+		return s3Info{name: ".", dir: true}, nil
+	case key == "":
+		if _, err := s.discard("HEAD", bucket, "", nil, nil, nil); err != nil {
+			return nil, s.pathError("stat", name, err)
+		}
+		return s3Info{name: bucket, dir: true}, nil
+	}
+	info, err := s.head(bucket, key)
+	if err == nil {
+		return info, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, s.pathError("stat", name, err)
+	}
+	info, ok, err := s.dirInfo(bucket, key)
+	switch {
+	case err != nil:
+		return nil, s.pathError("stat", name, err)
+	case !ok:
+		return nil, s.pathError("stat", name, os.ErrNotExist)
+	}
+	return info, nil
+}
+
+func (s *S3) Lstat(name string) (os.FileInfo, error) { return s.Stat(name) }
+
+type s3Buckets struct {
+	Buckets []struct {
+		Name         string    `xml:"Name"`
+		CreationDate time.Time `xml:"CreationDate"`
+	} `xml:"Buckets>Bucket"`
+}
+
+// ReadDir lists the buckets at the root, the objects and prefixes of a
+// prefix elsewhere. An object and a prefix of the same name show as the
+// object.
+func (s *S3) ReadDir(name string) ([]os.DirEntry, error) {
+	bucket, key := s3Split(name)
+	var entries []os.DirEntry
+	if bucket == "" {
+		var result s3Buckets
+		if err := s.doXML("GET", "", "", nil, nil, nil, &result); err != nil {
+			return nil, s.pathError("readdir", name, err)
+		}
+		for _, b := range result.Buckets {
+			entries = append(entries, iofs.FileInfoToDirEntry(s3Info{name: b.Name, dir: true, modTime: b.CreationDate}))
+		}
+		return entries, nil
+	}
+
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+	files := make(map[string]bool)
+	var dirs []string
+	marker := false
+	err := s.list(bucket, prefix, true, 0, func(page *s3Listing) bool {
+		for _, obj := range page.Contents {
+			base := strings.TrimPrefix(obj.Key, prefix)
+			if base == "" {
+				marker = true
+				continue
+			}
+			files[base] = true
+			entries = append(entries, iofs.FileInfoToDirEntry(s3Info{name: base, size: obj.Size, modTime: obj.LastModified.Truncate(time.Second)}))
+		}
+		for _, p := range page.CommonPrefixes {
+			if base := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/"); base != "" {
+				dirs = append(dirs, base)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, s.pathError("readdir", name, err)
+	}
+	for _, dir := range dirs {
+		if !files[dir] {
+			entries = append(entries, iofs.FileInfoToDirEntry(s3Info{name: dir, dir: true}))
+		}
+	}
+
+	if len(entries) == 0 && !marker && key != "" {
+		err := error(os.ErrNotExist)
+		if _, headErr := s.head(bucket, key); headErr == nil {
+			err = errNotDir
+		}
+		return nil, s.pathError("readdir", name, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *S3) Open(name string) (io.ReadCloser, error) {
+	bucket, key := s3Split(name)
+	if key == "" {
+		return nil, s.pathError("open", name, errIsDir)
+	}
+	resp, err := s.do("GET", bucket, key, nil, nil, nil)
+	if err != nil {
+		return nil, s.pathError("open", name, err)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Readlink(name string) (string, error) {
+	return "", s.pathError("readlink", name, errNotLink)
+}
+
+// Create returns a writer that uploads name when closed, in parts as
+// they fill up if it grows beyond one. With excl set the upload fails if
+// name was created meanwhile, where the service supports that. The perm
+// is ignored.
+func (s *S3) Create(name string, perm os.FileMode, excl bool) (io.WriteCloser, error) {
+	bucket, key := s3Split(name)
+	if key == "" {
+		return nil, s.pathError("open", name, errIsDir)
+	}
+	if excl {
+		if _, err := s.Stat(name); err == nil {
+			return nil, s.pathError("open", name, os.ErrExist)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return &s3Writer{s: s, name: name, bucket: bucket, key: key, excl: excl}, nil
+}
+
+// putMarker stores the empty object that keeps the directory key.
+func (s *S3) putMarker(bucket, key string) error {
+	_, err := s.discard("PUT", bucket, key+"/", nil, nil, []byte{})
+	return err
+}
+
+// Mkdir creates a directory marker. Buckets are not created.
+func (s *S3) Mkdir(name string, perm os.FileMode) error {
+	bucket, key := s3Split(name)
+	if _, err := s.Stat(name); err == nil {
+		return s.pathError("mkdir", name, os.ErrExist)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if key == "" {
+		return s.pathError("mkdir", name, os.ErrPermission)
+	}
+	if err := s.putMarker(bucket, key); err != nil {
+		return s.pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// MkdirAll creates a marker for name; the directories above it exist
+// through the marker's key.
+func (s *S3) MkdirAll(name string, perm os.FileMode) error {
+	bucket, key := s3Split(name)
+	info, err := s.Stat(name)
+	switch {
+	case err == nil && info.IsDir():
+		return nil
+	case err == nil:
+		return s.pathError("mkdir", name, errNotDir)
+	case !os.IsNotExist(err):
+		return err
+	case key == "":
+		return s.pathError("mkdir", name, os.ErrPermission)
+	}
+	if _, err := s.Stat(bucket); err != nil {
+		return s.pathError("mkdir", name, os.ErrNotExist)
+	}
+	if err := s.putMarker(bucket, key); err != nil {
+		return s.pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// copyObject copies an object of size bytes on the service, in parts if
+// it is too large for one request.
+func (s *S3) copyObject(srcBucket, srcKey string, size int64, dstBucket, dstKey string) error {
+	source := http.Header{"X-Amz-Copy-Source": {s3Escape("/"+srcBucket+"/"+srcKey, true)}}
+	if size <= s3CopyLimit {
+		return s.doXML("PUT", dstBucket, dstKey, nil, source, nil, nil)
+	}
+
+	u, err := s.startUpload(dstBucket, dstKey)
+	if err != nil {
+		return err
+	}
+	for off := int64(0); off < size; off += s3CopyPart {
+		end := min(off+s3CopyPart, size) - 1
+		header := source.Clone()
+		header.Set("X-Amz-Copy-Source-Range", fmt.Sprintf("bytes=%d-%d", off, end))
+		var result struct {
+			ETag string `xml:"ETag"`
+		}
+		n := len(u.parts) + 1
+		err := s.doXML("PUT", dstBucket, dstKey, url.Values{"uploadId": {u.id}, "partNumber": {strconv.Itoa(n)}}, header, nil, &result)
+		if err != nil {
+			s.abortUpload(u)
+			return err
+		}
+		u.parts = append(u.parts, s3Part{Number: n, ETag: result.ETag})
+	}
+	if err := s.completeUpload(u, false); err != nil {
+		s.abortUpload(u)
+		return err
+	}
+	return nil
+}
+
+// Rename copies oldname to newname on the service and deletes it, key
+// by key for directories. Like a local rename it replaces a file, or an
+// empty directory if oldname is a directory too. Buckets are not renamed.
+func (s *S3) Rename(oldname, newname string) error {
+	fail := func(err error) error {
+		var se *s3Error
+		if errors.As(err, &se) && se.kind() != nil {
+			err = se.kind()
+		}
+		return &os.LinkError{Op: "rename", Old: s.path(oldname), New: s.path(newname), Err: err}
+	}
+	oldBucket, oldKey := s3Split(oldname)
+	newBucket, newKey := s3Split(newname)
+	if oldKey == "" || newKey == "" {
+		return fail(os.ErrPermission)
+	}
+	if oldBucket == newBucket && oldKey == newKey {
+		return nil
+	}
+	oldInfo, err := s.Stat(oldname)
+	if err != nil {
+		return fail(err)
+	}
+	newInfo, err := s.Stat(newname)
+	switch {
+	case err == nil && newInfo.IsDir() && !oldInfo.IsDir():
+		return fail(errIsDir)
+	case err == nil && !newInfo.IsDir() && oldInfo.IsDir():
+		return fail(errNotDir)
+	case err == nil && newInfo.IsDir():
+		if entries, err := s.ReadDir(newname); err != nil {
+			return fail(err)
+		} else if len(entries) > 0 {
+			return fail(errNotEmpty)
+		}
+	case err != nil && !os.IsNotExist(err):
+		return fail(err)
+	}
+
+	if !oldInfo.IsDir() {
+		if err := s.copyObject(oldBucket, oldKey, oldInfo.Size(), newBucket, newKey); err != nil {
+			return fail(err)
+		}
+		if _, err := s.discard("DELETE", oldBucket, oldKey, nil, nil, nil); err != nil {
+			return fail(err)
+		}
+		return nil
+	}
+
+	if oldBucket == newBucket && strings.HasPrefix(newKey+"/", oldKey+"/") {
+		return fail(errInvalid) // Into itself
+	}
+	objects, err := s.keys(oldBucket, oldKey+"/")
+	if err != nil {
+		return fail(err)
+	}
+	if newInfo != nil {
+		if _, err := s.discard("DELETE", newBucket, newKey+"/", nil, nil, nil); err != nil {
+			return fail(err)
+		}
+	}
+	for _, obj := range objects {
+		dst := newKey + "/" + strings.TrimPrefix(obj.Key, oldKey+"/")
+		if err := s.copyObject(oldBucket, obj.Key, obj.Size, newBucket, dst); err != nil {
+			return fail(err)
+		}
+	}
+	for _, obj := range objects {
+		if _, err := s.discard("DELETE", oldBucket, obj.Key, nil, nil, nil); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+// Remove deletes an object, or the marker of an empty directory.
+func (s *S3) Remove(name string) error {
+	bucket, key := s3Split(name)
+	if key == "" {
+		return s.pathError("remove", name, os.ErrPermission)
+	}
+	_, err := s.head(bucket, key)
+	switch {
+	case err == nil:
+	case !errors.Is(err, os.ErrNotExist):
+		return s.pathError("remove", name, err)
+	default:
+		var page *s3Listing
+		err := s.list(bucket, key+"/", false, 2, func(p *s3Listing) bool {
+			page = p
+			return false
+		})
+		switch {
+		case err != nil:
+			return s.pathError("remove", name, err)
+		case len(page.Contents) == 0:
+			return s.pathError("remove", name, os.ErrNotExist)
+		case len(page.Contents) > 1 || page.Contents[0].Key != key+"/":
+			return s.pathError("remove", name, errNotEmpty)
+		}
+		key += "/"
+	}
+	if _, err := s.discard("DELETE", bucket, key, nil, nil, nil); err != nil {
+		return s.pathError("remove", name, err)
+	}
+	return nil
+}
+
+// RemoveAll deletes name and every object below it. A missing name is
+// not an error. Buckets are not removed.
+func (s *S3) RemoveAll(name string) error {
+	bucket, key := s3Split(name)
+	if key == "" {
+		return s.pathError("remove", name, os.ErrPermission)
+	}
+	objects, err := s.keys(bucket, key+"/")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return s.pathError("remove", name, err)
+	}
+	objects = append(objects, s3Object{Key: key})
+	for _, obj := range objects {
+		if _, err := s.discard("DELETE", bucket, obj.Key, nil, nil, nil); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return s.pathError("remove", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *S3) Symlink(target, name string) error {
+	return s.pathError("symlink", name, errors.ErrUnsupported)
+}
+
+// Chtimes does nothing: objects keep the time they were uploaded.
+func (s *S3) Chtimes(name string, atime, mtime time.Time) error {
+	return nil
+}
+
+// s3Upload is a multipart upload in progress.
+type s3Upload struct {
+	bucket, key string
+	id          string
+	parts       []s3Part
+}
+
+type s3Part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+}
+
+func (s *S3) startUpload(bucket, key string) (*s3Upload, error) {
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.doXML("POST", bucket, key, url.Values{"uploads": {""}}, nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &s3Upload{bucket: bucket, key: key, id: result.UploadID}, nil
+}
+
+func (s *S3) uploadPart(u *s3Upload, data []byte) error {
+	n := len(u.parts) + 1
+	header, err := s.discard("PUT", u.bucket, u.key, url.Values{"uploadId": {u.id}, "partNumber": {strconv.Itoa(n)}}, nil, data)
+	if err != nil {
+		return err
+	}
+	u.parts = append(u.parts, s3Part{Number: n, ETag: header.Get("ETag")})
+	return nil
+}
+
+// completeUpload assembles the parts of u. With excl set it fails if
+// the object exists.
+func (s *S3) completeUpload(u *s3Upload, excl bool) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: u.parts})
+	if err != nil {
+		return err
+	}
+	var header http.Header
+	if excl {
+		header = http.Header{"If-None-Match": {"*"}}
+	}
+	return s.doXML("POST", u.bucket, u.key, url.Values{"uploadId": {u.id}}, header, body, nil)
+}
+
+func (s *S3) abortUpload(u *s3Upload) {
+	s.discard("DELETE", u.bucket, u.key, url.Values{"uploadId": {u.id}}, nil, nil)
+}
+
+// s3Writer uploads a file written through S3.Create. Writes are buffered
+// up to one part, so they block while a full part uploads and the
+// progress of a job follows the upload.
+type s3Writer struct {
+	s           *S3
+	name        string
+	bucket, key string
+	excl        bool
+	buf         []byte
+	upload      *s3Upload // Once the first part is sent
+	err         error
+	closed      bool
+}
+
+func (w *s3Writer) partSize() int {
+	return s3PartSize << min(len(w.parts())/1000, 9)
+}
+
+func (w *s3Writer) parts() []s3Part {
+	if w.upload == nil {
+		return nil
+	}
+	return w.upload.parts
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(w.partSize()-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:n]...)
+		p, written = p[n:], written+n
+		if len(w.buf) < w.partSize() {
+			continue
+		}
+		if err := w.sendPart(); err != nil {
+			w.err = w.s.pathError("write", w.name, err)
+			return written, w.err
+		}
+	}
+	return written, nil
+}
+
+func (w *s3Writer) sendPart() error {
+	if w.upload == nil {
+		u, err := w.s.startUpload(w.bucket, w.key)
+		if err != nil {
+			return err
+		}
+		w.upload = u
+	}
+	if err := w.s.uploadPart(w.upload, w.buf); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close stores the object: in one request if it fits a part, by
+// completing the multipart upload otherwise.
+func (w *s3Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		w.Abort()
+		return w.err
+	}
+	var header http.Header
+	if w.excl {
+		header = http.Header{"If-None-Match": {"*"}}
+	}
+	var err error
+	if w.upload == nil {
+		_, err = w.s.discard("PUT", w.bucket, w.key, nil, header, append([]byte{}, w.buf...))
+	} else {
+		if len(w.buf) > 0 {
+			err = w.sendPart()
+		}
+		if err == nil {
+			err = w.s.completeUpload(w.upload, w.excl)
+		}
+		if err != nil {
+			w.s.abortUpload(w.upload)
+		}
+	}
+	w.buf = nil
+	if err != nil {
+		w.err = w.s.pathError("close", w.name, err)
+	}
+	return w.err
+}
+
+// Abort discards the upload; nothing is stored.
+func (w *s3Writer) Abort() error {
+	w.closed = true
+	if w.upload != nil {
+		w.s.abortUpload(w.upload)
+		w.upload = nil
+	}
+	w.buf = nil
+	return nil
+}
+
+type s3Info struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i s3Info) Name() string       { return i.name }
+func (i s3Info) Size() int64        { return i.size }
+func (i s3Info) ModTime() time.Time { return i.modTime }
+func (i s3Info) IsDir() bool        { return i.dir }
+func (i s3Info) Sys() any           { return nil }
+
+func (i s3Info) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
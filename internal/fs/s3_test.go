@@ -0,0 +1,249 @@
+package fs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"testing"
+
+	"lazycd/internal/fs"
+	"lazycd/internal/fs/s3test"
+)
+
+// startS3 starts an in-process server with the bucket "b" and returns it
+// together with a client, both stopped with the test.
+func startS3(t *testing.T) (*s3test.Server, *fs.S3) {
+	t.Helper()
+	srv, err := s3test.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	srv.CreateBucket("b")
+
+	s, err := fs.NewS3(srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, s
+}
+
+func putObject(t *testing.T, s *fs.S3, name string, data []byte) {
+	t.Helper()
+	w, err := s.Create(name, 0644, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getObject(t *testing.T, s *fs.S3, name string) []byte {
+	t.Helper()
+	r, err := s.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func names(t *testing.T, s *fs.S3, dir string) []string {
+	t.Helper()
+	entries, err := s.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	srv, s := startS3(t)
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*fs.S3PartSize+1000)/16)
+
+	w, err := s.Create("b/big", 0644, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Written in small pieces like io.Copy does
+	for rest := data; len(rest) > 0; {
+		n := min(32<<10, len(rest))
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if srv.Uploads() != 1 {
+		t.Fatalf("uploads in progress: got %d, want 1", srv.Uploads())
+	}
+	if _, err := s.Stat("b/big"); !os.IsNotExist(err) {
+		t.Errorf("object visible before Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if srv.Uploads() != 0 {
+		t.Errorf("uploads in progress after Close: %d", srv.Uploads())
+	}
+	info, err := s.Stat("b/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(data)) {
+		t.Errorf("size: got %d, want %d", info.Size(), len(data))
+	}
+	if !bytes.Equal(getObject(t, s, "b/big"), data) {
+		t.Error("contents differ")
+	}
+}
+
+func TestS3CreateExclusive(t *testing.T) {
+	for _, size := range []int{10, fs.S3PartSize + 10} {
+		srv, s := startS3(t)
+		putObject(t, s, "b/taken", []byte("x"))
+		if _, err := s.Create("b/taken", 0644, true); !errors.Is(err, os.ErrExist) {
+			t.Errorf("size %d: create over an object: got %v, want os.ErrExist", size, err)
+		}
+
+		// Created by someone else while being written: If-None-Match fails
+		w, err := s.Create("b/f", 0644, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+		putObject(t, s, "b/f", []byte("other"))
+		if err := w.Close(); !errors.Is(err, os.ErrExist) {
+			t.Errorf("size %d: close: got %v, want os.ErrExist", size, err)
+		}
+		if got := getObject(t, s, "b/f"); string(got) != "other" {
+			t.Errorf("size %d: object replaced, got %d bytes", size, len(got))
+		}
+		if srv.Uploads() != 0 {
+			t.Errorf("size %d: %d uploads left", size, srv.Uploads())
+		}
+	}
+}
+
+func TestS3Abort(t *testing.T) {
+	for _, size := range []int{10, fs.S3PartSize + 10} {
+		srv, s := startS3(t)
+		w, err := s.Create("b/f", 0644, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Abort(w); err != nil {
+			t.Fatal(err)
+		}
+
+		if srv.Uploads() != 0 {
+			t.Errorf("size %d: %d uploads left", size, srv.Uploads())
+		}
+		if _, err := s.Stat("b/f"); !os.IsNotExist(err) {
+			t.Errorf("size %d: got %v, want no object", size, err)
+		}
+		// Close after Abort stores nothing either
+		w.Close()
+		if _, err := s.Stat("b/f"); !os.IsNotExist(err) {
+			t.Errorf("size %d: stored by Close after Abort", size)
+		}
+	}
+}
+
+func TestS3RenameDir(t *testing.T) {
+	_, s := startS3(t)
+	putObject(t, s, "b/dir/a", []byte("a"))
+	putObject(t, s, "b/dir/sub/c", []byte("c"))
+	if err := s.Mkdir("b/dir/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Rename("b/dir", "b/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, s, "b"); !equal(got, []string{"moved"}) {
+		t.Errorf("bucket: got %v", got)
+	}
+	if got := names(t, s, "b/moved"); !equal(got, []string{"a", "empty", "sub"}) {
+		t.Errorf("moved: got %v", got)
+	}
+	if got := getObject(t, s, "b/moved/sub/c"); string(got) != "c" {
+		t.Errorf("moved/sub/c: got %q", got)
+	}
+	if info, err := s.Stat("b/moved/empty"); err != nil || !info.IsDir() {
+		t.Errorf("moved/empty: got %v, %v", info, err)
+	}
+}
+
+func TestS3RenameDirRefused(t *testing.T) {
+	_, s := startS3(t)
+	putObject(t, s, "b/dir/a", []byte("a"))
+	putObject(t, s, "b/full/x", []byte("x"))
+
+	if err := s.Rename("b/dir", "b/dir/inside"); err == nil {
+		t.Error("renamed a directory into itself")
+	}
+	if err := s.Rename("b/dir", "b/full"); err == nil {
+		t.Error("replaced a non-empty directory")
+	}
+	if got := names(t, s, "b/dir"); !equal(got, []string{"a"}) {
+		t.Errorf("dir: got %v", got)
+	}
+}
+
+func TestS3RemoveAll(t *testing.T) {
+	srv, s := startS3(t)
+	srv.MaxKeys = 2 // Several listing pages
+	for _, name := range []string{"a", "b", "c", "sub/d", "sub/e"} {
+		putObject(t, s, "b/dir/"+name, []byte(name))
+	}
+	if err := s.Mkdir("b/dir/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+	putObject(t, s, "b/dir2", []byte("kept"))
+
+	if err := s.RemoveAll("b/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, s, "b"); !equal(got, []string{"dir2"}) {
+		t.Errorf("bucket: got %v", got)
+	}
+	if err := s.RemoveAll("b/dir"); err != nil {
+		t.Errorf("removing a missing directory: %v", err)
+	}
+	if err := s.RemoveAll("b"); err == nil {
+		t.Error("removed a bucket")
+	}
+}
@@ -0,0 +1,445 @@
+// Package s3test runs an in-process HTTP server speaking the subset of
+// the S3 API lazycd uses, so object storage can be tried without MinIO
+// or an AWS account.
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lazycd/internal/fs"
+)
+
+// Server accepts any credentials. Objects are held in memory; buckets
+// are created with CreateBucket.
+type Server struct {
+	URL string // Endpoint, such as http://127.0.0.1:40080
+
+	// MinPartSize is the smallest part but the last of a multipart
+	// upload, 5 MiB like S3. MaxKeys limits the keys of one listing page,
+	// 1000 by default.
+	MinPartSize int
+	MaxKeys     int
+
+	listener net.Listener
+	server   *http.Server
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	uploads map[string]*upload
+	nextID  int
+}
+
+type bucket struct {
+	created time.Time
+	objects map[string]*object
+}
+
+type object struct {
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+type upload struct {
+	bucket, key string
+	parts       map[int]*object
+}
+
+// NewServer starts a server on a free local port.
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		URL:         "http://" + l.Addr().String(),
+		MinPartSize: 5 << 20,
+		MaxKeys:     1000,
+		listener:    l,
+		buckets:     make(map[string]*bucket),
+		uploads:     make(map[string]*upload),
+	}
+	s.server = &http.Server{Handler: http.HandlerFunc(s.handle)}
+	go s.server.Serve(l)
+	return s, nil
+}
+
+// Options can be returned by a replaced fs.S3Config to use the server.
+func (s *Server) Options() fs.S3Options {
+	return fs.S3Options{Endpoint: s.URL, Region: "us-east-1", AccessKey: "lazycd", SecretKey: "lazycd-secret"}
+}
+
+// CreateBucket adds an empty bucket.
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[name] == nil {
+		s.buckets[name] = &bucket{created: time.Now(), objects: make(map[string]*object)}
+	}
+}
+
+// Uploads returns the number of multipart uploads neither completed nor
+// aborted.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+func newObject(data []byte) *object {
+	sum := md5.Sum(data)
+	return &object{data: data, etag: `"` + hex.EncodeToString(sum[:]) + `"`, modTime: time.Now()}
+}
+
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+var (
+	errNoSuchBucket = apiError{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist"}
+	errNoSuchKey    = apiError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist"}
+	errNoSuchUpload = apiError{http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist"}
+	errPrecondition = apiError{http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the preconditions did not hold"}
+	errNotEmpty     = apiError{http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty"}
+)
+
+func writeError(w http.ResponseWriter, r *http.Request, e apiError) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.status)
+	if r.Method != "HEAD" {
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", e.code, e.message)
+	}
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	data, _ := xml.Marshal(v)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// handle serves path-style requests: /, /bucket and /bucket/key.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	name, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, apiError{http.StatusBadRequest, "IncompleteBody", err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		s.listBuckets(w)
+		return
+	}
+	b := s.buckets[name]
+	if key == "" {
+		switch {
+		case r.Method == "PUT":
+			if b == nil {
+				s.buckets[name] = &bucket{created: time.Now(), objects: make(map[string]*object)}
+			}
+		case b == nil:
+			writeError(w, r, errNoSuchBucket)
+		case r.Method == "GET":
+			s.listObjects(w, r, b)
+		case r.Method == "DELETE" && len(b.objects) > 0:
+			writeError(w, r, errNotEmpty)
+		case r.Method == "DELETE":
+			delete(s.buckets, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	if b == nil {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == "GET" || r.Method == "HEAD":
+		obj := b.objects[key]
+		if obj == nil {
+			writeError(w, r, errNoSuchKey)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", obj.etag)
+		if r.Method == "GET" {
+			w.Write(obj.data)
+		}
+	case r.Method == "PUT" && query.Has("uploadId"):
+		s.uploadPart(w, r, body)
+	case r.Method == "PUT":
+		data := body
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			obj, e := s.source(src, "")
+			if e != nil {
+				writeError(w, r, *e)
+				return
+			}
+			data = obj.data
+		}
+		if r.Header.Get("If-None-Match") == "*" && b.objects[key] != nil {
+			writeError(w, r, errPrecondition)
+			return
+		}
+		obj := newObject(data)
+		b.objects[key] = obj
+		w.Header().Set("ETag", obj.etag)
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			writeXML(w, copyResult{ETag: obj.etag, LastModified: obj.modTime.UTC()})
+		}
+	case r.Method == "POST" && query.Has("uploads"):
+		s.nextID++
+		id := fmt.Sprintf("upload-%d", s.nextID)
+		s.uploads[id] = &upload{bucket: name, key: key, parts: make(map[int]*object)}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: name, Key: key, UploadId: id})
+	case r.Method == "POST" && query.Has("uploadId"):
+		s.completeUpload(w, r, b, query.Get("uploadId"), body)
+	case r.Method == "DELETE" && query.Has("uploadId"):
+		if s.uploads[query.Get("uploadId")] == nil {
+			writeError(w, r, errNoSuchUpload)
+			return
+		}
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE":
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, apiError{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed"})
+	}
+}
+
+type copyResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string
+	LastModified time.Time
+}
+
+// source finds the object of an X-Amz-Copy-Source header, cut to the
+// byte range rng ("bytes=first-last") if one is given.
+func (s *Server) source(src, rng string) (*object, *apiError) {
+	src = strings.TrimPrefix(src, "/")
+	if unescaped, err := url.PathUnescape(src); err == nil {
+		src = unescaped
+	}
+	name, key, _ := strings.Cut(src, "/")
+	b := s.buckets[name]
+	if b == nil {
+		return nil, &errNoSuchBucket
+	}
+	obj := b.objects[key]
+	if obj == nil {
+		return nil, &errNoSuchKey
+	}
+	if rng == "" {
+		return obj, nil
+	}
+	var first, last int
+	if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &first, &last); err != nil || first > last || last >= len(obj.data) {
+		return nil, &apiError{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable"}
+	}
+	return newObject(obj.data[first : last+1]), nil
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, body []byte) {
+	query := r.URL.Query()
+	u := s.uploads[query.Get("uploadId")]
+	if u == nil {
+		writeError(w, r, errNoSuchUpload)
+		return
+	}
+	n, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || n < 1 || n > 10000 {
+		writeError(w, r, apiError{http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000"})
+		return
+	}
+	part := newObject(body)
+	if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+		obj, e := s.source(src, r.Header.Get("X-Amz-Copy-Source-Range"))
+		if e != nil {
+			writeError(w, r, *e)
+			return
+		}
+		part = obj
+		defer writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyPartResult"`
+			ETag         string
+			LastModified time.Time
+		}{ETag: part.etag, LastModified: time.Now().UTC()})
+	}
+	u.parts[n] = part
+	w.Header().Set("ETag", part.etag)
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, b *bucket, id string, body []byte) {
+	u := s.uploads[id]
+	if u == nil {
+		writeError(w, r, errNoSuchUpload)
+		return
+	}
+	var req struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		writeError(w, r, apiError{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed"})
+		return
+	}
+
+	var data []byte
+	var sums []byte
+	for i, p := range req.Parts {
+		part := u.parts[p.PartNumber]
+		switch {
+		case part == nil || part.etag != p.ETag:
+			writeError(w, r, apiError{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found"})
+			return
+		case i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber:
+			writeError(w, r, apiError{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order"})
+			return
+		case i < len(req.Parts)-1 && len(part.data) < s.MinPartSize:
+			writeError(w, r, apiError{http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size"})
+			return
+		}
+		data = append(data, part.data...)
+		sum, _ := hex.DecodeString(strings.Trim(part.etag, `"`))
+		sums = append(sums, sum...)
+	}
+	if r.Header.Get("If-None-Match") == "*" && b.objects[u.key] != nil {
+		writeError(w, r, errPrecondition)
+		return
+	}
+
+	obj := newObject(data)
+	sum := md5.Sum(sums)
+	obj.etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(req.Parts))
+	b.objects[u.key] = obj
+	delete(s.uploads, id)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: u.bucket, Key: u.key, ETag: obj.etag})
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter) {
+	type entry struct {
+		Name         string
+		CreationDate time.Time
+	}
+	var result struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Buckets []entry  `xml:"Buckets>Bucket"`
+	}
+	for name, b := range s.buckets {
+		result.Buckets = append(result.Buckets, entry{Name: name, CreationDate: b.created.UTC()})
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool { return result.Buckets[i].Name < result.Buckets[j].Name })
+	writeXML(w, result)
+}
+
+// listObjects serves ListObjectsV2. The continuation token is the last
+// key of the page.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, b *bucket) {
+	query := r.URL.Query()
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	max := s.MaxKeys
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil && n >= 0 && n < max {
+		max = n
+	}
+	after := query.Get("continuation-token")
+	if after == "" {
+		after = query.Get("start-after")
+	}
+
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	type commonPrefix struct{ Prefix string }
+	var result struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Prefix                string
+		KeyCount              int
+		MaxKeys               int
+		IsTruncated           bool
+		Contents              []content
+		CommonPrefixes        []commonPrefix
+		NextContinuationToken string `xml:",omitempty"`
+	}
+	result.Prefix, result.MaxKeys = prefix, max
+
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	last := ""
+	for _, key := range keys {
+		rest := strings.TrimPrefix(key, prefix)
+		cp := ""
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			cp = prefix + rest[:i+len(delimiter)]
+			if n := len(result.CommonPrefixes); n > 0 && result.CommonPrefixes[n-1].Prefix == cp {
+				last = key // Same group as the last key
+				continue
+			}
+		}
+		if result.KeyCount == max {
+			result.IsTruncated = true
+			result.NextContinuationToken = last
+			break
+		}
+		if cp != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{cp})
+		} else {
+			obj := b.objects[key]
+			result.Contents = append(result.Contents, content{
+				Key:          key,
+				LastModified: obj.modTime.UTC().Format("2006-01-02T15:04:05.000Z"),
+				ETag:         obj.etag,
+				Size:         len(obj.data),
+			})
+		}
+		result.KeyCount++
+		last = key
+	}
+	writeXML(w, result)
+}
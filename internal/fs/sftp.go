@@ -0,0 +1,428 @@
+package fs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// remotePattern matches remote paths: user@host:/dir, with an optional
+// port as in user@host:2222:/dir.
+var remotePattern = regexp.MustCompile(`^([^@/:\s]+)@([A-Za-z0-9._-]+)(?::([0-9]+))?:(.*)$`)
+
+// SplitRemote splits a remote path into its root ("user@host:" or
+// "user@host:port:") and the path on the server. ok is false for local
+// paths.
+func SplitRemote(p string) (root, rest string, ok bool) {
+	m := remotePattern.FindStringSubmatch(p)
+	if m == nil {
+		return "", "", false
+	}
+	return p[:len(p)-len(m[4])], m[4], true
+}
+
+// IsRemote reports whether path names a file on an SSH server.
+func IsRemote(p string) bool {
+	_, _, ok := SplitRemote(p)
+	return ok
+}
+
+// Dir is filepath.Dir keeping remote paths in their user@host:/dir (or
+// s3:/bucket) form; the server's root is its own parent.
+func Dir(p string) string {
+	if root, rest, ok := SplitRemote(p); ok {
+		return root + path.Dir(path.Clean("/"+rest))
+	}
+	if IsS3(p) {
+		return s3Root + path.Dir(path.Clean("/"+strings.TrimPrefix(p, s3Root)))
+	}
+	return filepath.Dir(p)
+}
+
+// resolveRemote turns a remote path into its absolute form. The root
+// alone or a relative path start in the login directory on the server.
+func resolveRemote(p string) (string, error) {
+	root, rest, _ := SplitRemote(p)
+	if !strings.HasPrefix(rest, "/") {
+		home := "/"
+		switch vfs := remote(root).(type) {
+		case brokenFS:
+			return "", vfs.err
+		case *SFTP:
+			home = vfs.home
+		}
+		rest = path.Join(home, rest)
+	}
+	return root + path.Clean(rest), nil
+}
+
+// SFTP is a directory tree on an SSH server as a VFS. Names are relative
+// to the root of the server. Paths to it look like user@host:/dir.
+type SFTP struct {
+	root   string // user@host[:port]:
+	home   string // Login directory on the server
+	client *sftp.Client
+	conn   io.Closer // The SSH connection if DialSFTP opened it
+}
+
+// sftpChunk is how much is buffered before writing to the server, so
+// uploads go out as concurrent packets instead of one round trip each.
+const sftpChunk = 1 << 20
+
+// NewSFTP returns the filesystem of root reached through client.
+func NewSFTP(root string, client *sftp.Client) *SFTP {
+	home, err := client.Getwd()
+	if err != nil || !strings.HasPrefix(home, "/") {
+		home = "/"
+	}
+	return &SFTP{root: root, home: home, client: client}
+}
+
+// SSHConfig returns the client configuration for logging in as user at
+// addr (host:port). The default authenticates with the SSH agent and the
+// unencrypted keys in ~/.ssh and checks the host key against
+// ~/.ssh/known_hosts; tests replace it to reach an in-process server.
+var SSHConfig = defaultSSHConfig
+
+func defaultSSHConfig(user, addr string) (*ssh.ClientConfig, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot check host keys: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		data, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			continue // Encrypted keys are used through the agent
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// DialSFTP connects to the server of a remote root such as "user@host:".
+func DialSFTP(root string) (*SFTP, error) {
+	m := remotePattern.FindStringSubmatch(root)
+	if m == nil || m[4] != "" {
+		return nil, fmt.Errorf("invalid remote %q", root)
+	}
+	user, port := m[1], m[3]
+	if port == "" {
+		port = "22"
+	}
+	addr := net.JoinHostPort(m[2], port)
+
+	config, err := SSHConfig(user, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s := NewSFTP(root, client)
+	s.conn = conn
+	return s, nil
+}
+
+// remotes remembers failed connections, so an unreachable server is not
+// dialed again on every call.
+var remotes = struct {
+	sync.Mutex
+	failed map[string]remoteFailure
+}{failed: make(map[string]remoteFailure)}
+
+type remoteFailure struct {
+	err error
+	at  time.Time
+}
+
+// remoteRetry is how long a failed connection is not retried.
+const remoteRetry = 30 * time.Second
+
+// remote returns the filesystem of a remote root, connecting and mounting
+// it on first use.
+func remote(root string) VFS {
+	remotes.Lock()
+	defer remotes.Unlock()
+	if vfs, _, ok := mounted(root); ok {
+		return vfs // Connected meanwhile
+	}
+	if f, ok := remotes.failed[root]; ok && time.Since(f.at) < remoteRetry {
+		return brokenFS{f.err}
+	}
+	s, err := DialSFTP(root)
+	if err != nil {
+		err = fmt.Errorf("%s %w", root, err)
+		remotes.failed[root] = remoteFailure{err: err, at: time.Now()}
+		return brokenFS{err}
+	}
+	delete(remotes.failed, root)
+	Mount(root, s)
+	return s
+}
+
+// Close ends the connection to the server.
+func (s *SFTP) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
+
+func (s *SFTP) abs(name string) string {
+	return "/" + strings.Join(cleanName(name), "/")
+}
+
+// check unmounts the server if err is a lost connection, so the next
+// call connects again.
+func (s *SFTP) check(err error) {
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+		Unmount(s.root)
+		s.Close()
+	}
+}
+
+// pathError reports err for name by its remote path.
+func (s *SFTP) pathError(op, name string, err error) error {
+	s.check(err)
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return &os.PathError{Op: op, Path: s.root + s.abs(name), Err: err}
+}
+
+// exists reports whether name exists, to tell an os.ErrExist from the
+// generic failure SFTP servers report for it.
+func (s *SFTP) exists(name string) bool {
+	_, err := s.client.Lstat(s.abs(name))
+	return err == nil
+}
+
+func (s *SFTP) Lstat(name string) (os.FileInfo, error) {
+	info, err := s.client.Lstat(s.abs(name))
+	if err != nil {
+		return nil, s.pathError("lstat", name, err)
+	}
+	return info, nil
+}
+
+func (s *SFTP) Stat(name string) (os.FileInfo, error) {
+	info, err := s.client.Stat(s.abs(name))
+	if err != nil {
+		return nil, s.pathError("stat", name, err)
+	}
+	return info, nil
+}
+
+func (s *SFTP) ReadDir(name string) ([]os.DirEntry, error) {
+	infos, err := s.client.ReadDir(s.abs(name))
+	if err != nil {
+		return nil, s.pathError("readdir", name, err)
+	}
+	entries := make([]os.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = iofs.FileInfoToDirEntry(info)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *SFTP) Open(name string) (io.ReadCloser, error) {
+	f, err := s.client.Open(s.abs(name))
+	if err != nil {
+		return nil, s.pathError("open", name, err)
+	}
+	return f, nil
+}
+
+func (s *SFTP) Readlink(name string) (string, error) {
+	target, err := s.client.ReadLink(s.abs(name))
+	if err != nil {
+		return "", s.pathError("readlink", name, err)
+	}
+	return target, nil
+}
+
+func (s *SFTP) Create(name string, perm os.FileMode, excl bool) (io.WriteCloser, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if excl {
+		flag |= os.O_EXCL
+	}
+	f, err := s.client.OpenFile(s.abs(name), flag)
+	if err != nil {
+		if excl && s.exists(name) {
+			err = os.ErrExist
+		}
+		return nil, s.pathError("open", name, err)
+	}
+	_ = f.Chmod(perm.Perm()) // Not every server allows it
+	return &sftpWriter{s: s, name: name, f: f, buf: bufio.NewWriterSize(f, sftpChunk)}, nil
+}
+
+func (s *SFTP) Mkdir(name string, perm os.FileMode) error {
+	if err := s.client.Mkdir(s.abs(name)); err != nil {
+		if s.exists(name) {
+			err = os.ErrExist
+		}
+		return s.pathError("mkdir", name, err)
+	}
+	_ = s.client.Chmod(s.abs(name), perm.Perm())
+	return nil
+}
+
+func (s *SFTP) MkdirAll(name string, perm os.FileMode) error {
+	if err := s.client.MkdirAll(s.abs(name)); err != nil {
+		return s.pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// Rename replaces a file at newname like a local rename. Servers without
+// the posix-rename extension refuse to replace anything, so the file is
+// removed first there.
+func (s *SFTP) Rename(oldname, newname string) error {
+	oldpath, newpath := s.abs(oldname), s.abs(newname)
+	var err error
+	if _, ok := s.client.HasExtension("posix-rename@openssh.com"); ok {
+		err = s.client.PosixRename(oldpath, newpath)
+	} else {
+		err = s.client.Rename(oldpath, newpath)
+		if err != nil && s.exists(oldname) {
+			if info, statErr := s.client.Lstat(newpath); statErr == nil {
+				if info.IsDir() {
+					err = os.ErrExist
+				} else if s.client.Remove(newpath) == nil {
+					err = s.client.Rename(oldpath, newpath)
+				}
+			}
+		}
+	}
+	if err != nil {
+		s.check(err)
+		return &os.LinkError{Op: "rename", Old: s.root + oldpath, New: s.root + newpath, Err: err}
+	}
+	return nil
+}
+
+func (s *SFTP) Remove(name string) error {
+	if err := s.client.Remove(s.abs(name)); err != nil {
+		return s.pathError("remove", name, err)
+	}
+	return nil
+}
+
+// RemoveAll removes name and everything below it. Symlinks are removed,
+// not followed. A missing name is not an error.
+func (s *SFTP) RemoveAll(name string) error {
+	info, err := s.client.Lstat(s.abs(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return s.pathError("remove", name, err)
+	}
+	if info.IsDir() {
+		infos, err := s.client.ReadDir(s.abs(name))
+		if err != nil {
+			return s.pathError("remove", name, err)
+		}
+		for _, child := range infos {
+			if err := s.RemoveAll(path.Join(name, child.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return s.Remove(name)
+}
+
+func (s *SFTP) Symlink(target, name string) error {
+	if err := s.client.Symlink(target, s.abs(name)); err != nil {
+		if s.exists(name) {
+			err = os.ErrExist
+		}
+		return s.pathError("symlink", name, err)
+	}
+	return nil
+}
+
+func (s *SFTP) Chtimes(name string, atime, mtime time.Time) error {
+	if err := s.client.Chtimes(s.abs(name), atime, mtime); err != nil {
+		return s.pathError("chtimes", name, err)
+	}
+	return nil
+}
+
+// sftpWriter buffers writes to a remote file.
+type sftpWriter struct {
+	s    *SFTP
+	name string
+	f    *sftp.File
+	buf  *bufio.Writer
+}
+
+func (w *sftpWriter) Write(p []byte) (int, error) {
+	n, err := w.buf.Write(p)
+	if err != nil {
+		err = w.s.pathError("write", w.name, err)
+	}
+	return n, err
+}
+
+func (w *sftpWriter) Close() error {
+	err := w.buf.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return w.s.pathError("close", w.name, err)
+	}
+	return nil
+}
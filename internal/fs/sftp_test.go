@@ -0,0 +1,270 @@
+package fs
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"lazycd/internal/fs/sftptest"
+)
+
+// startSFTP starts an in-process server that SSHConfig trusts, stopped
+// with the test.
+func startSFTP(t *testing.T) *sftptest.Server {
+	t.Helper()
+	srv, err := sftptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	prev := SSHConfig
+	SSHConfig = srv.ClientConfig
+	t.Cleanup(func() { SSHConfig = prev })
+	return srv
+}
+
+// dialSFTP connects to srv, closing the connection with the test.
+func dialSFTP(t *testing.T, srv *sftptest.Server) *SFTP {
+	t.Helper()
+	s, err := DialSFTP(srv.Root("user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func writeVFS(t *testing.T, vfs VFS, name, data string) {
+	t.Helper()
+	w, err := vfs.Create(name, 0644, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readVFS(t *testing.T, vfs VFS, name string) string {
+	t.Helper()
+	r, err := vfs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func dirNames(t *testing.T, vfs VFS, name string) []string {
+	t.Helper()
+	entries, err := vfs.ReadDir(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSFTPReadDirStat(t *testing.T) {
+	s := dialSFTP(t, startSFTP(t))
+	if err := s.MkdirAll("dir/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeVFS(t, s, "dir/a.txt", "hello")
+
+	if got := dirNames(t, s, "dir"); len(got) != 2 || got[0] != "a.txt" || got[1] != "sub" {
+		t.Errorf("entries: got %v", got)
+	}
+	info, err := s.Stat("dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 5 || info.IsDir() {
+		t.Errorf("a.txt: got size %d, dir %v", info.Size(), info.IsDir())
+	}
+	if info, err := s.Stat("dir/sub"); err != nil || !info.IsDir() {
+		t.Errorf("sub: got %v, %v", info, err)
+	}
+	if _, err := s.Stat("dir/missing"); !os.IsNotExist(err) {
+		t.Errorf("missing: got %v, want a not-exist error", err)
+	}
+}
+
+func TestSFTPResolve(t *testing.T) {
+	srv := startSFTP(t)
+	root := srv.Root("user")
+	t.Cleanup(func() {
+		if vfs, _, ok := mounted(root); ok {
+			Unmount(root)
+			vfs.(*SFTP).Close()
+		}
+	})
+
+	// Remote paths connect on first use
+	if err := MkdirAll(root+"/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Create(root+"/dir/f", 0644, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	items, err := ListDir(root + "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Name != "f" {
+		t.Errorf("items: got %+v", items)
+	}
+}
+
+func TestSFTPCreate(t *testing.T) {
+	s := dialSFTP(t, startSFTP(t))
+	writeVFS(t, s, "f", "first")
+	writeVFS(t, s, "f", "second")
+	if got := readVFS(t, s, "f"); got != "second" {
+		t.Errorf("contents: got %q", got)
+	}
+
+	if _, err := s.Create("f", 0644, true); !errors.Is(err, os.ErrExist) {
+		t.Errorf("exclusive create: got %v, want os.ErrExist", err)
+	}
+	if err := s.Mkdir("f", 0755); !errors.Is(err, os.ErrExist) {
+		t.Errorf("mkdir: got %v, want os.ErrExist", err)
+	}
+}
+
+func TestSFTPRename(t *testing.T) {
+	s := dialSFTP(t, startSFTP(t))
+	writeVFS(t, s, "a", "a")
+	writeVFS(t, s, "b", "b")
+
+	// Like a local rename, an existing file is replaced
+	if err := s.Rename("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readVFS(t, s, "b"); got != "a" {
+		t.Errorf("b: got %q", got)
+	}
+	if _, err := s.Lstat("a"); !os.IsNotExist(err) {
+		t.Errorf("a: got %v, want a not-exist error", err)
+	}
+
+	if err := s.MkdirAll("dir/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeVFS(t, s, "dir/sub/f", "f")
+	if err := s.Rename("dir", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readVFS(t, s, "moved/sub/f"); got != "f" {
+		t.Errorf("moved/sub/f: got %q", got)
+	}
+}
+
+func TestSFTPRemoveAll(t *testing.T) {
+	s := dialSFTP(t, startSFTP(t))
+	if err := s.MkdirAll("dir/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeVFS(t, s, "dir/sub/f", "f")
+
+	if err := s.RemoveAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Lstat("dir"); !os.IsNotExist(err) {
+		t.Errorf("dir: got %v, want a not-exist error", err)
+	}
+	if err := s.RemoveAll("dir"); err != nil {
+		t.Errorf("removing a missing entry: %v", err)
+	}
+}
+
+// writeKnownHosts points the default SSHConfig at a known_hosts file that
+// lists key for the address of srv.
+func writeKnownHosts(t *testing.T, srv *sftptest.Server, key ssh.PublicKey) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if err := os.Mkdir(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	var line string
+	if key != nil {
+		line = knownhosts.Line([]string{srv.Addr}, key) + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSFTPHostKey(t *testing.T) {
+	srv, err := sftptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    ssh.PublicKey // Listed in known_hosts, none if nil
+		wantOK bool
+	}{
+		{"known", srv.HostKey(), true},
+		{"unknown", nil, false},
+		{"changed", otherKey, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeKnownHosts(t, srv, tt.key)
+			s, err := DialSFTP(srv.Root("user"))
+			if tt.wantOK {
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.Close()
+				return
+			}
+			if err == nil {
+				s.Close()
+				t.Fatal("connected despite the host key")
+			}
+			var keyErr *knownhosts.KeyError
+			if !errors.As(err, &keyErr) {
+				t.Fatalf("got %v, want a knownhosts.KeyError", err)
+			}
+			if (tt.key != nil) != (len(keyErr.Want) > 0) {
+				t.Errorf("want: got %d known keys", len(keyErr.Want))
+			}
+		})
+	}
+}
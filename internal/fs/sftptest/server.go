@@ -0,0 +1,137 @@
+// Package sftptest runs an in-process SSH server with an in-memory SFTP
+// subsystem, so remote browsing and transfers can be tried without a
+// real server.
+package sftptest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server accepts any user without authentication. All connections share
+// one in-memory filesystem, which starts empty.
+type Server struct {
+	Addr string // host:port the server listens on
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.PublicKey
+	handlers sftp.Handlers
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a free local port.
+func NewServer() (*Server, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:     l.Addr().String(),
+		listener: l,
+		config:   config,
+		hostKey:  signer.PublicKey(),
+		handlers: sftp.InMemHandler(),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Root returns the remote root of the server for user, such as
+// "user@127.0.0.1:40022:".
+func (s *Server) Root(user string) string {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	return user + "@" + host + ":" + port + ":"
+}
+
+// HostKey returns the public key the server identifies itself with.
+func (s *Server) HostKey() ssh.PublicKey {
+	return s.hostKey
+}
+
+// ClientConfig can replace fs.SSHConfig: it logs in as user and trusts
+// only the host key of this server.
+func (s *Server) ClientConfig(user, addr string) (*ssh.ClientConfig, error) {
+	return &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: ssh.FixedHostKey(s.hostKey),
+		Timeout:         5 * time.Second,
+	}, nil
+}
+
+// Close stops accepting connections. Open connections end when their
+// clients close them.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(ch, requests)
+	}
+}
+
+// handleSession serves the sftp subsystem and refuses everything else.
+func (s *Server) handleSession(ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range requests {
+		var payload struct{ Name string }
+		if req.Type != "subsystem" || ssh.Unmarshal(req.Payload, &payload) != nil || payload.Name != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go ssh.DiscardRequests(requests)
+
+		server := sftp.NewRequestServer(ch, s.handlers)
+		server.Serve()
+		server.Close()
+		return
+	}
+}
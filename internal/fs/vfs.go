@@ -0,0 +1,377 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VFS is a filesystem that can be browsed, read from and written to by
+// Put. Names are slash-separated and relative to the root of the
+// filesystem ("." is the root). Errors are *os.PathError values wrapping
+// the os errors (os.ErrNotExist, os.ErrExist, ...), so os.IsNotExist and
+// errors.Is work on them as on the local disk.
+type VFS interface {
+	Lstat(name string) (os.FileInfo, error)
+	Stat(name string) (os.FileInfo, error) // Follows symlinks
+	ReadDir(name string) ([]os.DirEntry, error)
+	Open(name string) (io.ReadCloser, error)
+	Readlink(name string) (string, error)
+
+	// Create opens name for writing, truncating it. With excl set it
+	// fails with an os.ErrExist error if name exists. The file is only
+	// complete once Close returned without error.
+	Create(name string, perm os.FileMode, excl bool) (io.WriteCloser, error)
+	Mkdir(name string, perm os.FileMode) error
+	MkdirAll(name string, perm os.FileMode) error
+	Rename(oldname, newname string) error
+	Remove(name string) error // Files and empty directories
+	RemoveAll(name string) error
+	Symlink(target, name string) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// ErrReadOnly is returned by the writing methods of read-only filesystems
+// such as archives.
+var ErrReadOnly = errors.New("read-only filesystem")
+
+// ErrCrossFS is returned by Rename for paths on different filesystems;
+// like a rename across devices, it has to be done by copying.
+var ErrCrossFS = errors.New("rename across filesystems")
+
+// Local is the local disk. Its names are plain absolute paths.
+var Local VFS = localFS{}
+
+type localFS struct{}
+
+func (localFS) Lstat(name string) (os.FileInfo, error)     { return os.Lstat(name) }
+func (localFS) Stat(name string) (os.FileInfo, error)      { return os.Stat(name) }
+func (localFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+func (localFS) Open(name string) (io.ReadCloser, error)    { return os.Open(name) }
+func (localFS) Readlink(name string) (string, error)       { return os.Readlink(name) }
+
+func (localFS) Create(name string, perm os.FileMode, excl bool) (io.WriteCloser, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if excl {
+		flag |= os.O_EXCL
+	}
+	return os.OpenFile(name, flag, perm)
+}
+
+func (localFS) Mkdir(name string, perm os.FileMode) error    { return os.Mkdir(name, perm) }
+func (localFS) MkdirAll(name string, perm os.FileMode) error { return os.MkdirAll(name, perm) }
+func (localFS) Rename(oldname, newname string) error         { return os.Rename(oldname, newname) }
+func (localFS) Remove(name string) error                     { return os.Remove(name) }
+func (localFS) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+func (localFS) Symlink(target, name string) error            { return os.Symlink(target, name) }
+
+func (localFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// mounts holds the filesystems made to appear at a local path by Mount.
+var mounts = struct {
+	sync.RWMutex
+	roots map[string]VFS
+}{roots: make(map[string]VFS)}
+
+// Mount makes vfs appear at root: root itself is the "." of vfs and
+// root/a/b its "a/b". A later Mount of the same root replaces it.
+func Mount(root string, vfs VFS) {
+	mounts.Lock()
+	defer mounts.Unlock()
+	mounts.roots[filepath.Clean(root)] = vfs
+}
+
+// Unmount removes the filesystem mounted at root.
+func Unmount(root string) {
+	mounts.Lock()
+	defer mounts.Unlock()
+	delete(mounts.roots, filepath.Clean(root))
+}
+
+// mounted finds the filesystem mounted at or above path. The deepest
+// mount wins.
+func mounted(path string) (VFS, string, bool) {
+	mounts.RLock()
+	defer mounts.RUnlock()
+	if len(mounts.roots) == 0 {
+		return nil, "", false
+	}
+	for p := filepath.Clean(path); ; {
+		if vfs, ok := mounts.roots[p]; ok {
+			rel, err := filepath.Rel(p, path)
+			if err != nil {
+				return nil, "", false
+			}
+			return vfs, filepath.ToSlash(rel), true
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return nil, "", false
+		}
+		p = parent
+	}
+}
+
+// Resolve returns the filesystem holding path and the name of path on it.
+// Paths at or below a Mount root belong to the mounted filesystem, remote
+// paths (user@host:/dir) to the SFTP server, connected on first use, and
+// s3:/bucket/key paths to object storage.
+// Paths below an archive file, such as /x/a.zip/dir/file, are members of the
+// archive; everything else is on the local disk. The archive file itself
+// is a local file, see ResolveDir for entering it.
+func Resolve(path string) (VFS, string) {
+	if vfs, name, ok := mounted(path); ok {
+		return vfs, name
+	}
+	if root, rest, ok := SplitRemote(path); ok {
+		return remote(root), rest
+	}
+	if IsS3(path) {
+		return objectStore(), strings.TrimPrefix(path, s3Root)
+	}
+	if archive, name, ok := SplitArchive(path); ok {
+		a, err := OpenArchive(archive)
+		if err != nil {
+			return brokenFS{err}, name
+		}
+		return a, name
+	}
+	return Local, path
+}
+
+// ResolveDir is Resolve for a path to be listed: an archive file is
+// resolved to the root of the archive.
+func ResolveDir(path string) (VFS, string) {
+	if IsLocal(path) && IsArchive(path) {
+		a, err := OpenArchive(path)
+		if err != nil {
+			return brokenFS{err}, "."
+		}
+		return a, "."
+	}
+	return Resolve(path)
+}
+
+// SplitArchive splits a path below an archive file into the path of the
+// archive and the member name. ok is false for paths outside archives,
+// and for paths on mounted filesystems.
+func SplitArchive(path string) (archive, name string, ok bool) {
+	if _, _, ok := mounted(path); ok {
+		return "", "", false
+	}
+	for p := filepath.Clean(path); ; {
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", "", false
+		}
+		if IsArchive(parent) {
+			rel, err := filepath.Rel(parent, path)
+			if err != nil {
+				return "", "", false
+			}
+			return parent, filepath.ToSlash(rel), true
+		}
+		p = parent
+	}
+}
+
+// IsLocal reports whether path is on the local disk, neither in an
+// archive nor on a mounted filesystem.
+func IsLocal(path string) bool {
+	vfs, _ := Resolve(path)
+	return vfs == Local
+}
+
+// SameFS reports whether a and b are on the same filesystem, so one can
+// be renamed to the other. Local paths may still be on different devices.
+func SameFS(a, b string) bool {
+	va, _ := Resolve(a)
+	vb, _ := Resolve(b)
+	return va == vb
+}
+
+// InArchive reports whether path is a member of an archive.
+func InArchive(path string) bool {
+	_, _, ok := SplitArchive(path)
+	return ok
+}
+
+// HostPath returns the local file holding path: the archive for an
+// archive member, path itself otherwise.
+func HostPath(path string) string {
+	if archive, _, ok := SplitArchive(path); ok {
+		return archive
+	}
+	return path
+}
+
+// Lstat, Stat, ReadDir, Open, Readlink and the writing functions below
+// act on path in the filesystem Resolve finds for it.
+func Lstat(path string) (os.FileInfo, error) {
+	vfs, name := Resolve(path)
+	return vfs.Lstat(name)
+}
+
+func Stat(path string) (os.FileInfo, error) {
+	vfs, name := Resolve(path)
+	return vfs.Stat(name)
+}
+
+func ReadDir(path string) ([]os.DirEntry, error) {
+	vfs, name := ResolveDir(path)
+	return vfs.ReadDir(name)
+}
+
+func Open(path string) (io.ReadCloser, error) {
+	vfs, name := Resolve(path)
+	return vfs.Open(name)
+}
+
+func Readlink(path string) (string, error) {
+	vfs, name := Resolve(path)
+	return vfs.Readlink(name)
+}
+
+func Create(path string, perm os.FileMode, excl bool) (io.WriteCloser, error) {
+	vfs, name := Resolve(path)
+	return vfs.Create(name, perm, excl)
+}
+
+func Mkdir(path string, perm os.FileMode) error {
+	vfs, name := Resolve(path)
+	return vfs.Mkdir(name, perm)
+}
+
+func MkdirAll(path string, perm os.FileMode) error {
+	vfs, name := Resolve(path)
+	return vfs.MkdirAll(name, perm)
+}
+
+func Remove(path string) error {
+	vfs, name := Resolve(path)
+	return vfs.Remove(name)
+}
+
+func RemoveAll(path string) error {
+	vfs, name := Resolve(path)
+	return vfs.RemoveAll(name)
+}
+
+func Symlink(target, path string) error {
+	vfs, name := Resolve(path)
+	return vfs.Symlink(target, name)
+}
+
+func Chtimes(path string, atime, mtime time.Time) error {
+	vfs, name := Resolve(path)
+	return vfs.Chtimes(name, atime, mtime)
+}
+
+// Rename renames oldpath to newpath. Paths on different filesystems fail
+// with an error wrapping ErrCrossFS.
+func Rename(oldpath, newpath string) error {
+	oldFS, oldname := Resolve(oldpath)
+	newFS, newname := Resolve(newpath)
+	if oldFS != newFS {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrCrossFS}
+	}
+	return oldFS.Rename(oldname, newname)
+}
+
+// Sync flushes a file returned by Create to stable storage if its
+// filesystem supports that.
+func Sync(w io.Writer) error {
+	if s, ok := w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Abort discards a file returned by Create that is not to be completed,
+// such as an object whose upload failed halfway. Files of filesystems
+// without that are closed.
+func Abort(w io.WriteCloser) error {
+	if a, ok := w.(interface{ Abort() error }); ok {
+		return a.Abort()
+	}
+	return w.Close()
+}
+
+// WalkDir is filepath.WalkDir for paths in any filesystem. Paths passed
+// to fn are joined to root like local paths.
+func WalkDir(root string, fn iofs.WalkDirFunc) error {
+	vfs, name := Resolve(root)
+	if vfs == Local {
+		return filepath.WalkDir(root, fn)
+	}
+	info, err := vfs.Lstat(name)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(vfs, name, root, iofs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDir(vfs VFS, name, p string, d os.DirEntry, fn iofs.WalkDirFunc) error {
+	if err := fn(p, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := vfs.ReadDir(name)
+	if err != nil {
+		err = fn(p, d, err)
+		if err != nil {
+			if err == filepath.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		child := filepath.Join(p, entry.Name())
+		if err := walkDir(vfs, path.Join(name, entry.Name()), child, entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// brokenFS fails every call with the error that kept an archive from
+// being opened.
+type brokenFS struct{ err error }
+
+func (b brokenFS) Lstat(string) (os.FileInfo, error)     { return nil, b.err }
+func (b brokenFS) Stat(string) (os.FileInfo, error)      { return nil, b.err }
+func (b brokenFS) ReadDir(string) ([]os.DirEntry, error) { return nil, b.err }
+func (b brokenFS) Open(string) (io.ReadCloser, error)    { return nil, b.err }
+func (b brokenFS) Readlink(string) (string, error)       { return "", b.err }
+
+func (b brokenFS) Create(string, os.FileMode, bool) (io.WriteCloser, error) { return nil, b.err }
+func (b brokenFS) Mkdir(string, os.FileMode) error                          { return b.err }
+func (b brokenFS) MkdirAll(string, os.FileMode) error                       { return b.err }
+func (b brokenFS) Rename(string, string) error                              { return b.err }
+func (b brokenFS) Remove(string) error                                      { return b.err }
+func (b brokenFS) RemoveAll(string) error                                   { return b.err }
+func (b brokenFS) Symlink(string, string) error                             { return b.err }
+func (b brokenFS) Chtimes(string, time.Time, time.Time) error               { return b.err }
@@ -0,0 +1,43 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+
+	"lazycd/internal/fs"
+)
+
+// loadArchive lists the members of a zip or tar archive with a summary.
+func loadArchive(ctx context.Context, p *Preview, maxLines int) error {
+	p.Kind = KindArchive
+	a, err := fs.OpenArchive(p.Path)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	members := a.Members()
+	var total int64
+	for _, m := range members {
+		if !m.IsDir {
+			total += m.Size
+		}
+		if len(p.Lines) < maxLines {
+			line := clean(m.Name)
+			if m.IsDir {
+				line = colorize(line, colorKeyword)
+			} else {
+				line += colorize(fmt.Sprintf("  %d", m.Size), colorComment)
+			}
+			p.Lines = append(p.Lines, line)
+		}
+	}
+
+	p.Title = fmt.Sprintf("%s archive, %d entries, %d bytes unpacked", a.Format(), len(members), total)
+	if len(members) > len(p.Lines) {
+		p.Lines = append(p.Lines, fmt.Sprintf("... %d more", len(members)-len(p.Lines)))
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package preview
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ANSI colors understood by gocui's normal output mode.
+const (
+	colorKeyword = "\x1b[35m"
+	colorString  = "\x1b[32m"
+	colorComment = "\x1b[36m"
+	colorNumber  = "\x1b[33m"
+	colorReset   = "\x1b[0m"
+)
+
+func colorize(s, color string) string {
+	return color + s + colorReset
+}
+
+// language is what the highlighter knows about a source language.
+type language struct {
+	name         string
+	keywords     map[string]bool
+	lineComment  []string
+	blockComment [2]string // Start and end, empty if none
+	quotes       string    // Characters opening a string
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	langGo = &language{
+		name: "Go",
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var nil true false iota`),
+		lineComment:  []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+	}
+	langC = &language{
+		name: "C-like",
+		keywords: words(`auto break case catch char class const continue default delete do double else enum
+			extern final float for fn goto if impl import int let long match mod mut namespace new null
+			package private protected pub public return self short signed sizeof static struct super
+			switch template this throw trait true false try typedef union unsigned use using virtual void
+			volatile while`),
+		lineComment:  []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	langJS = &language{
+		name: "JavaScript",
+		keywords: words(`async await break case catch class const continue debugger default delete do else
+			export extends false finally for from function if import in instanceof interface let new null
+			of return static super switch this throw true try type typeof undefined var void while yield`),
+		lineComment:  []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+	}
+	langPython = &language{
+		name: "Python",
+		keywords: words(`and as assert async await break class continue def del elif else except False
+			finally for from global if import in is lambda None nonlocal not or pass raise return True
+			try while with yield`),
+		lineComment: []string{"#"},
+		quotes:      "\"'",
+	}
+	langShell = &language{
+		name: "Shell",
+		keywords: words(`case do done elif else esac export fi for function if in local return then until
+			while`),
+		lineComment: []string{"#"},
+		quotes:      "\"'",
+	}
+	langConfig = &language{
+		name:        "Config",
+		keywords:    words(`true false null yes no on off`),
+		lineComment: []string{"#"},
+		quotes:      "\"'",
+	}
+	langJSON = &language{
+		name:     "JSON",
+		keywords: words(`true false null`),
+		quotes:   "\"",
+	}
+)
+
+var languagesByExt = map[string]*language{
+	".go":   langGo,
+	".c":    langC,
+	".h":    langC,
+	".cc":   langC,
+	".cpp":  langC,
+	".hpp":  langC,
+	".java": langC,
+	".kt":   langC,
+	".rs":   langC,
+	".cs":   langC,
+	".js":   langJS,
+	".mjs":  langJS,
+	".jsx":  langJS,
+	".ts":   langJS,
+	".tsx":  langJS,
+	".py":   langPython,
+	".sh":   langShell,
+	".bash": langShell,
+	".zsh":  langShell,
+	".yaml": langConfig,
+	".yml":  langConfig,
+	".toml": langConfig,
+	".ini":  langConfig,
+	".conf": langConfig,
+	".json": langJSON,
+}
+
+// languageFor picks the language of path by its name, nil if unknown.
+func languageFor(path string) *language {
+	base := filepath.Base(path)
+	switch base {
+	case "Makefile", "Dockerfile", ".bashrc", ".zshrc", ".profile":
+		return langShell
+	}
+	return languagesByExt[strings.ToLower(filepath.Ext(base))]
+}
+
+// highlight colors lines of lang source. Block comments may span lines;
+// strings may not. Without a language the lines are returned as is.
+func highlight(lines []string, lang *language) []string {
+	if lang == nil {
+		return lines
+	}
+	inBlock := false
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i], inBlock = highlightLine(line, lang, inBlock)
+	}
+	return out
+}
+
+func highlightLine(line string, lang *language, inBlock bool) (string, bool) {
+	var b strings.Builder
+	rest := line
+	for rest != "" {
+		if inBlock {
+			end := strings.Index(rest, lang.blockComment[1])
+			if end < 0 {
+				b.WriteString(colorize(rest, colorComment))
+				return b.String(), true
+			}
+			end += len(lang.blockComment[1])
+			b.WriteString(colorize(rest[:end], colorComment))
+			rest = rest[end:]
+			inBlock = false
+			continue
+		}
+
+		if lang.blockComment[0] != "" && strings.HasPrefix(rest, lang.blockComment[0]) {
+			inBlock = true
+			b.WriteString(colorize(lang.blockComment[0], colorComment))
+			rest = rest[len(lang.blockComment[0]):]
+			continue
+		}
+		if hasAnyPrefix(rest, lang.lineComment) {
+			b.WriteString(colorize(rest, colorComment))
+			return b.String(), false
+		}
+
+		c := rest[0]
+		switch {
+		case strings.IndexByte(lang.quotes, c) >= 0:
+			end := stringEnd(rest, c)
+			b.WriteString(colorize(rest[:end], colorString))
+			rest = rest[end:]
+		case isWordByte(c):
+			end := 1
+			for end < len(rest) && isWordByte(rest[end]) {
+				end++
+			}
+			word := rest[:end]
+			switch {
+			case lang.keywords[word]:
+				b.WriteString(colorize(word, colorKeyword))
+			case c >= '0' && c <= '9':
+				b.WriteString(colorize(word, colorNumber))
+			default:
+				b.WriteString(word)
+			}
+			rest = rest[end:]
+		default:
+			b.WriteByte(c)
+			rest = rest[1:]
+		}
+	}
+	return b.String(), inBlock
+}
+
+// stringEnd returns the length of the string literal at the start of s,
+// opened by quote. An unterminated string runs to the end of the line.
+func stringEnd(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWordByte reports whether c belongs to an identifier or number. Bytes
+// of multi-byte runes count as letters.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
@@ -0,0 +1,265 @@
+// Package preview renders what the preview pane shows for a path: the
+// first lines of a text file with syntax highlighting, a hex dump of a
+// binary, the entries of a directory and metadata of images and archives.
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif" // Register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"lazycd/internal/fs"
+)
+
+type Kind string
+
+const (
+	KindText    Kind = "text"
+	KindBinary  Kind = "binary"
+	KindDir     Kind = "directory"
+	KindImage   Kind = "image"
+	KindArchive Kind = "archive"
+	KindOther   Kind = "other" // Symlinks, devices, sockets...
+)
+
+// Preview is the rendered preview of a path. Lines may contain ANSI color
+// escapes; everything taken from the file itself is stripped of control
+// characters.
+type Preview struct {
+	Path  string
+	Kind  Kind
+	Title string // Short description, e.g. "Go" or "12 entries"
+	Lines []string
+}
+
+// sniffSize is how much of a file is read to tell text from binary.
+const sniffSize = 8192
+
+// hexBytes is how much of a binary is dumped.
+const hexBytes = 512
+
+// Load renders the preview of path with at most maxLines lines. It stops
+// early with ctx.Err() once ctx is canceled. Archive members are previewed
+// like local files.
+func Load(ctx context.Context, path string, maxLines int) (*Preview, error) {
+	info, err := fs.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{Path: path}
+
+	switch {
+	case info.IsDir():
+		err = loadDir(ctx, p, maxLines)
+	case !info.Mode().IsRegular():
+		p.Kind = KindOther
+		p.Title = info.Mode().Type().String()
+		if target, err := fs.Readlink(path); err == nil {
+			p.Lines = append(p.Lines, "-> "+clean(target))
+		}
+	default:
+		err = loadFile(ctx, p, info, maxLines)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, ctx.Err()
+}
+
+// loadDir lists the entries of a directory, directories first.
+func loadDir(ctx context.Context, p *Preview, maxLines int) error {
+	p.Kind = KindDir
+	entries, err := readDir(ctx, p.Path)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	p.Title = fmt.Sprintf("%d entries", len(entries))
+	for i, entry := range entries {
+		if i == maxLines {
+			p.Lines = append(p.Lines, fmt.Sprintf("... %d more", len(entries)-i))
+			break
+		}
+		name := clean(entry.Name())
+		if entry.IsDir() {
+			name = colorize(name+"/", colorKeyword)
+		}
+		p.Lines = append(p.Lines, name)
+	}
+	return nil
+}
+
+// readDir reads the entries of dir. Local directories are read in chunks
+// so a huge one can be given up on.
+func readDir(ctx context.Context, dir string) ([]os.DirEntry, error) {
+	if !fs.IsLocal(dir) {
+		return fs.ReadDir(dir)
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []os.DirEntry
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		chunk, err := f.ReadDir(256)
+		entries = append(entries, chunk...)
+		if err == io.EOF || len(chunk) == 0 {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// loadFile previews a regular file by its contents.
+func loadFile(ctx context.Context, p *Preview, info os.FileInfo, maxLines int) error {
+	if fs.ArchiveFormat(p.Path) != "" && fs.IsLocal(p.Path) {
+		return loadArchive(ctx, p, maxLines)
+	}
+
+	f, err := fs.Open(p.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+		p.Kind = KindImage
+		p.Title = format + " image"
+		p.Lines = []string{
+			fmt.Sprintf("Format:     %s", format),
+			fmt.Sprintf("Dimensions: %d x %d", cfg.Width, cfg.Height),
+			fmt.Sprintf("Size:       %d bytes", info.Size()),
+		}
+		return nil
+	}
+
+	if !isText(head) {
+		p.Kind = KindBinary
+		p.Title = fmt.Sprintf("binary, %d bytes", info.Size())
+		p.Lines = hexDump(head, hexBytes, maxLines)
+		return nil
+	}
+
+	// Read on until maxLines lines are there, a bounded amount per line
+	text := head
+	for bytes.Count(text, []byte("\n")) < maxLines && len(text) < maxLines*512 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk := make([]byte, sniffSize)
+		n, err := f.Read(chunk)
+		text = append(text, chunk[:n]...)
+		if err != nil {
+			break
+		}
+	}
+
+	lang := languageFor(p.Path)
+	p.Kind = KindText
+	p.Title = "text"
+	if lang != nil {
+		p.Title = lang.name
+	}
+	p.Lines = highlight(splitLines(text, maxLines), lang)
+	return nil
+}
+
+// isText reports whether data looks like UTF-8 text. A rune cut off at the
+// end of data does not count against it.
+func isText(data []byte) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return len(data)-i < utf8.UTFMax && !utf8.FullRune(data[i:])
+		}
+		i += size
+	}
+	return true
+}
+
+// splitLines returns up to maxLines lines of text with tabs expanded and
+// control characters removed.
+func splitLines(text []byte, maxLines int) []string {
+	lines := strings.Split(string(text), "\n")
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	for i, line := range lines {
+		lines[i] = clean(strings.ReplaceAll(strings.TrimSuffix(line, "\r"), "\t", "    "))
+	}
+	return lines
+}
+
+// clean replaces control characters (including ESC, which would be taken
+// as a color escape) with '?'.
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// hexDump formats up to limit bytes of data as offset, hex and ASCII
+// columns, 16 bytes a line.
+func hexDump(data []byte, limit, maxLines int) []string {
+	if len(data) > limit {
+		data = data[:limit]
+	}
+	var lines []string
+	for off := 0; off < len(data) && len(lines) < maxLines; off += 16 {
+		row := data[off:min(off+16, len(data))]
+		var hex, ascii strings.Builder
+		for i := 0; i < 16; i++ {
+			if i < len(row) {
+				fmt.Fprintf(&hex, "%02x ", row[i])
+				if row[i] >= 0x20 && row[i] < 0x7f {
+					ascii.WriteByte(row[i])
+				} else {
+					ascii.WriteByte('.')
+				}
+			} else {
+				hex.WriteString("   ")
+			}
+			if i == 7 {
+				hex.WriteByte(' ')
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s |%s|", colorize(fmt.Sprintf("%08x", off), colorComment), hex.String(), ascii.String()))
+	}
+	return lines
+}
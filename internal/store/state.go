@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,10 +26,59 @@ type ShelfItem struct {
 	Exists    bool      `json:"exists"` // Runtime flag, might not be needed in JSON but good for cache
 }
 
+// Tab is a browser tab: its directory and how it is listed.
+type Tab struct {
+	Dir        string   `json:"dir"`
+	Cursor     int      `json:"cursor,omitempty"`   // Index of the item under the cursor
+	Selected   []string `json:"selected,omitempty"` // Selected absolute paths
+	Sort       string   `json:"sort,omitempty"`     // name (default), size or modified
+	ShowHidden bool     `json:"show_hidden,omitempty"`
+	Back       []string `json:"back,omitempty"`    // Directories to go back to, newest last
+	Forward    []string `json:"forward,omitempty"` // Directories gone back from, newest last
+}
+
+// Bookmark is a named directory. Mark is the letter that jumps to it, ""
+// if it has none.
+type Bookmark struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+	Mark string `json:"mark,omitempty"`
+}
+
 type State struct {
-	LastDir    string      `json:"last_dir"`
+	LastDir    string      `json:"last_dir"` // Directory of the active tab
 	TargetDir  string      `json:"target_dir"`
 	ShelfItems []ShelfItem `json:"shelf_items"`
+	VerifyAlgo string      `json:"verify_algo,omitempty"` // Post-copy checksum, "" = off
+
+	// Browser tabs; the active one is stored when lazycd quits
+	Tabs      []Tab `json:"tabs,omitempty"`
+	ActiveTab int   `json:"active_tab,omitempty"`
+	// Directories opened in the browser, most recent first
+	RecentDirs []string `json:"recent_dirs,omitempty"`
+	// Bookmarked directories, in the order they were added
+	Bookmarks []Bookmark `json:"bookmarks,omitempty"`
+
+	// Transfer tuning, edited in state.json
+	Parallelism int   `json:"parallelism,omitempty"` // Items put concurrently, 0 = 1
+	RateLimit   int64 `json:"rate_limit,omitempty"`  // Bytes per second, 0 = unlimited
+	MaxJobs     int   `json:"max_jobs,omitempty"`    // Queued jobs run concurrently, 0 = 1
+
+	// Job history retention, applied at startup and by `lazycd jobs gc`
+	JobRetentionCount int `json:"job_retention_count,omitempty"` // Saved jobs kept, 0 = all
+	JobRetentionDays  int `json:"job_retention_days,omitempty"`  // Days a job is kept, 0 = forever
+
+	// Conflict handling for Put: skip (default), rename, overwrite, newer,
+	// larger, size-differs or skip-identical
+	ConflictPolicy string `json:"conflict_policy,omitempty"`
+	// Name pattern for the rename conflict policy, e.g. "{name}_{n}{ext}"
+	RenameTemplate string `json:"rename_template,omitempty"`
+	// Filename sanitization for Put: auto (FAT/exFAT targets), always or off
+	Sanitize string `json:"sanitize,omitempty"`
+	// Last used "put as archive" settings: zip, tar, tar.gz or tar.zst and
+	// flat, relative or full member paths
+	ArchiveFormat string `json:"archive_format,omitempty"`
+	ArchiveLayout string `json:"archive_layout,omitempty"`
 }
 
 func NewState() *State {
@@ -102,3 +152,62 @@ func NewShelfItem(absPath string, isDir bool) ShelfItem {
 		Exists:  true,
 	}
 }
+
+// RemoveShelfPaths drops every shelf item whose path is in paths.
+func (s *State) RemoveShelfPaths(paths map[string]struct{}) {
+	kept := s.ShelfItems[:0]
+	for _, item := range s.ShelfItems {
+		if _, ok := paths[item.AbsPath]; !ok {
+			kept = append(kept, item)
+		}
+	}
+	s.ShelfItems = kept
+}
+
+// MaxRecentDirs is the length of State.RecentDirs.
+const MaxRecentDirs = 20
+
+// AddRecentDir moves dir to the front of the recent directories.
+func (s *State) AddRecentDir(dir string) {
+	recent := []string{dir}
+	for _, d := range s.RecentDirs {
+		if d != dir && len(recent) < MaxRecentDirs {
+			recent = append(recent, d)
+		}
+	}
+	s.RecentDirs = recent
+}
+
+// BookmarkByMark returns the bookmark with the letter mark, nil if there is
+// none.
+func (s *State) BookmarkByMark(mark string) *Bookmark {
+	for i := range s.Bookmarks {
+		if s.Bookmarks[i].Mark == mark {
+			return &s.Bookmarks[i]
+		}
+	}
+	return nil
+}
+
+// SetMark gives the bookmark of dir the letter mark, bookmarking dir under
+// its base name first if needed.
+func (s *State) SetMark(mark, dir string) {
+	i := slices.IndexFunc(s.Bookmarks, func(b Bookmark) bool { return b.Dir == dir })
+	if i < 0 {
+		s.Bookmarks = append(s.Bookmarks, Bookmark{Name: filepath.Base(dir), Dir: dir})
+		i = len(s.Bookmarks) - 1
+	}
+	s.MarkBookmark(i, mark)
+}
+
+// MarkBookmark gives bookmark i the letter mark, or removes its letter if
+// mark is "". A bookmark that had the letter keeps its directory but loses
+// the letter.
+func (s *State) MarkBookmark(i int, mark string) {
+	for j := range s.Bookmarks {
+		if mark != "" && s.Bookmarks[j].Mark == mark {
+			s.Bookmarks[j].Mark = ""
+		}
+	}
+	s.Bookmarks[i].Mark = mark
+}
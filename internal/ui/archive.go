@@ -0,0 +1,206 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"lazycd/internal/core"
+	"lazycd/internal/store"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// ArchiveDialog prompts for the name, format and layout of an archive to
+// put the shelf into, then shows the plan for it.
+type ArchiveDialog struct {
+	gui *Gui
+
+	srcs     []string
+	format   core.ArchiveFormat
+	layout   core.ArchiveLayout
+	prevView string
+}
+
+func NewArchiveDialog(gui *Gui) *ArchiveDialog {
+	return &ArchiveDialog{gui: gui}
+}
+
+func (a *ArchiveDialog) Keybindings() error {
+	if err := a.gui.g.SetKeybinding("archive", gocui.KeyEnter, gocui.ModNone, a.confirm); err != nil {
+		return err
+	}
+	if err := a.gui.g.SetKeybinding("archive", gocui.KeyEsc, gocui.ModNone, a.cancel); err != nil {
+		return err
+	}
+	if err := a.gui.g.SetKeybinding("archive", gocui.KeyCtrlF, gocui.ModNone, a.cycleFormat); err != nil {
+		return err
+	}
+	if err := a.gui.g.SetKeybinding("archive", gocui.KeyCtrlL, gocui.ModNone, a.cycleLayout); err != nil {
+		return err
+	}
+	// Letters are typed into the name; other global keys are swallowed
+	return a.gui.g.SetKeybinding("archive", gocui.KeyTab, gocui.ModNone, noop)
+}
+
+// Show opens the prompt for an archive of srcs.
+func (a *ArchiveDialog) Show(srcs []string) error {
+	g := a.gui.g
+	a.srcs = srcs
+	a.format = core.ArchiveFormat(a.gui.State.ArchiveFormat)
+	if core.FormatFor(a.format.Ext()) == "" {
+		a.format = core.FormatZip
+	}
+	a.layout = core.ArchiveLayout(a.gui.State.ArchiveLayout)
+	if a.layout == "" {
+		a.layout = core.LayoutFlat
+	}
+	if cv := g.CurrentView(); cv != nil && cv.Name() != "archive" {
+		a.prevView = cv.Name()
+	}
+
+	maxX, maxY := g.Size()
+	v, err := g.SetView("archive", maxX/6, maxY/2-1, maxX*5/6, maxY/2+1, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Editable = true
+	v.Wrap = false
+	a.setName(v, "shelf-"+time.Now().Format("20060102-150405")+a.format.Ext())
+	a.updateTitle(v)
+
+	g.Cursor = true
+	_, err = g.SetCurrentView("archive")
+	return err
+}
+
+func (a *ArchiveDialog) name(v *gocui.View) string {
+	return strings.TrimSpace(v.Buffer())
+}
+
+func (a *ArchiveDialog) setName(v *gocui.View, name string) {
+	v.Clear()
+	fmt.Fprint(v, name)
+	v.SetOrigin(0, 0)
+	v.SetCursor(len(name), 0)
+}
+
+func (a *ArchiveDialog) updateTitle(v *gocui.View) {
+	v.Title = fmt.Sprintf(" Archive %d items (^F format: %s | ^L layout: %s | Enter: Plan | Esc: Cancel) ", len(a.srcs), a.format, a.layout)
+}
+
+// cycleFormat switches to the next format and changes the extension of
+// the name with it.
+func (a *ArchiveDialog) cycleFormat(g *gocui.Gui, v *gocui.View) error {
+	name := a.name(v)
+	if strings.HasSuffix(strings.ToLower(name), a.format.Ext()) {
+		name = name[:len(name)-len(a.format.Ext())]
+	}
+	for i, format := range core.ArchiveFormats {
+		if format == a.format {
+			a.format = core.ArchiveFormats[(i+1)%len(core.ArchiveFormats)]
+			break
+		}
+	}
+	a.setName(v, name+a.format.Ext())
+	a.updateTitle(v)
+	return nil
+}
+
+func (a *ArchiveDialog) cycleLayout(g *gocui.Gui, v *gocui.View) error {
+	next := core.ArchiveLayouts[0]
+	for i, layout := range core.ArchiveLayouts {
+		if layout == a.layout {
+			next = core.ArchiveLayouts[(i+1)%len(core.ArchiveLayouts)]
+			break
+		}
+	}
+	a.layout = next
+	a.updateTitle(v)
+	return nil
+}
+
+func (a *ArchiveDialog) confirm(g *gocui.Gui, v *gocui.View) error {
+	spec := core.ArchiveSpec{Name: a.name(v), Format: a.format, Layout: a.layout}
+	if format := core.FormatFor(spec.Name); format != "" {
+		spec.Format = format // A typed extension wins
+	} else {
+		spec.Name += spec.Format.Ext()
+	}
+	srcs := a.srcs
+	if err := a.close(); err != nil {
+		return err
+	}
+	a.gui.State.ArchiveFormat = string(spec.Format)
+	a.gui.State.ArchiveLayout = string(spec.Layout)
+
+	opts := core.PutOptions{TargetDir: a.gui.State.TargetDir, Parallelism: a.gui.State.Parallelism}
+	plan := core.PlanArchive(srcs, spec, opts)
+	return a.gui.Plan.Show(plan, func(plan *core.Plan) error {
+		if err := a.gui.Jobs.Enqueue(plan, opts, a.done); err != nil {
+			a.gui.Error("Archive not started: %v", err) // Nothing was written
+			return nil
+		}
+		a.gui.Info("Queued archive of %d items into %s", len(plan.Items), plan.ArchivePath())
+		a.gui.Shelf.selected = make(map[string]struct{}) // Clear selection
+		a.gui.Shelf.Update()
+		return nil
+	})
+}
+
+// done reports a finished archive job.
+func (a *ArchiveDialog) done(job *core.Job) {
+	a.gui.reportJob(job)
+	a.gui.refreshBrowser()
+}
+
+func (a *ArchiveDialog) cancel(g *gocui.Gui, v *gocui.View) error {
+	return a.close()
+}
+
+func (a *ArchiveDialog) close() error {
+	a.srcs = nil
+	a.gui.g.Cursor = false
+	if err := a.gui.g.DeleteView("archive"); err != nil {
+		return err
+	}
+	prev := a.prevView
+	if prev == "" {
+		prev = "shelf"
+	}
+	_, err := a.gui.g.SetCurrentView(prev)
+	return err
+}
+
+// executeArchive prompts for an archive of the selected shelf items, or
+// of all of them if none is selected.
+func (s *Shelf) executeArchive(g *gocui.Gui, v *gocui.View) error {
+	if s.gui.State.TargetDir == "" {
+		s.gui.Warn("No target directory; set one with t in the browser")
+		return nil
+	}
+	targets := s.putTargets()
+	if len(targets) == 0 {
+		return nil
+	}
+	srcs := make([]string, 0, len(targets))
+	for _, item := range targets {
+		srcs = append(srcs, item.AbsPath)
+	}
+	return s.gui.Archive.Show(srcs)
+}
+
+// putTargets returns the shelf items a put acts on: the selected ones, or
+// all of them if none is selected.
+func (s *Shelf) putTargets() []store.ShelfItem {
+	if len(s.selected) == 0 {
+		return s.gui.State.ShelfItems
+	}
+	var targets []store.ShelfItem
+	for _, item := range s.gui.State.ShelfItems {
+		if _, ok := s.selected[item.ID]; ok {
+			targets = append(targets, item)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,436 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"lazycd/internal/store"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// BookmarksPanel is a modal listing State.Bookmarks to open one, make it
+// the target or edit it. It also runs the letter prompt of m (set a mark)
+// and ' (jump to a mark) in the browsers.
+type BookmarksPanel struct {
+	gui     *Gui
+	browser *Browser // Browser the panel or prompt was opened from
+
+	mark     markMode // What the letter typed into the mark prompt does
+	marked   int      // Bookmark getting a letter with markAssign
+	renaming int      // Bookmark renamed in the name prompt, -1 to add one
+}
+
+type markMode int
+
+const (
+	markSet    markMode = iota // m in a browser: mark its directory
+	markJump                   // ' in a browser: open the marked directory
+	markAssign                 // m in the panel: give the bookmark a letter
+)
+
+func NewBookmarksPanel(gui *Gui) *BookmarksPanel {
+	return &BookmarksPanel{gui: gui}
+}
+
+func (p *BookmarksPanel) Keybindings() error {
+	if err := p.gui.g.SetKeybinding("bookmarks", 'j', gocui.ModNone, p.cursorDown); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", gocui.KeyArrowDown, gocui.ModNone, p.cursorDown); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", 'k', gocui.ModNone, p.cursorUp); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", gocui.KeyArrowUp, gocui.ModNone, p.cursorUp); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", gocui.KeyEnter, gocui.ModNone, p.open); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", 't', gocui.ModNone, p.setTarget); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", 'a', gocui.ModNone, p.add); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", 'e', gocui.ModNone, p.rename); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", 'm', gocui.ModNone, p.assignMark); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", 'd', gocui.ModNone, p.remove); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmarks", gocui.KeyEsc, gocui.ModNone, p.cancel); err != nil {
+		return err
+	}
+	// Swallow global keys that would act behind the modal
+	for _, key := range []interface{}{gocui.KeyTab, 'p', 'u', 'U', 'J', 'P', 'D'} {
+		if err := p.gui.g.SetKeybinding("bookmarks", key, gocui.ModNone, noop); err != nil {
+			return err
+		}
+	}
+
+	// The mark prompt takes a single letter
+	for _, letters := range []string{"abcdefghijklmnopqrstuvwxyz", "ABCDEFGHIJKLMNOPQRSTUVWXYZ"} {
+		for _, ch := range letters {
+			mark := string(ch)
+			onLetter := func(g *gocui.Gui, v *gocui.View) error {
+				return p.onLetter(mark)
+			}
+			if err := p.gui.g.SetKeybinding("mark", ch, gocui.ModNone, onLetter); err != nil {
+				return err
+			}
+		}
+	}
+	if err := p.gui.g.SetKeybinding("mark", gocui.KeyBackspace, gocui.ModNone, p.clearMark); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("mark", gocui.KeyBackspace2, gocui.ModNone, p.clearMark); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("mark", gocui.KeyEsc, gocui.ModNone, p.cancelMark); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("mark", gocui.KeyTab, gocui.ModNone, noop); err != nil {
+		return err
+	}
+
+	if err := p.gui.g.SetKeybinding("bookmark-name", gocui.KeyEnter, gocui.ModNone, p.confirmName); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("bookmark-name", gocui.KeyEsc, gocui.ModNone, p.cancelName); err != nil {
+		return err
+	}
+	// Letters are typed into the name; other global keys are swallowed
+	return p.gui.g.SetKeybinding("bookmark-name", gocui.KeyTab, gocui.ModNone, noop)
+}
+
+// Show opens the panel for the browser of v.
+func (p *BookmarksPanel) Show(g *gocui.Gui, v *gocui.View) error {
+	p.browser = p.gui.browserOf(v)
+	maxX, maxY := g.Size()
+	bv, err := g.SetView("bookmarks", maxX/6, maxY/6, maxX*5/6, maxY*5/6, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	bv.Title = " Bookmarks (Enter: Open | t: Target | a: Add | e: Rename | m: Letter | d: Delete | Esc: Close) "
+	bv.Highlight = true
+	bv.SelBgColor = gocui.ColorGreen
+	bv.SelFgColor = gocui.ColorBlack
+	bv.SetOrigin(0, 0)
+	bv.SetCursor(0, 0)
+	p.draw(bv)
+
+	_, err = g.SetCurrentView("bookmarks")
+	return err
+}
+
+func (p *BookmarksPanel) draw(v *gocui.View) {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	v.Clear()
+	bookmarks := p.gui.State.Bookmarks
+	if len(bookmarks) == 0 {
+		fmt.Fprintln(v, "  No bookmarks; a adds the current directory, m and a letter in the browser marks it")
+		return
+	}
+
+	width := 0
+	for _, bm := range bookmarks {
+		width = max(width, utf8.RuneCountInString(bm.Name))
+	}
+	for _, bm := range bookmarks {
+		mark := bm.Mark
+		if mark == "" {
+			mark = " "
+		}
+		fmt.Fprintf(v, " %s  %-*s  %s\n", mark, width, bm.Name, bm.Dir)
+	}
+
+	// Clear moved the cursor to the top; keep it on its line
+	v.SetOrigin(0, oy)
+	v.SetCursor(0, cy)
+	if oy+cy >= len(bookmarks) {
+		v.SetOrigin(0, 0)
+		v.SetCursor(0, len(bookmarks)-1)
+	}
+}
+
+// redraw draws the panel again after a change.
+func (p *BookmarksPanel) redraw() {
+	if v, err := p.gui.g.View("bookmarks"); err == nil {
+		p.draw(v)
+	}
+}
+
+// current returns the index of the bookmark under the cursor of v, -1 if
+// there is none.
+func (p *BookmarksPanel) current(v *gocui.View) int {
+	i := cursorIndex(v)
+	if i < 0 || i >= len(p.gui.State.Bookmarks) {
+		return -1
+	}
+	return i
+}
+
+func (p *BookmarksPanel) cursorDown(g *gocui.Gui, v *gocui.View) error {
+	return listDown(v, len(p.gui.State.Bookmarks))
+}
+
+func (p *BookmarksPanel) cursorUp(g *gocui.Gui, v *gocui.View) error {
+	return listUp(v)
+}
+
+// open closes the panel and opens the bookmark in the browser.
+func (p *BookmarksPanel) open(g *gocui.Gui, v *gocui.View) error {
+	i := p.current(v)
+	if i < 0 {
+		return nil
+	}
+	dir := p.gui.State.Bookmarks[i].Dir
+	if err := p.close(); err != nil {
+		return err
+	}
+	p.changeDir(dir)
+	return nil
+}
+
+// setTarget closes the panel and makes the bookmark the target.
+func (p *BookmarksPanel) setTarget(g *gocui.Gui, v *gocui.View) error {
+	i := p.current(v)
+	if i < 0 {
+		return nil
+	}
+	dir := p.gui.State.Bookmarks[i].Dir
+	if err := p.close(); err != nil {
+		return err
+	}
+	p.gui.setTargetDir(dir)
+	return nil
+}
+
+// add asks for a name to bookmark the browser's directory under.
+func (p *BookmarksPanel) add(g *gocui.Gui, v *gocui.View) error {
+	dir := *p.browser.dir
+	if dir == "" {
+		return nil
+	}
+	for _, bm := range p.gui.State.Bookmarks {
+		if bm.Dir == dir {
+			p.gui.Info("%s is bookmarked as %s already", dir, bm.Name)
+			return nil
+		}
+	}
+	p.renaming = -1
+	return p.showName(g, filepath.Base(dir))
+}
+
+// rename asks for a new name for the bookmark.
+func (p *BookmarksPanel) rename(g *gocui.Gui, v *gocui.View) error {
+	i := p.current(v)
+	if i < 0 {
+		return nil
+	}
+	p.renaming = i
+	return p.showName(g, p.gui.State.Bookmarks[i].Name)
+}
+
+// remove deletes the bookmark.
+func (p *BookmarksPanel) remove(g *gocui.Gui, v *gocui.View) error {
+	i := p.current(v)
+	if i < 0 {
+		return nil
+	}
+	bm := p.gui.State.Bookmarks[i]
+	p.gui.State.Bookmarks = append(p.gui.State.Bookmarks[:i], p.gui.State.Bookmarks[i+1:]...)
+	p.gui.Info("Removed bookmark %s", bm.Name)
+	p.draw(v)
+	return nil
+}
+
+// assignMark asks for the letter of the bookmark.
+func (p *BookmarksPanel) assignMark(g *gocui.Gui, v *gocui.View) error {
+	i := p.current(v)
+	if i < 0 {
+		return nil
+	}
+	p.marked = i
+	return p.showMark(g, markAssign, fmt.Sprintf(" Letter for %s (Backspace: None | Esc: Cancel) ", p.gui.State.Bookmarks[i].Name))
+}
+
+func (p *BookmarksPanel) cancel(g *gocui.Gui, v *gocui.View) error {
+	return p.close()
+}
+
+func (p *BookmarksPanel) close() error {
+	if err := p.gui.g.DeleteView("bookmarks"); err != nil {
+		return err
+	}
+	_, err := p.gui.g.SetCurrentView(p.browser.view)
+	return err
+}
+
+// changeDir opens dir in the browser the panel or prompt was opened from.
+func (p *BookmarksPanel) changeDir(dir string) {
+	if bv, err := p.gui.g.View(p.browser.view); err == nil {
+		p.browser.changeDir(bv, dir)
+	}
+}
+
+// showName opens the name prompt over the panel, filled in with name.
+func (p *BookmarksPanel) showName(g *gocui.Gui, name string) error {
+	maxX, maxY := g.Size()
+	nv, err := g.SetView("bookmark-name", maxX/4, maxY/2-1, maxX*3/4, maxY/2+1, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	nv.Title = " Bookmark name (Enter: Save | Esc: Cancel) "
+	nv.Editable = true
+	nv.Wrap = false
+	nv.Clear()
+	fmt.Fprint(nv, name)
+	nv.SetCursor(utf8.RuneCountInString(name), 0)
+
+	g.Cursor = true
+	_, err = g.SetCurrentView("bookmark-name")
+	return err
+}
+
+// confirmName adds or renames the bookmark. An empty name changes nothing.
+func (p *BookmarksPanel) confirmName(g *gocui.Gui, v *gocui.View) error {
+	name := strings.TrimSpace(v.Buffer())
+	if err := p.closeName(); err != nil {
+		return err
+	}
+	if name == "" {
+		return nil
+	}
+	st := p.gui.State
+	if p.renaming < 0 {
+		st.Bookmarks = append(st.Bookmarks, store.Bookmark{Name: name, Dir: *p.browser.dir})
+		p.gui.Info("Bookmarked %s as %s", *p.browser.dir, name)
+	} else {
+		st.Bookmarks[p.renaming].Name = name
+	}
+	p.redraw()
+	return nil
+}
+
+func (p *BookmarksPanel) cancelName(g *gocui.Gui, v *gocui.View) error {
+	return p.closeName()
+}
+
+func (p *BookmarksPanel) closeName() error {
+	p.gui.g.Cursor = false
+	if err := p.gui.g.DeleteView("bookmark-name"); err != nil {
+		return err
+	}
+	_, err := p.gui.g.SetCurrentView("bookmarks")
+	return err
+}
+
+// setMark asks for the letter to mark the directory of the browser of v
+// with.
+func (p *BookmarksPanel) setMark(g *gocui.Gui, v *gocui.View) error {
+	p.browser = p.gui.browserOf(v)
+	if *p.browser.dir == "" {
+		return nil
+	}
+	return p.showMark(g, markSet, " Set mark (letter | Esc: Cancel) ")
+}
+
+// jumpToMark asks for the letter of the bookmark to open in the browser of
+// v.
+func (p *BookmarksPanel) jumpToMark(g *gocui.Gui, v *gocui.View) error {
+	p.browser = p.gui.browserOf(v)
+	return p.showMark(g, markJump, " Jump to mark (letter | Esc: Cancel) ")
+}
+
+// showMark opens the letter prompt for mode.
+func (p *BookmarksPanel) showMark(g *gocui.Gui, mode markMode, title string) error {
+	p.mark = mode
+	maxX, maxY := g.Size()
+	width := max(len(title)+2, maxX/3)
+	mv, err := g.SetView("mark", (maxX-width)/2, maxY/2-1, (maxX+width)/2, maxY/2+1, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	mv.Title = title
+	mv.Clear()
+	if marks := p.marks(); marks != "" {
+		fmt.Fprintf(mv, " Marks: %s", marks)
+	}
+	_, err = g.SetCurrentView("mark")
+	return err
+}
+
+// marks lists the letters in use.
+func (p *BookmarksPanel) marks() string {
+	var marks []string
+	for _, bm := range p.gui.State.Bookmarks {
+		if bm.Mark != "" {
+			marks = append(marks, bm.Mark)
+		}
+	}
+	return strings.Join(marks, " ")
+}
+
+// onLetter carries out the mark prompt with the letter typed.
+func (p *BookmarksPanel) onLetter(mark string) error {
+	if err := p.closeMark(); err != nil {
+		return err
+	}
+	st := p.gui.State
+	switch p.mark {
+	case markSet:
+		st.SetMark(mark, *p.browser.dir)
+		p.gui.Info("Mark %s set to %s", mark, *p.browser.dir)
+	case markJump:
+		bm := st.BookmarkByMark(mark)
+		if bm == nil {
+			p.gui.Warn("Mark %s is not set", mark)
+			return nil
+		}
+		p.changeDir(bm.Dir)
+	case markAssign:
+		st.MarkBookmark(p.marked, mark)
+		p.redraw()
+	}
+	return nil
+}
+
+// clearMark removes the letter of the bookmark in the panel.
+func (p *BookmarksPanel) clearMark(g *gocui.Gui, v *gocui.View) error {
+	if err := p.closeMark(); err != nil {
+		return err
+	}
+	if p.mark == markAssign {
+		p.gui.State.MarkBookmark(p.marked, "")
+		p.redraw()
+	}
+	return nil
+}
+
+func (p *BookmarksPanel) cancelMark(g *gocui.Gui, v *gocui.View) error {
+	return p.closeMark()
+}
+
+// closeMark closes the letter prompt, returning to the panel or browser it
+// was opened from.
+func (p *BookmarksPanel) closeMark() error {
+	if err := p.gui.g.DeleteView("mark"); err != nil {
+		return err
+	}
+	back := p.browser.view
+	if p.mark == markAssign {
+		back = "bookmarks"
+	}
+	_, err := p.gui.g.SetCurrentView(back)
+	return err
+}
@@ -3,7 +3,7 @@ package ui
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"sort"
 
 	"lazycd/internal/fs"
 	"lazycd/internal/store"
@@ -12,8 +12,13 @@ import (
 	"github.com/awesome-gocui/gocui"
 )
 
+// Browser lists a directory in a view. The main browser shows
+// State.LastDir; the target pane of dual-pane mode is a second Browser on
+// State.TargetDir, so navigating it moves the target.
 type Browser struct {
 	gui   *Gui
+	view  string  // Name of the view
+	dir   *string // The directory shown, in the state
 	items []fs.FileItem
 	
 	// Selection state
@@ -21,15 +26,44 @@ type Browser struct {
 
 	// View state
 	showHidden bool
+	sortBy     string // sortName (also ""), sortSize or sortModified
+
+	// Navigation history, newest last
+	back, forward []string
+	cursors       map[string]string // Item under the cursor when a directory was left
 }
 
+// Browser sort orders. Directories always come first.
+const (
+	sortName     = "name"
+	sortSize     = "size"     // Largest first
+	sortModified = "modified" // Newest first
+)
+
 func NewBrowser(gui *Gui) *Browser {
+	return newBrowser(gui, "browser", &gui.State.LastDir)
+}
+
+// NewTargetBrowser returns the target pane of dual-pane mode.
+func NewTargetBrowser(gui *Gui) *Browser {
+	return newBrowser(gui, "target", &gui.State.TargetDir)
+}
+
+func newBrowser(gui *Gui, view string, dir *string) *Browser {
 	return &Browser{
 		gui:      gui,
+		view:     view,
+		dir:      dir,
 		selected: make(map[string]struct{}),
+		cursors:  make(map[string]string),
 	}
 }
 
+// isTarget reports whether b is the target pane.
+func (b *Browser) isTarget() bool {
+	return b.dir == &b.gui.State.TargetDir
+}
+
 func (b *Browser) Init() error {
 	if b.gui.State.LastDir == "" {
 		cwd, err := os.Getwd()
@@ -38,14 +72,19 @@ func (b *Browser) Init() error {
 		}
 		b.gui.State.LastDir = cwd
 	}
+	b.initTabs()
+	b.gui.State.AddRecentDir(b.gui.State.LastDir)
 	
 	// Only fetch data, do not try to update view as it doesn't exist yet
 	return b.Fetch()
 }
 
 func (b *Browser) Fetch() error {
-	var err error
-	allItems, err := fs.ListDir(b.gui.State.LastDir)
+	if *b.dir == "" {
+		b.items = nil // No target yet
+		return nil
+	}
+	allItems, err := fs.ListDir(*b.dir)
 	if err != nil {
 		return err
 	}
@@ -60,9 +99,30 @@ func (b *Browser) Fetch() error {
 			}
 		}
 	}
+	sortItems(b.items, b.sortBy)
 	return nil
 }
 
+// sortItems orders items listed by name (see fs.ListDir) by the sort order
+// by, keeping directories first and names as the tie-break.
+func sortItems(items []fs.FileItem, by string) {
+	var less func(a, b fs.FileItem) bool
+	switch by {
+	case sortSize:
+		less = func(a, b fs.FileItem) bool { return a.Size > b.Size }
+	case sortModified:
+		less = func(a, b fs.FileItem) bool { return a.ModTime.After(b.ModTime) }
+	default:
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].IsDir != items[j].IsDir {
+			return items[i].IsDir
+		}
+		return less(items[i], items[j])
+	})
+}
+
 func (b *Browser) Refresh() error {
 	if err := b.Fetch(); err != nil {
 		return err
@@ -70,13 +130,30 @@ func (b *Browser) Refresh() error {
 	
 	b.UpdateView()
 	b.gui.updateStatus()
+	if v, err := b.gui.g.View(b.view); err == nil {
+		b.cursorMoved(v) // The item under the cursor may have changed
+	}
 	return nil
 }
 
 func (b *Browser) Draw(v *gocui.View) {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
 	v.Clear()
-	v.Title = fmt.Sprintf(" Browser: %s ", b.gui.State.LastDir)
-	
+	if b.isTarget() {
+		v.Title = fmt.Sprintf(" Target: %s ", *b.dir)
+		if *b.dir == "" {
+			fmt.Fprintln(v, "  No target; t in the browser sets one")
+		}
+	} else if tabs := len(b.gui.State.Tabs); tabs > 1 {
+		v.Title = fmt.Sprintf(" Browser %d/%d: %s ", b.gui.State.ActiveTab+1, tabs, *b.dir)
+	} else {
+		v.Title = fmt.Sprintf(" Browser: %s ", *b.dir)
+	}
+	if b.sortBy != "" && b.sortBy != sortName {
+		v.Title += fmt.Sprintf("(by %s) ", b.sortBy)
+	}
+
 	for _, item := range b.items {
 		mark := " "
 		if _, ok := b.selected[item.Path]; ok {
@@ -86,15 +163,24 @@ func (b *Browser) Draw(v *gocui.View) {
 		suffix := ""
 		if item.IsDir {
 			suffix = "/"
+		} else if item.Archive {
+			suffix = " [" + fs.ArchiveFormat(item.Name) + "]"
 		}
 		
 		fmt.Fprintf(v, "%s %s%s\n", mark, item.Name, suffix)
 	}
+
+	// Clear moved the cursor to the top; keep it on its line
+	v.SetOrigin(0, oy)
+	v.SetCursor(0, cy)
+	if oy+cy >= len(b.items) {
+		b.selectIndex(v, len(b.items)-1)
+	}
 }
 
 func (b *Browser) UpdateView() {
 	b.gui.g.Update(func(g *gocui.Gui) error {
-		v, err := g.View("browser")
+		v, err := g.View(b.view)
 		if err != nil {
 			return nil
 		}
@@ -104,45 +190,77 @@ func (b *Browser) UpdateView() {
 }
 
 func (b *Browser) Keybindings() error {
-	if err := b.gui.g.SetKeybinding("browser", 'j', gocui.ModNone, b.cursorDown); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, 'j', gocui.ModNone, b.cursorDown); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, gocui.KeyArrowDown, gocui.ModNone, b.cursorDown); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, 'k', gocui.ModNone, b.cursorUp); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, gocui.KeyArrowUp, gocui.ModNone, b.cursorUp); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, 'l', gocui.ModNone, b.enterDir); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, gocui.KeyArrowRight, gocui.ModNone, b.enterDir); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, 'h', gocui.ModNone, b.parentDir); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, gocui.KeyArrowLeft, gocui.ModNone, b.parentDir); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, 'g', gocui.ModNone, b.gui.Goto.Show); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", gocui.KeyArrowDown, gocui.ModNone, b.cursorDown); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, gocui.KeySpace, gocui.ModNone, b.toggleSelect); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", 'k', gocui.ModNone, b.cursorUp); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, 'a', gocui.ModNone, b.addToShelf); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", gocui.KeyArrowUp, gocui.ModNone, b.cursorUp); err != nil {
+	if b.isTarget() {
+		// The pane is the target already; p drops the shelf into it
+		if err := b.gui.g.SetKeybinding(b.view, 'p', gocui.ModNone, b.dropShelf); err != nil {
+			return err
+		}
+	} else if err := b.gui.g.SetKeybinding(b.view, 't', gocui.ModNone, b.setTarget); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", 'l', gocui.ModNone, b.enterDir); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, '.', gocui.ModNone, b.toggleHidden); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", gocui.KeyArrowRight, gocui.ModNone, b.enterDir); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, 's', gocui.ModNone, b.cycleSort); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", 'h', gocui.ModNone, b.parentDir); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, '[', gocui.ModNone, b.goBack); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", gocui.KeyArrowLeft, gocui.ModNone, b.parentDir); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, ']', gocui.ModNone, b.goForward); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", gocui.KeySpace, gocui.ModNone, b.toggleSelect); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, 'r', gocui.ModNone, b.gui.Recent.Show); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", 'a', gocui.ModNone, b.addToShelf); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, 'b', gocui.ModNone, b.gui.Marks.Show); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", 't', gocui.ModNone, b.setTarget); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, 'm', gocui.ModNone, b.gui.Marks.setMark); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", '.', gocui.ModNone, b.toggleHidden); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, '\'', gocui.ModNone, b.gui.Marks.jumpToMark); err != nil {
 		return err
 	}
-	if err := b.gui.g.SetKeybinding("browser", gocui.KeyEnter, gocui.ModNone, b.toggleDetails); err != nil {
+	if err := b.gui.g.SetKeybinding(b.view, gocui.KeyEnter, gocui.ModNone, b.toggleDetails); err != nil {
 		return err
 	}
+	if !b.isTarget() {
+		return b.tabKeybindings()
+	}
 	return nil
 }
 
@@ -164,7 +282,7 @@ func (b *Browser) cursorDown(g *gocui.Gui, v *gocui.View) error {
 					return err
 				}
 			}
-			b.updateDetailsView()
+			b.cursorMoved(v)
 		}
 	}
 	return nil
@@ -186,7 +304,7 @@ func (b *Browser) cursorUp(g *gocui.Gui, v *gocui.View) error {
 				return err
 			}
 		}
-		b.updateDetailsView()
+		b.cursorMoved(v)
 	}
 	return nil
 }
@@ -197,28 +315,90 @@ func (b *Browser) enterDir(g *gocui.Gui, v *gocui.View) error {
 		return nil
 	}
 	
-	if item.IsDir {
-		b.gui.State.LastDir = item.Path
-		if err := b.Refresh(); err != nil {
-			return err
-		}
-		v.SetCursor(0, 0)
+	if item.IsDir || item.Archive {
+		b.changeDir(v, item.Path)
 	}
 	return nil
 }
 
 func (b *Browser) parentDir(g *gocui.Gui, v *gocui.View) error {
-	parent := filepath.Dir(b.gui.State.LastDir)
-	if parent != b.gui.State.LastDir {
-		b.gui.State.LastDir = parent
-		if err := b.Refresh(); err != nil {
-			return err
-		}
-		v.SetCursor(0, 0)
+	if *b.dir == "" {
+		return nil
+	}
+	parent := fs.Dir(*b.dir)
+	if parent != *b.dir {
+		b.changeDir(v, parent)
 	}
 	return nil
 }
 
+// changeDir lists dir in the browser and remembers the directory it
+// leaves in the back history. If dir cannot be read, the browser stays
+// where it is and the error is reported.
+func (b *Browser) changeDir(v *gocui.View, dir string) {
+	prev := *b.dir
+	if !b.moveTo(v, dir) {
+		return
+	}
+	if prev != "" && prev != dir {
+		b.back = pushHistory(b.back, prev)
+		b.forward = nil
+	}
+}
+
+// moveTo lists dir in the browser without touching the history, and
+// reports whether it could. The cursor lands on the directory just left if
+// dir is its parent, else on the item it was on when dir was last left.
+// The target pane does not enter archives, which cannot be a target.
+func (b *Browser) moveTo(v *gocui.View, dir string) bool {
+	if b.isTarget() && (fs.IsArchive(dir) || fs.InArchive(dir)) {
+		b.gui.Warn("Archives are read-only and cannot be a target")
+		return false
+	}
+	prev := *b.dir
+	if item := b.currentItem(v); item != nil && prev != "" {
+		b.cursors[prev] = item.Path
+	}
+	*b.dir = dir
+	if err := b.Refresh(); err != nil {
+		*b.dir = prev
+		b.gui.Error("Cannot open %s: %v", dir, err)
+		return false
+	}
+	cursor := b.cursors[dir]
+	if prev != "" && fs.Dir(prev) == dir {
+		cursor = prev
+	}
+	b.selectIndex(v, b.indexOf(cursor))
+	b.cursorMoved(v)
+	if !b.isTarget() {
+		b.gui.State.AddRecentDir(dir)
+	}
+	return true
+}
+
+// indexOf returns the index of the item at path, 0 if it is not listed.
+func (b *Browser) indexOf(path string) int {
+	for i, item := range b.items {
+		if item.Path == path {
+			return i
+		}
+	}
+	return 0
+}
+
+// cursorMoved updates the views following the item under the cursor, if
+// they follow this browser.
+func (b *Browser) cursorMoved(v *gocui.View) {
+	if b.gui.focusedBrowser() != b {
+		return
+	}
+	b.updateDetailsView()
+	if item := b.currentItem(v); item != nil {
+		b.gui.Preview.Load(item.Path)
+	}
+}
+
 func (b *Browser) toggleSelect(g *gocui.Gui, v *gocui.View) error {
 	item := b.currentItem(v)
 	if item == nil {
@@ -273,9 +453,7 @@ func (b *Browser) updateDetailsView() {
 
 func (b *Browser) toggleHidden(g *gocui.Gui, v *gocui.View) error {
 	b.showHidden = !b.showHidden
-	if err := b.Refresh(); err != nil {
-		return err
-	}
+	b.gui.refreshBrowser()
 	// Maybe reset cursor or keep it?
 	// If the current item disappears (was hidden), we might want to check bounds.
 	// gocui cursor might stay at same index, which if out of bounds on new list might cause issue.
@@ -288,6 +466,22 @@ func (b *Browser) toggleHidden(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+// cycleSort switches the listing between name, size and modification time
+// order.
+func (b *Browser) cycleSort(g *gocui.Gui, v *gocui.View) error {
+	switch b.sortBy {
+	case sortSize:
+		b.sortBy = sortModified
+	case sortModified:
+		b.sortBy = sortName
+	default:
+		b.sortBy = sortSize
+	}
+	b.gui.Info("Sort by %s", b.sortBy)
+	b.gui.refreshBrowser()
+	return nil
+}
+
 func (b *Browser) addToShelf(g *gocui.Gui, v *gocui.View) error {
 	// Add selected items
 	count := 0
@@ -301,7 +495,7 @@ func (b *Browser) addToShelf(g *gocui.Gui, v *gocui.View) error {
 			}
 		}
 		if !exists {
-			info, err := os.Stat(path)
+			info, err := fs.Stat(path)
 			isDir := false
 			if err == nil {
 				isDir = info.IsDir()
@@ -333,6 +527,11 @@ func (b *Browser) addToShelf(g *gocui.Gui, v *gocui.View) error {
 	// But "Shelf에서 다중 선택" implies browser selection might stay?
 	// Let's keep it for now.
 	
+	if count > 0 {
+		b.gui.Info("Added %d items to the shelf", count)
+	} else {
+		b.gui.Info("Nothing new to add to the shelf")
+	}
 	b.gui.Shelf.Update()
 	b.gui.updateStatus()
 	return nil
@@ -340,17 +539,44 @@ func (b *Browser) addToShelf(g *gocui.Gui, v *gocui.View) error {
 
 func (b *Browser) setTarget(g *gocui.Gui, v *gocui.View) error {
 	// Spec: t = 현재 브라우저 디렉토리를 target으로 설정
-	b.gui.State.TargetDir = b.gui.State.LastDir
-	b.gui.updateStatus()
+	b.gui.setTargetDir(b.gui.State.LastDir)
 	return nil
 }
 
+// dropShelf puts the shelf into the directory of the target pane, like p
+// on the shelf.
+func (b *Browser) dropShelf(g *gocui.Gui, v *gocui.View) error {
+	return b.gui.Shelf.executePut(g, v)
+}
+
 func (b *Browser) currentItem(v *gocui.View) *fs.FileItem {
-	_, cy := v.Cursor()
-	_, oy := v.Origin()
-	index := cy + oy
+	index := cursorIndex(v)
 	if index >= 0 && index < len(b.items) {
 		return &b.items[index]
 	}
 	return nil
 }
+
+// cursorIndex returns the index of the line under the cursor of v.
+func cursorIndex(v *gocui.View) int {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	return cy + oy
+}
+
+// selectIndex moves the cursor of v to item i, or the last item, scrolling
+// it into view. The listing may not be drawn yet.
+func (b *Browser) selectIndex(v *gocui.View, i int) {
+	if i >= len(b.items) {
+		i = len(b.items) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	oy := 0
+	if _, vy := v.Size(); vy > 0 && i >= vy {
+		oy = i - vy + 1
+	}
+	v.SetOrigin(0, oy)
+	v.SetCursorUnrestricted(0, i-oy) // The view may still hold the old listing
+}
@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"path/filepath"
+	"strings"
+
+	"lazycd/internal/fs"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// GotoPrompt asks for a directory to open in the browser it was opened
+// from: a local path, ~/dir, a remote user@host:/dir or an
+// s3://bucket/prefix. Relative paths start in that browser's directory.
+type GotoPrompt struct {
+	gui     *Gui
+	browser *Browser
+}
+
+func NewGotoPrompt(gui *Gui) *GotoPrompt {
+	return &GotoPrompt{gui: gui}
+}
+
+func (p *GotoPrompt) Keybindings() error {
+	if err := p.gui.g.SetKeybinding("goto", gocui.KeyEnter, gocui.ModNone, p.confirm); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("goto", gocui.KeyEsc, gocui.ModNone, p.cancel); err != nil {
+		return err
+	}
+	// Letters are typed into the path; other global keys are swallowed
+	return p.gui.g.SetKeybinding("goto", gocui.KeyTab, gocui.ModNone, noop)
+}
+
+// Show opens the prompt for the browser of v.
+func (p *GotoPrompt) Show(g *gocui.Gui, v *gocui.View) error {
+	p.browser = p.gui.browserOf(v)
+	maxX, maxY := g.Size()
+	pv, err := g.SetView("goto", maxX/6, maxY/2-1, maxX*5/6, maxY/2+1, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	pv.Title = " Go to (path, user@host:/dir or s3://bucket | Enter: Open | Esc: Cancel) "
+	pv.Editable = true
+	pv.Wrap = false
+	pv.Clear()
+	pv.SetCursor(0, 0)
+
+	g.Cursor = true
+	_, err = g.SetCurrentView("goto")
+	return err
+}
+
+func (p *GotoPrompt) confirm(g *gocui.Gui, v *gocui.View) error {
+	input := strings.TrimSpace(v.Buffer())
+	if err := p.close(); err != nil {
+		return err
+	}
+	if input == "" {
+		return nil
+	}
+	if !filepath.IsAbs(input) && !strings.HasPrefix(input, "~") && !fs.IsRemote(input) && !fs.IsS3(input) {
+		input = filepath.Join(*p.browser.dir, input)
+	}
+
+	dir, err := fs.ResolvePath(input)
+	if err != nil {
+		p.gui.Error("Cannot open %s: %v", input, err)
+		return nil
+	}
+	if info, err := fs.Stat(dir); err != nil {
+		p.gui.Error("Cannot open %s: %v", dir, err)
+		return nil
+	} else if !info.IsDir() && !fs.IsArchive(dir) {
+		p.gui.Error("Cannot open %s: not a directory", dir)
+		return nil
+	}
+
+	bv, err := g.View(p.browser.view)
+	if err != nil {
+		return err
+	}
+	p.browser.changeDir(bv, dir)
+	return nil
+}
+
+func (p *GotoPrompt) cancel(g *gocui.Gui, v *gocui.View) error {
+	return p.close()
+}
+
+func (p *GotoPrompt) close() error {
+	p.gui.g.Cursor = false
+	if err := p.gui.g.DeleteView("goto"); err != nil {
+		return err
+	}
+	_, err := p.gui.g.SetCurrentView(p.browser.view)
+	return err
+}
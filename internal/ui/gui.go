@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"lazycd/internal/core"
+	"lazycd/internal/fs"
 	"lazycd/internal/store"
 
 	"github.com/awesome-gocui/gocui"
@@ -15,9 +16,24 @@ type Gui struct {
 	JobMgr *core.JobManager
 
 	Browser *Browser
+	Target  *Browser // Target pane of dual-pane mode
 	Shelf   *Shelf
+	Plan    *PlanView
+	Jobs    *JobsPanel
+	Undo    *UndoView
+	Archive *ArchiveDialog
+	Goto    *GotoPrompt
+	Recent  *RecentList
+	Marks   *BookmarksPanel
+
+	Messages *Messages
+	Preview  *PreviewPane
 	
 	ShowDetails bool
+	ShowJobs    bool
+	ShowLog     bool
+	ShowPreview bool
+	ShowTarget  bool // Dual-pane mode
 }
 
 func NewGui(state *store.State, jobMgr *core.JobManager) *Gui {
@@ -40,7 +56,17 @@ func (gui *Gui) Run() error {
 	g.InputEsc = true
 
 	gui.Browser = NewBrowser(gui)
+	gui.Target = NewTargetBrowser(gui)
 	gui.Shelf = NewShelf(gui)
+	gui.Plan = NewPlanView(gui)
+	gui.Jobs = NewJobsPanel(gui)
+	gui.Undo = NewUndoView(gui)
+	gui.Archive = NewArchiveDialog(gui)
+	gui.Goto = NewGotoPrompt(gui)
+	gui.Recent = NewRecentList(gui)
+	gui.Marks = NewBookmarksPanel(gui)
+	gui.Messages = NewMessages(gui)
+	gui.Preview = NewPreviewPane(gui)
 
 	g.SetManagerFunc(gui.layout)
 
@@ -52,9 +78,20 @@ func (gui *Gui) Run() error {
 		return err
 	}
 
+	stop := make(chan struct{})
+	gui.Jobs.Watch(stop)
+	defer func() {
+		close(stop)
+		// Leave no transfer half done behind
+		gui.JobMgr.CancelAll()
+	}()
+
 	if err := g.MainLoop(); err != nil && err != gocui.ErrQuit {
 		return err
 	}
+	if v, err := g.View("browser"); err == nil {
+		gui.Browser.saveTab(v) // Restored on the next start
+	}
 	return nil
 }
 
@@ -67,13 +104,29 @@ func (gui *Gui) layout(g *gocui.Gui) error {
 
 	// Calculate main view area
 	mainBottom := statusTop
+
+	if gui.ShowLog {
+		// Message log sits right above the status bar
+		logTop := statusTop - 8
+		mainBottom = logTop
+
+		if v, err := g.SetView("log", 0, logTop, maxX-1, statusTop, 0); err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			v.Wrap = true
+			gui.Messages.draw(v)
+		}
+	} else {
+		g.DeleteView("log")
+	}
 	
 	if gui.ShowDetails {
 		// If details are shown, reserve space above status
 		// Let's say details take 6 lines
 		detailsHeight := 6
-		detailsTop := statusTop - detailsHeight
-		detailsBottom := statusTop
+		detailsTop := mainBottom - detailsHeight
+		detailsBottom := mainBottom
 		
 		mainBottom = detailsTop
 		
@@ -89,8 +142,21 @@ func (gui *Gui) layout(g *gocui.Gui) error {
 		g.DeleteView("details")
 	}
 
-	// Browser view (Left)
-	if v, err := g.SetView("browser", 0, 0, maxX/2-1, mainBottom, 0); err != nil {
+	// Browser view (Left), followed by the preview and target panes if
+	// shown; they share the space left of the shelf evenly
+	rightX := maxX / 2
+	panes := 1
+	if gui.ShowPreview {
+		rightX = maxX * 2 / 3
+		panes++
+	}
+	if gui.ShowTarget {
+		rightX = maxX * 3 / 4
+		panes++
+	}
+	paneX := func(i int) int { return rightX * i / panes }
+	browserRight := paneX(1) - 1
+	if v, err := g.SetView("browser", 0, 0, browserRight, mainBottom, 0); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
@@ -100,20 +166,66 @@ func (gui *Gui) layout(g *gocui.Gui) error {
 		v.SelFgColor = gocui.ColorBlack
 		
 		gui.Browser.Draw(v)
+		gui.Browser.restoreCursor(v)
 		
 		if _, err := g.SetCurrentView("browser"); err != nil {
 			return err
 		}
 	}
 
-	// Shelf view (Right)
-	if v, err := g.SetView("shelf", maxX/2, 0, maxX-1, mainBottom, 0); err != nil {
+	pane := 1
+	if gui.ShowPreview {
+		if v, err := g.SetView("preview", paneX(pane), 0, paneX(pane+1)-1, mainBottom, 0); err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			gui.Preview.draw(v)
+		}
+		pane++
+	} else {
+		g.DeleteView("preview")
+	}
+
+	if gui.ShowTarget {
+		if v, err := g.SetView("target", paneX(pane), 0, paneX(pane+1)-1, mainBottom, 0); err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			v.Highlight = true
+			v.SelBgColor = gocui.ColorGreen
+			v.SelFgColor = gocui.ColorBlack
+			gui.Target.Draw(v)
+		}
+	} else {
+		g.DeleteView("target")
+	}
+
+	// Shelf view (Right), sharing the column with the jobs panel
+	shelfBottom := mainBottom
+	if gui.ShowJobs {
+		shelfBottom = mainBottom / 2
+	}
+	if v, err := g.SetView("shelf", rightX, 0, maxX-1, shelfBottom, 0); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
 		v.Title = fmt.Sprintf(" Shelf (%d) ", len(gui.State.ShelfItems))
 	}
 
+	if gui.ShowJobs {
+		if v, err := g.SetView("jobs", rightX, shelfBottom+1, maxX-1, mainBottom, 0); err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			v.Highlight = true
+			v.SelBgColor = gocui.ColorGreen
+			v.SelFgColor = gocui.ColorBlack
+			gui.Jobs.draw(v)
+		}
+	} else {
+		g.DeleteView("jobs")
+	}
+
 	// Status view (Bottom)
 	if v, err := g.SetView("status", 0, statusTop, maxX-1, statusBottom, 0); err != nil {
 		if err != gocui.ErrUnknownView {
@@ -148,25 +260,118 @@ func (gui *Gui) keybindings() error {
 	if err := gui.g.SetKeybinding("", 'u', gocui.ModNone, gui.undoLastJob); err != nil {
 		return err
 	}
+	if err := gui.g.SetKeybinding("", 'U', gocui.ModNone, gui.Undo.showLast); err != nil {
+		return err
+	}
+	if err := gui.g.SetKeybinding("", 'D', gocui.ModNone, gui.toggleDualPane); err != nil {
+		return err
+	}
 	
 	if err := gui.Browser.Keybindings(); err != nil {
 		return err
 	}
+
+	if err := gui.Target.Keybindings(); err != nil {
+		return err
+	}
 	
 	if err := gui.Shelf.Keybindings(); err != nil {
 		return err
 	}
+	
+	if err := gui.Plan.Keybindings(); err != nil {
+		return err
+	}
+
+	if err := gui.Jobs.Keybindings(); err != nil {
+		return err
+	}
+
+	if err := gui.Undo.Keybindings(); err != nil {
+		return err
+	}
+
+	if err := gui.Archive.Keybindings(); err != nil {
+		return err
+	}
+
+	if err := gui.Goto.Keybindings(); err != nil {
+		return err
+	}
+
+	if err := gui.Recent.Keybindings(); err != nil {
+		return err
+	}
+
+	if err := gui.Marks.Keybindings(); err != nil {
+		return err
+	}
+
+	if err := gui.Messages.Keybindings(); err != nil {
+		return err
+	}
+
+	if err := gui.Preview.Keybindings(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// nextView focuses the next panel from left to right, then top to bottom.
 func (gui *Gui) nextView(g *gocui.Gui, v *gocui.View) error {
-	if v == nil || v.Name() == "browser" {
-		_, err := g.SetCurrentView("shelf")
+	order := []string{"browser"}
+	if gui.ShowPreview {
+		order = append(order, "preview")
+	}
+	if gui.ShowTarget {
+		order = append(order, "target")
+	}
+	order = append(order, "shelf")
+	if gui.ShowJobs {
+		order = append(order, "jobs")
+	}
+	if gui.ShowLog {
+		order = append(order, "log")
+	}
+
+	next := order[1]
+	if v != nil {
+		for i, name := range order {
+			if name == v.Name() {
+				next = order[(i+1)%len(order)]
+			}
+		}
+	}
+	cv, err := g.SetCurrentView(next)
+	if err != nil {
 		return err
 	}
-	_, err := g.SetCurrentView("browser")
-	return err
+	if b := gui.focusedBrowser(); cv.Name() == b.view {
+		b.cursorMoved(cv) // The preview follows the focused browser
+	}
+	return nil
+}
+
+// toggleDualPane shows or hides the target pane. Without a target it
+// starts in the browser's directory, which becomes the target.
+func (gui *Gui) toggleDualPane(g *gocui.Gui, v *gocui.View) error {
+	gui.ShowTarget = !gui.ShowTarget
+	if !gui.ShowTarget {
+		if v != nil && v.Name() == "target" {
+			_, err := g.SetCurrentView("browser")
+			return err
+		}
+		return nil
+	}
+	if gui.State.TargetDir == "" && !fs.IsArchive(gui.State.LastDir) && !fs.InArchive(gui.State.LastDir) {
+		gui.State.TargetDir = gui.State.LastDir
+		gui.Info("Target set to %s", gui.State.TargetDir)
+	}
+	if err := gui.Target.Fetch(); err != nil {
+		gui.Error("Cannot list %s: %v", gui.State.TargetDir, err)
+	}
+	return nil
 }
 
 func failQuit(g *gocui.Gui, v *gocui.View) error {
@@ -194,27 +399,67 @@ func (gui *Gui) toggleHelp(g *gocui.Gui, v *gocui.View) error {
 	v.Title = " Help (Close: ?) "
 	
 	fmt.Fprintln(v, "Global Keys:")
-	fmt.Fprintln(v, "  Tab: Switch View (Browser <-> Shelf)")
+	fmt.Fprintln(v, "  Tab: Switch View (Browser -> Preview -> Target -> Shelf -> Jobs -> Messages)")
 	fmt.Fprintln(v, "  ?: Toggle Help")
 	fmt.Fprintln(v, "  u: Undo last job")
+	fmt.Fprintln(v, "  U: Show result of last undo")
+	fmt.Fprintln(v, "  J: Toggle Jobs panel")
+	fmt.Fprintln(v, "  L: Toggle Messages log (j/k to scroll)")
+	fmt.Fprintln(v, "  P: Toggle Preview pane (j/k to scroll)")
+	fmt.Fprintln(v, "  D: Toggle dual-pane mode (Target pane next to the Browser)")
 	fmt.Fprintln(v, "  q: Quit")
 	fmt.Fprintln(v, "")
 	fmt.Fprintln(v, "Browser Keys:")
 	fmt.Fprintln(v, "  j/k/Down/Up: Navigation")
 	fmt.Fprintln(v, "  l/Right: Enter Directory")
 	fmt.Fprintln(v, "  h/Left: Parent Directory")
+	fmt.Fprintln(v, "  g: Go to path (local, user@host:/dir or s3://bucket)")
+	fmt.Fprintln(v, "  [/]: Back/Forward")
+	fmt.Fprintln(v, "  r: Recent directories")
+	fmt.Fprintln(v, "  b: Bookmarks panel")
+	fmt.Fprintln(v, "  m<letter>: Mark directory, '<letter>: Jump to mark")
 	fmt.Fprintln(v, "  Space: Multi-select")
 	fmt.Fprintln(v, "  a: Add to Shelf")
 	fmt.Fprintln(v, "  t: Set Target")
 	fmt.Fprintln(v, "  .: Toggle Hidden Files")
+	fmt.Fprintln(v, "  s: Cycle sort order (name/size/modified)")
 	fmt.Fprintln(v, "  Enter: Toggle Details")
+	fmt.Fprintln(v, "  1-9: Switch tab")
+	fmt.Fprintln(v, "  Ctrl+T/Ctrl+W: Open/Close tab")
+	fmt.Fprintln(v, "")
+	fmt.Fprintln(v, "Target Pane Keys (dual-pane mode):")
+	fmt.Fprintln(v, "  Browser keys move the Target instead of the Browser (no t, no tabs)")
+	fmt.Fprintln(v, "  p: Drop Shelf items into the Target")
 	fmt.Fprintln(v, "")
 	fmt.Fprintln(v, "Shelf Keys:")
 	fmt.Fprintln(v, "  y: Set mode to Copy")
 	fmt.Fprintln(v, "  x: Set mode to Move")
+	fmt.Fprintln(v, "  c: Cycle conflict policy (skip/rename/overwrite/newer/larger/size-differs/skip-identical)")
+	fmt.Fprintln(v, "  v: Cycle verify mode (off/xxhash/blake3/sha256)")
+	fmt.Fprintln(v, "  n: Cycle name sanitization (auto/always/off)")
 	fmt.Fprintln(v, "  r: Remove from Shelf")
 	fmt.Fprintln(v, "  d: Delete items")
 	fmt.Fprintln(v, "  p: Put items to Target")
+	fmt.Fprintln(v, "  A: Put items to Target as an archive (^F format, ^L layout)")
+	fmt.Fprintln(v, "  R: Resume interrupted transfers in Target")
+	fmt.Fprintln(v, "")
+	fmt.Fprintln(v, "Bookmarks Panel (b):")
+	fmt.Fprintln(v, "  Enter: Open | t: Set as Target")
+	fmt.Fprintln(v, "  a: Add current directory | e: Rename | m: Set letter | d: Delete")
+	fmt.Fprintln(v, "")
+	fmt.Fprintln(v, "Jobs Keys:")
+	fmt.Fprintln(v, "  Space: Pause/Resume job")
+	fmt.Fprintln(v, "  x: Cancel job")
+	fmt.Fprintln(v, "  +/-: Move queued job up/down")
+	fmt.Fprintln(v, "")
+	fmt.Fprintln(v, "Plan Review (shown before Put/Delete):")
+	fmt.Fprintln(v, "  Space: Change item outcome (skip/rename/overwrite)")
+	fmt.Fprintln(v, "  Enter/y: Run plan")
+	fmt.Fprintln(v, "  Esc/n: Cancel")
+	fmt.Fprintln(v, "")
+	fmt.Fprintln(v, "Undo (shown if items changed since the job):")
+	fmt.Fprintln(v, "  y/Enter: Undo anyway")
+	fmt.Fprintln(v, "  Esc/n: Cancel (closes the result view too)")
 
 	if _, err := g.SetCurrentView("help"); err != nil {
 		return err
@@ -229,6 +474,20 @@ func (gui *Gui) updateStatus() {
 		return
 	}
 	v.Clear()
+
+	v.BgColor = gocui.ColorBlue
+	v.FgColor = gocui.ColorWhite
+	if msg := gui.Messages.Toast(); msg != nil {
+		switch msg.Severity {
+		case SeverityError:
+			v.BgColor = gocui.ColorRed
+		case SeverityWarning:
+			v.BgColor = gocui.ColorYellow
+			v.FgColor = gocui.ColorBlack
+		}
+		fmt.Fprintf(v, " %s | L: Messages | ?: Help | q: Quit", msg.Text)
+		return
+	}
 	
 	cwd := gui.State.LastDir
 	target := gui.State.TargetDir
@@ -236,22 +495,96 @@ func (gui *Gui) updateStatus() {
 		target = "(none)"
 	}
 	
-	fmt.Fprintf(v, " CWD: %s | Target: %s | Tab: Switch View | ?: Help | q: Quit", cwd, target)
+	verify := core.HashAlgo(gui.State.VerifyAlgo)
+	
+	fmt.Fprintf(v, " CWD: %s | Target: %s | Conflict: %s | Verify: %s | Names: %s | Tab: Switch View | ?: Help | q: Quit", cwd, target, gui.conflictPolicy(), verify, gui.sanitizeMode())
+}
+
+// focusedBrowser returns the browser the details and preview follow: the
+// target pane while it has the focus, the main browser otherwise.
+func (gui *Gui) focusedBrowser() *Browser {
+	if v := gui.g.CurrentView(); v != nil && v.Name() == gui.Target.view {
+		return gui.Target
+	}
+	return gui.Browser
+}
+
+// browserOf returns the browser a prompt opened from v acts on: the target
+// pane if v is its view, the main browser otherwise.
+func (gui *Gui) browserOf(v *gocui.View) *Browser {
+	if v != nil && v.Name() == gui.Target.view {
+		return gui.Target
+	}
+	return gui.Browser
+}
+
+// setTargetDir makes dir the target, moving the target pane there if it is
+// shown, and reports whether it could. Archives cannot be a target, and
+// neither can a directory the pane cannot list.
+func (gui *Gui) setTargetDir(dir string) bool {
+	if fs.IsArchive(dir) || fs.InArchive(dir) {
+		gui.Warn("Archives are read-only and cannot be a target")
+		return false
+	}
+	if tv, err := gui.g.View("target"); err == nil {
+		gui.Target.changeDir(tv, dir)
+		if gui.State.TargetDir != dir {
+			return false // Not listable, reported
+		}
+	} else {
+		gui.State.TargetDir = dir
+	}
+	gui.Info("Target set to %s", dir)
+	gui.updateStatus()
+	return true
+}
+
+// refreshBrowser reloads the browser listing, and the target pane if
+// shown, and reports a failure.
+func (gui *Gui) refreshBrowser() {
+	if gui.Browser == nil {
+		return
+	}
+	if err := gui.Browser.Refresh(); err != nil {
+		gui.Error("Cannot list %s: %v", gui.State.LastDir, err)
+	}
+	if gui.ShowTarget {
+		if err := gui.Target.Refresh(); err != nil {
+			gui.Error("Cannot list %s: %v", gui.State.TargetDir, err)
+		}
+	}
+}
+
+// sanitizeMode returns the configured filename sanitization, Auto if unset.
+func (gui *Gui) sanitizeMode() core.SanitizeMode {
+	mode := core.SanitizeMode(gui.State.Sanitize)
+	if !mode.Valid() {
+		return core.SanitizeAuto
+	}
+	return mode
+}
+
+// conflictPolicy returns the configured Put conflict policy, Skip if unset.
+func (gui *Gui) conflictPolicy() core.ConflictPolicy {
+	policy := core.ConflictPolicy(gui.State.ConflictPolicy)
+	if !policy.Valid() {
+		return core.PolicySkip
+	}
+	return policy
 }
 
 func (gui *Gui) updateDetails(v *gocui.View) {
 	v.Clear()
 	
-	// Get current file from Browser
-	// We need to access Browser's current item. 
-	// But Browser.currentItem takes a View. We can get "browser" view from g.
-	bv, err := gui.g.View("browser")
+	// Get current file from the focused browser
+	b := gui.focusedBrowser()
+	bv, err := gui.g.View(b.view)
 	if err != nil {
 		fmt.Fprintln(v, "No selection")
 		return
 	}
 	
-	item := gui.Browser.currentItem(bv)
+	item := b.currentItem(bv)
 	if item == nil {
 		fmt.Fprintln(v, "No selection")
 		return
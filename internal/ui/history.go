@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"github.com/awesome-gocui/gocui"
+)
+
+const maxHistory = 50 // Directories kept in each of back and forward
+
+// pushHistory appends dir to a back or forward stack, dropping the oldest
+// entry when it is full.
+func pushHistory(stack []string, dir string) []string {
+	if n := len(stack); n > 0 && stack[n-1] == dir {
+		return stack
+	}
+	stack = append(stack, dir)
+	if len(stack) > maxHistory {
+		stack = stack[len(stack)-maxHistory:]
+	}
+	return stack
+}
+
+// goBack returns to the directory the browser was in before. One that
+// cannot be listed any more is reported and dropped from the history.
+func (b *Browser) goBack(g *gocui.Gui, v *gocui.View) error {
+	if len(b.back) == 0 {
+		b.gui.Info("No earlier directory")
+		return nil
+	}
+	dir := b.back[len(b.back)-1]
+	b.back = b.back[:len(b.back)-1]
+	prev := *b.dir
+	if b.moveTo(v, dir) && prev != "" {
+		b.forward = pushHistory(b.forward, prev)
+	}
+	return nil
+}
+
+// goForward undoes a goBack.
+func (b *Browser) goForward(g *gocui.Gui, v *gocui.View) error {
+	if len(b.forward) == 0 {
+		b.gui.Info("No later directory")
+		return nil
+	}
+	dir := b.forward[len(b.forward)-1]
+	b.forward = b.forward[:len(b.forward)-1]
+	prev := *b.dir
+	if b.moveTo(v, dir) && prev != "" {
+		b.back = pushHistory(b.back, prev)
+	}
+	return nil
+}
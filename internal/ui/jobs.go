@@ -0,0 +1,268 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lazycd/internal/core"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// JobsPanel lists the jobs queued this session with their progress and
+// controls them.
+type JobsPanel struct {
+	gui *Gui
+
+	// Callbacks run on the UI goroutine once the job with the ID is done
+	onDone map[string]func(job *core.Job)
+}
+
+func NewJobsPanel(gui *Gui) *JobsPanel {
+	return &JobsPanel{
+		gui:    gui,
+		onDone: make(map[string]func(job *core.Job)),
+	}
+}
+
+func (j *JobsPanel) Keybindings() error {
+	if err := j.gui.g.SetKeybinding("", 'J', gocui.ModNone, j.toggle); err != nil {
+		return err
+	}
+	if err := j.gui.g.SetKeybinding("jobs", 'j', gocui.ModNone, j.cursorDown); err != nil {
+		return err
+	}
+	if err := j.gui.g.SetKeybinding("jobs", gocui.KeyArrowDown, gocui.ModNone, j.cursorDown); err != nil {
+		return err
+	}
+	if err := j.gui.g.SetKeybinding("jobs", 'k', gocui.ModNone, j.cursorUp); err != nil {
+		return err
+	}
+	if err := j.gui.g.SetKeybinding("jobs", gocui.KeyArrowUp, gocui.ModNone, j.cursorUp); err != nil {
+		return err
+	}
+	if err := j.gui.g.SetKeybinding("jobs", gocui.KeySpace, gocui.ModNone, j.togglePause); err != nil {
+		return err
+	}
+	if err := j.gui.g.SetKeybinding("jobs", 'x', gocui.ModNone, j.cancel); err != nil {
+		return err
+	}
+	if err := j.gui.g.SetKeybinding("jobs", '+', gocui.ModNone, j.moveUp); err != nil {
+		return err
+	}
+	if err := j.gui.g.SetKeybinding("jobs", '-', gocui.ModNone, j.moveDown); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Watch hooks the panel up to the job manager and redraws it while jobs
+// are active, until stop is closed.
+func (j *JobsPanel) Watch(stop <-chan struct{}) {
+	j.gui.JobMgr.OnChange = func(job *core.Job) {
+		j.gui.g.Update(func(g *gocui.Gui) error {
+			j.jobChanged(job)
+			return nil
+		})
+	}
+
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if j.gui.JobMgr.Active() > 0 {
+					j.Update()
+				}
+			}
+		}
+	}()
+}
+
+// Enqueue queues a plan as a background job and shows the panel. done, if
+// not nil, runs on the UI goroutine once the job is done.
+func (j *JobsPanel) Enqueue(plan *core.Plan, opts core.PutOptions, done func(job *core.Job)) error {
+	job, err := j.gui.JobMgr.Enqueue(plan, opts)
+	if err != nil {
+		return err
+	}
+	if done != nil {
+		j.onDone[job.ID] = done
+	}
+	j.gui.ShowJobs = true
+	j.Update()
+	return nil
+}
+
+func (j *JobsPanel) jobChanged(job *core.Job) {
+	if job.Progress().State.Done() {
+		if done, ok := j.onDone[job.ID]; ok {
+			delete(j.onDone, job.ID)
+			done(job)
+		}
+	}
+	j.Update()
+}
+
+// reportJob posts the outcome of a finished job: one message per failed
+// item, then a summary.
+func (gui *Gui) reportJob(job *core.Job) {
+	ok, failed, skipped := 0, 0, 0
+	for _, item := range job.Items {
+		switch item.Status {
+		case core.StatusOK:
+			ok++
+		case core.StatusError:
+			failed++
+			gui.Error("%s %s: %s", item.Op, item.Src, item.Error)
+		case core.StatusSkipped:
+			skipped++
+		}
+	}
+
+	name := strings.ToUpper(string(job.Type[:1])) + string(job.Type[1:])
+	summary := fmt.Sprintf("%s %s: %d ok, %d failed, %d skipped", name, job.State, ok, failed, skipped)
+	if job.State == "" {
+		summary = fmt.Sprintf("%s: %d ok, %d failed, %d skipped", name, ok, failed, skipped)
+	}
+	switch {
+	case job.SaveErr() != nil:
+		gui.Error("%s; job record not saved, undo may not work: %v", summary, job.SaveErr())
+	case failed > 0:
+		gui.Error("%s", summary)
+	case job.State == core.JobCanceled:
+		gui.Warn("%s", summary)
+	default:
+		gui.Info("%s", summary)
+	}
+}
+
+func (j *JobsPanel) toggle(g *gocui.Gui, v *gocui.View) error {
+	j.gui.ShowJobs = !j.gui.ShowJobs
+	if !j.gui.ShowJobs && v != nil && v.Name() == "jobs" {
+		_, err := g.SetCurrentView("shelf")
+		return err
+	}
+	return nil
+}
+
+func (j *JobsPanel) cursorDown(g *gocui.Gui, v *gocui.View) error {
+	cx, cy := v.Cursor()
+	if cy < len(j.gui.JobMgr.Jobs())-1 {
+		return v.SetCursor(cx, cy+1)
+	}
+	return nil
+}
+
+func (j *JobsPanel) cursorUp(g *gocui.Gui, v *gocui.View) error {
+	cx, cy := v.Cursor()
+	if cy > 0 {
+		return v.SetCursor(cx, cy-1)
+	}
+	return nil
+}
+
+func (j *JobsPanel) currentJob(v *gocui.View) *core.Job {
+	jobs := j.gui.JobMgr.Jobs()
+	_, cy := v.Cursor()
+	if cy >= 0 && cy < len(jobs) {
+		return jobs[cy]
+	}
+	return nil
+}
+
+func (j *JobsPanel) togglePause(g *gocui.Gui, v *gocui.View) error {
+	job := j.currentJob(v)
+	if job == nil {
+		return nil
+	}
+	switch job.Progress().State {
+	case core.JobPaused:
+		j.gui.JobMgr.Resume(job)
+		j.gui.Info("Resumed %s job", job.Type)
+	case core.JobQueued, core.JobRunning:
+		j.gui.JobMgr.Pause(job)
+		j.gui.Info("Paused %s job", job.Type)
+	}
+	return nil
+}
+
+func (j *JobsPanel) cancel(g *gocui.Gui, v *gocui.View) error {
+	if job := j.currentJob(v); job != nil && !job.Progress().State.Done() {
+		j.gui.JobMgr.Cancel(job)
+		j.gui.Info("Canceling %s job", job.Type)
+	}
+	return nil
+}
+
+func (j *JobsPanel) moveUp(g *gocui.Gui, v *gocui.View) error {
+	return j.move(v, -1)
+}
+
+func (j *JobsPanel) moveDown(g *gocui.Gui, v *gocui.View) error {
+	return j.move(v, 1)
+}
+
+// move reorders the job under the cursor and keeps the cursor on it.
+func (j *JobsPanel) move(v *gocui.View, delta int) error {
+	job := j.currentJob(v)
+	if job == nil || !j.gui.JobMgr.MoveQueued(job, delta) {
+		return nil
+	}
+	cx, _ := v.Cursor()
+	for i, other := range j.gui.JobMgr.Jobs() {
+		if other == job {
+			v.SetCursor(cx, i)
+		}
+	}
+	j.Update()
+	return nil
+}
+
+// Update redraws the panel on the UI goroutine; it is safe to call from
+// any goroutine.
+func (j *JobsPanel) Update() {
+	j.gui.g.Update(func(g *gocui.Gui) error {
+		if v, err := g.View("jobs"); err == nil {
+			j.draw(v)
+		}
+		return nil // Panel hidden otherwise
+	})
+}
+
+func (j *JobsPanel) draw(v *gocui.View) {
+	v.Clear()
+	jobs := j.gui.JobMgr.Jobs()
+	v.Title = fmt.Sprintf(" Jobs (%d active) ", j.gui.JobMgr.Active())
+
+	for _, job := range jobs {
+		p := job.Progress()
+		pct := 100
+		switch {
+		case p.Bytes > 0:
+			pct = int(p.BytesDone * 100 / p.Bytes)
+		case p.Items > 0:
+			pct = p.ItemsDone * 100 / p.Items
+		}
+
+		line := fmt.Sprintf("%-8s %-6s %3d%% %d/%d items", p.State, job.Type, pct, p.ItemsDone, p.Items)
+		if p.Bytes > 0 {
+			line += fmt.Sprintf("  %s/%s", formatBytes(p.BytesDone), formatBytes(p.Bytes))
+		}
+		if p.Failed > 0 {
+			line += fmt.Sprintf("  %d failed", p.Failed)
+		}
+		if job.TargetDir != "" {
+			line += "  -> " + filepath.Base(job.TargetDir)
+		}
+		fmt.Fprintln(v, line)
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintln(v, "No jobs this session")
+	}
+}
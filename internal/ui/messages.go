@@ -0,0 +1,200 @@
+package ui
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// Severity ranks a message.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warn"
+	case SeverityError:
+		return "error"
+	}
+	return "info"
+}
+
+// Message is one entry of the message log.
+type Message struct {
+	Time     time.Time
+	Severity Severity
+	Text     string
+}
+
+// toastDuration is how long a message stays in the status bar.
+const toastDuration = 4 * time.Second
+
+// Messages is the message bus of the session. Actions report into it from
+// any goroutine; the newest message is shown in the status bar for
+// toastDuration and all of them are kept for the log panel.
+type Messages struct {
+	gui *Gui
+
+	mu       sync.Mutex
+	log      []Message
+	toast    *Message // Shown in the status bar until it expires
+	toastSeq int
+
+	follow bool // Log panel keeps the newest message in view
+}
+
+func NewMessages(gui *Gui) *Messages {
+	return &Messages{gui: gui, follow: true}
+}
+
+func (m *Messages) Keybindings() error {
+	if err := m.gui.g.SetKeybinding("", 'L', gocui.ModNone, m.toggle); err != nil {
+		return err
+	}
+	if err := m.gui.g.SetKeybinding("log", 'j', gocui.ModNone, m.scrollDown); err != nil {
+		return err
+	}
+	if err := m.gui.g.SetKeybinding("log", gocui.KeyArrowDown, gocui.ModNone, m.scrollDown); err != nil {
+		return err
+	}
+	if err := m.gui.g.SetKeybinding("log", 'k', gocui.ModNone, m.scrollUp); err != nil {
+		return err
+	}
+	if err := m.gui.g.SetKeybinding("log", gocui.KeyArrowUp, gocui.ModNone, m.scrollUp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Post adds a message to the log and shows it as a toast.
+func (m *Messages) Post(severity Severity, text string) {
+	m.mu.Lock()
+	msg := Message{Time: time.Now(), Severity: severity, Text: text}
+	m.log = append(m.log, msg)
+	m.toast = &msg
+	m.toastSeq++
+	seq := m.toastSeq
+	m.mu.Unlock()
+
+	m.redraw()
+	time.AfterFunc(toastDuration, func() {
+		m.mu.Lock()
+		expired := m.toastSeq == seq
+		if expired {
+			m.toast = nil
+		}
+		m.mu.Unlock()
+		if expired {
+			m.redraw()
+		}
+	})
+}
+
+// Toast returns the message to show in the status bar, nil if none.
+func (m *Messages) Toast() *Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.toast
+}
+
+// Info, Warn and Error post a formatted message with the severity.
+func (gui *Gui) Info(format string, args ...interface{}) {
+	gui.Messages.Post(SeverityInfo, fmt.Sprintf(format, args...))
+}
+
+func (gui *Gui) Warn(format string, args ...interface{}) {
+	gui.Messages.Post(SeverityWarning, fmt.Sprintf(format, args...))
+}
+
+func (gui *Gui) Error(format string, args ...interface{}) {
+	gui.Messages.Post(SeverityError, fmt.Sprintf(format, args...))
+}
+
+func (m *Messages) redraw() {
+	m.gui.g.Update(func(g *gocui.Gui) error {
+		m.gui.updateStatus()
+		if v, err := g.View("log"); err == nil {
+			m.draw(v)
+		}
+		return nil
+	})
+}
+
+func (m *Messages) toggle(g *gocui.Gui, v *gocui.View) error {
+	m.gui.ShowLog = !m.gui.ShowLog
+	if !m.gui.ShowLog && v != nil && v.Name() == "log" {
+		_, err := g.SetCurrentView("browser")
+		return err
+	}
+	return nil
+}
+
+func (m *Messages) scrollDown(g *gocui.Gui, v *gocui.View) error {
+	ox, oy := v.Origin()
+	if oy < m.maxOrigin(v) {
+		v.SetOrigin(ox, oy+1)
+	}
+	m.follow = oy+1 >= m.maxOrigin(v)
+	return nil
+}
+
+func (m *Messages) scrollUp(g *gocui.Gui, v *gocui.View) error {
+	ox, oy := v.Origin()
+	if oy > 0 {
+		v.SetOrigin(ox, oy-1)
+		m.follow = false
+	}
+	return nil
+}
+
+// maxOrigin is the origin that shows the newest message at the bottom.
+// Long messages wrap, so the lines are counted as shown.
+func (m *Messages) maxOrigin(v *gocui.View) int {
+	n := v.ViewLinesHeight()
+	if last, err := v.Line(v.LinesHeight() - 1); err == nil && last == "" {
+		n-- // After the final newline
+	}
+	_, height := v.Size()
+	if n > height {
+		return n - height
+	}
+	return 0
+}
+
+func (m *Messages) draw(v *gocui.View) {
+	m.mu.Lock()
+	log := m.log
+	m.mu.Unlock()
+
+	v.Clear()
+	v.Title = fmt.Sprintf(" Messages (%d) ", len(log))
+	for _, msg := range log {
+		fmt.Fprintf(v, "%s %s%-5s\x1b[0m %s\n", msg.Time.Format("15:04:05"), severityColor(msg.Severity), msg.Severity, msg.Text)
+	}
+	if len(log) == 0 {
+		fmt.Fprintln(v, "No messages this session")
+	}
+	if m.follow {
+		ox, _ := v.Origin()
+		v.SetOrigin(ox, m.maxOrigin(v))
+	}
+}
+
+// severityColor returns the ANSI color escape for the severity.
+func severityColor(s Severity) string {
+	switch s {
+	case SeverityWarning:
+		return "\x1b[33m"
+	case SeverityError:
+		return "\x1b[31m"
+	}
+	return "\x1b[32m"
+}
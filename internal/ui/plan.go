@@ -0,0 +1,220 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"lazycd/internal/core"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// PlanView is a modal listing a core.Plan for review before it runs.
+type PlanView struct {
+	gui *Gui
+
+	plan      *core.Plan
+	onConfirm func(plan *core.Plan) error
+	prevView  string
+}
+
+func NewPlanView(gui *Gui) *PlanView {
+	return &PlanView{gui: gui}
+}
+
+func (p *PlanView) Keybindings() error {
+	if err := p.gui.g.SetKeybinding("plan", 'j', gocui.ModNone, p.cursorDown); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("plan", gocui.KeyArrowDown, gocui.ModNone, p.cursorDown); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("plan", 'k', gocui.ModNone, p.cursorUp); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("plan", gocui.KeyArrowUp, gocui.ModNone, p.cursorUp); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("plan", gocui.KeySpace, gocui.ModNone, p.cycle); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("plan", gocui.KeyEnter, gocui.ModNone, p.confirm); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("plan", 'y', gocui.ModNone, p.confirm); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("plan", gocui.KeyEsc, gocui.ModNone, p.cancel); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("plan", 'n', gocui.ModNone, p.cancel); err != nil {
+		return err
+	}
+	// Swallow global keys that would act behind the modal
+	for _, key := range []interface{}{gocui.KeyTab, 'p', 'u', 'U', 'J', 'P'} {
+		if err := p.gui.g.SetKeybinding("plan", key, gocui.ModNone, noop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func noop(g *gocui.Gui, v *gocui.View) error {
+	return nil
+}
+
+// Show opens the plan for review. onConfirm runs when the user accepts it.
+func (p *PlanView) Show(plan *core.Plan, onConfirm func(plan *core.Plan) error) error {
+	g := p.gui.g
+	p.plan = plan
+	p.onConfirm = onConfirm
+	if cv := g.CurrentView(); cv != nil && cv.Name() != "plan" {
+		p.prevView = cv.Name()
+	}
+
+	maxX, maxY := g.Size()
+	v, err := g.SetView("plan", maxX/10, maxY/6, maxX*9/10, maxY*5/6, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Title = " Plan (Space: Change | Enter: Run | Esc: Cancel) "
+	v.Highlight = true
+	v.SelBgColor = gocui.ColorGreen
+	v.SelFgColor = gocui.ColorBlack
+	v.SetCursor(0, 0)
+	v.SetOrigin(0, 0)
+	p.draw(v)
+
+	_, err = g.SetCurrentView("plan")
+	return err
+}
+
+func (p *PlanView) draw(v *gocui.View) {
+	v.Clear()
+	plan := p.plan
+
+	for _, item := range plan.Items {
+		line := fmt.Sprintf("[%-9s] %-6s %s", item.Outcome, item.Op, item.Src)
+		if item.Dst != "" {
+			line += " -> " + item.Dst
+		}
+		if plan.Type == core.JobPut && item.Dst != "" && item.Dst != item.Target {
+			line += fmt.Sprintf(" (was %s)", filepath.Base(item.Target))
+		}
+		if item.Comparison != "" {
+			line += fmt.Sprintf(" {%s}", item.Comparison)
+		}
+		if len(item.Renamed) > 0 {
+			line += fmt.Sprintf(" (sanitized; %d entries inside renamed)", len(item.Renamed))
+		} else if item.Sanitized() {
+			line += " (sanitized)"
+		}
+		if item.Existing != "" && item.Existing != item.Target {
+			line += fmt.Sprintf(" (collides with %s)", filepath.Base(item.Existing))
+		}
+		if item.Runnable() {
+			if item.SameDevice {
+				line += "  [rename]"
+			} else {
+				line += "  " + formatBytes(item.Bytes)
+			}
+		}
+		if len(item.Errors) > 0 {
+			line += "  ! " + strings.Join(item.Errors, "; ")
+		}
+		fmt.Fprintln(v, line)
+	}
+
+	fmt.Fprintln(v, "")
+	for _, line := range plan.Preflight.Report() {
+		fmt.Fprintln(v, line)
+	}
+	if plan.Preflight.Blocked() {
+		fmt.Fprintln(v, "Blocked: skip the affected items (Space) or free up space before running.")
+	}
+	if plan.Type == core.JobPut {
+		fmt.Fprintf(v, "Put %d items to %s (policy: %s), %s to write\n", len(plan.Items), plan.TargetDir, plan.Policy, formatBytes(plan.TotalBytes))
+		if plan.Sanitize {
+			fmt.Fprintf(v, "Names are sanitized for %s\n", fsTypeName(plan.FSType))
+		}
+	} else if plan.Type == core.JobArchive {
+		fmt.Fprintf(v, "Archive %d items into %s (%s, %s layout), %s to pack\n", len(plan.Items), plan.ArchivePath(), plan.Archive.Format, plan.Archive.Layout, formatBytes(plan.TotalBytes))
+	} else {
+		fmt.Fprintf(v, "Delete %d items to trash, %s to write\n", len(plan.Items), formatBytes(plan.TotalBytes))
+	}
+}
+
+func (p *PlanView) cursorDown(g *gocui.Gui, v *gocui.View) error {
+	cx, cy := v.Cursor()
+	if cy < len(p.plan.Items)-1 {
+		return v.SetCursor(cx, cy+1)
+	}
+	return nil
+}
+
+func (p *PlanView) cursorUp(g *gocui.Gui, v *gocui.View) error {
+	cx, cy := v.Cursor()
+	if cy > 0 {
+		return v.SetCursor(cx, cy-1)
+	}
+	return nil
+}
+
+func (p *PlanView) cycle(g *gocui.Gui, v *gocui.View) error {
+	_, cy := v.Cursor()
+	p.plan.Cycle(cy)
+	p.draw(v)
+	return nil
+}
+
+func (p *PlanView) confirm(g *gocui.Gui, v *gocui.View) error {
+	if p.plan.Preflight.Blocked() {
+		return nil // Report is already shown in the view
+	}
+	plan, onConfirm := p.plan, p.onConfirm
+	if err := p.close(); err != nil {
+		return err
+	}
+	return onConfirm(plan)
+}
+
+func (p *PlanView) cancel(g *gocui.Gui, v *gocui.View) error {
+	return p.close()
+}
+
+func (p *PlanView) close() error {
+	p.plan = nil
+	p.onConfirm = nil
+	if err := p.gui.g.DeleteView("plan"); err != nil {
+		return err
+	}
+	prev := p.prevView
+	if prev == "" {
+		prev = "browser"
+	}
+	_, err := p.gui.g.SetCurrentView(prev)
+	return err
+}
+
+// fsTypeName names a filesystem type from core.FilesystemType for display.
+func fsTypeName(fsType string) string {
+	if fsType == "" {
+		return "an unknown filesystem"
+	}
+	return fsType
+}
+
+// formatBytes renders n with a binary unit suffix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
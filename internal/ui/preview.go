@@ -0,0 +1,150 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"lazycd/internal/preview"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// previewLines bounds the lines a preview renders.
+const previewLines = 200
+
+// previewDelay lets the cursor settle before a preview starts loading.
+const previewDelay = 50 * time.Millisecond
+
+// PreviewPane shows the item under the browser cursor. Previews load in
+// the background; moving the cursor cancels the one in flight. Its fields
+// are only touched on the UI goroutine.
+type PreviewPane struct {
+	gui *Gui
+
+	path    string // Shown or loading
+	cancel  context.CancelFunc
+	current *preview.Preview
+	err     error
+}
+
+func NewPreviewPane(gui *Gui) *PreviewPane {
+	return &PreviewPane{gui: gui}
+}
+
+func (p *PreviewPane) Keybindings() error {
+	if err := p.gui.g.SetKeybinding("", 'P', gocui.ModNone, p.toggle); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("preview", 'j', gocui.ModNone, scrollDown); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("preview", gocui.KeyArrowDown, gocui.ModNone, scrollDown); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("preview", 'k', gocui.ModNone, scrollUp); err != nil {
+		return err
+	}
+	if err := p.gui.g.SetKeybinding("preview", gocui.KeyArrowUp, gocui.ModNone, scrollUp); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *PreviewPane) toggle(g *gocui.Gui, v *gocui.View) error {
+	p.gui.ShowPreview = !p.gui.ShowPreview
+	if !p.gui.ShowPreview {
+		p.stop()
+		p.path = ""
+		if v != nil && v.Name() == "preview" {
+			_, err := g.SetCurrentView("browser")
+			return err
+		}
+		return nil
+	}
+	b := p.gui.focusedBrowser()
+	if bv, err := g.View(b.view); err == nil {
+		if item := b.currentItem(bv); item != nil {
+			p.Load(item.Path)
+		}
+	}
+	return nil
+}
+
+// Load starts loading the preview of path, canceling the previous one.
+func (p *PreviewPane) Load(path string) {
+	if !p.gui.ShowPreview {
+		return
+	}
+	p.stop()
+	p.path = path
+	p.current = nil
+	p.err = nil
+	p.Update()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(previewDelay):
+		}
+		pv, err := preview.Load(ctx, path, previewLines)
+		if ctx.Err() != nil {
+			return // Cursor moved on
+		}
+		p.gui.g.Update(func(g *gocui.Gui) error {
+			if p.path == path {
+				p.current, p.err = pv, err
+				if v, verr := g.View("preview"); verr == nil {
+					p.draw(v)
+				}
+			}
+			return nil
+		})
+	}()
+}
+
+func (p *PreviewPane) stop() {
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+}
+
+func (p *PreviewPane) Update() {
+	v, err := p.gui.g.View("preview")
+	if err != nil {
+		return // Pane hidden
+	}
+	p.gui.g.Update(func(g *gocui.Gui) error {
+		p.draw(v)
+		return nil
+	})
+}
+
+func (p *PreviewPane) draw(v *gocui.View) {
+	v.Clear()
+	v.SetOrigin(0, 0)
+	v.Title = " Preview "
+	switch {
+	case p.path == "":
+		fmt.Fprintln(v, "No selection")
+	case p.err != nil:
+		v.Title = fmt.Sprintf(" Preview: %s ", filepath.Base(p.path))
+		fmt.Fprintf(v, "Cannot preview: %v\n", p.err)
+	case p.current == nil:
+		v.Title = fmt.Sprintf(" Preview: %s ", filepath.Base(p.path))
+		fmt.Fprintln(v, "Loading...")
+	default:
+		v.Title = fmt.Sprintf(" Preview: %s (%s) ", filepath.Base(p.path), p.current.Title)
+		for _, line := range p.current.Lines {
+			fmt.Fprintln(v, line)
+		}
+		if len(p.current.Lines) == 0 {
+			fmt.Fprintln(v, "(empty)")
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// RecentList is a modal listing State.RecentDirs, most recent first, to
+// open one of them in the browser it was opened from.
+type RecentList struct {
+	gui     *Gui
+	browser *Browser
+}
+
+func NewRecentList(gui *Gui) *RecentList {
+	return &RecentList{gui: gui}
+}
+
+func (r *RecentList) Keybindings() error {
+	if err := r.gui.g.SetKeybinding("recent", 'j', gocui.ModNone, r.cursorDown); err != nil {
+		return err
+	}
+	if err := r.gui.g.SetKeybinding("recent", gocui.KeyArrowDown, gocui.ModNone, r.cursorDown); err != nil {
+		return err
+	}
+	if err := r.gui.g.SetKeybinding("recent", 'k', gocui.ModNone, r.cursorUp); err != nil {
+		return err
+	}
+	if err := r.gui.g.SetKeybinding("recent", gocui.KeyArrowUp, gocui.ModNone, r.cursorUp); err != nil {
+		return err
+	}
+	if err := r.gui.g.SetKeybinding("recent", gocui.KeyEnter, gocui.ModNone, r.confirm); err != nil {
+		return err
+	}
+	if err := r.gui.g.SetKeybinding("recent", gocui.KeyEsc, gocui.ModNone, r.cancel); err != nil {
+		return err
+	}
+	// Swallow global keys that would act behind the modal
+	for _, key := range []interface{}{gocui.KeyTab, 'p', 'u', 'U', 'J', 'P', 'D'} {
+		if err := r.gui.g.SetKeybinding("recent", key, gocui.ModNone, noop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Show opens the list for the browser of v.
+func (r *RecentList) Show(g *gocui.Gui, v *gocui.View) error {
+	if len(r.gui.State.RecentDirs) == 0 {
+		r.gui.Info("No recent directories")
+		return nil
+	}
+	r.browser = r.gui.browserOf(v)
+
+	maxX, maxY := g.Size()
+	rv, err := g.SetView("recent", maxX/6, maxY/6, maxX*5/6, maxY*5/6, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	rv.Title = " Recent directories (Enter: Open | Esc: Cancel) "
+	rv.Highlight = true
+	rv.SelBgColor = gocui.ColorGreen
+	rv.SelFgColor = gocui.ColorBlack
+	rv.Clear()
+	for _, dir := range r.gui.State.RecentDirs {
+		fmt.Fprintf(rv, " %s\n", dir)
+	}
+	rv.SetOrigin(0, 0)
+	rv.SetCursor(0, 0)
+
+	_, err = g.SetCurrentView("recent")
+	return err
+}
+
+func (r *RecentList) cursorDown(g *gocui.Gui, v *gocui.View) error {
+	return listDown(v, len(r.gui.State.RecentDirs))
+}
+
+func (r *RecentList) cursorUp(g *gocui.Gui, v *gocui.View) error {
+	return listUp(v)
+}
+
+// listDown moves the cursor of a list of n lines down one line, scrolling
+// at the bottom of the view.
+func listDown(v *gocui.View, n int) error {
+	if cursorIndex(v) >= n-1 {
+		return nil
+	}
+	cx, cy := v.Cursor()
+	if _, vy := v.Size(); cy >= vy-1 {
+		ox, oy := v.Origin()
+		return v.SetOrigin(ox, oy+1)
+	}
+	return v.SetCursor(cx, cy+1)
+}
+
+// listUp moves the cursor of a list up one line, scrolling at the top of
+// the view.
+func listUp(v *gocui.View) error {
+	cx, cy := v.Cursor()
+	if cy > 0 {
+		return v.SetCursor(cx, cy-1)
+	}
+	if ox, oy := v.Origin(); oy > 0 {
+		return v.SetOrigin(ox, oy-1)
+	}
+	return nil
+}
+
+func (r *RecentList) confirm(g *gocui.Gui, v *gocui.View) error {
+	i := cursorIndex(v)
+	if i < 0 || i >= len(r.gui.State.RecentDirs) {
+		return nil
+	}
+	dir := r.gui.State.RecentDirs[i]
+	if err := r.close(); err != nil {
+		return err
+	}
+	bv, err := g.View(r.browser.view)
+	if err != nil {
+		return err
+	}
+	r.browser.changeDir(bv, dir)
+	return nil
+}
+
+func (r *RecentList) cancel(g *gocui.Gui, v *gocui.View) error {
+	return r.close()
+}
+
+func (r *RecentList) close() error {
+	if err := r.gui.g.DeleteView("recent"); err != nil {
+		return err
+	}
+	_, err := r.gui.g.SetCurrentView(r.browser.view)
+	return err
+}
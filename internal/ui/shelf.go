@@ -3,7 +3,9 @@ package ui
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"lazycd/internal/fs"
 	"lazycd/internal/store"
 
 	"github.com/awesome-gocui/gocui"
@@ -14,12 +16,22 @@ type Shelf struct {
 	
 	// Selection state
 	selected map[string]struct{} // Set of IDs
+
+	// Remote items are checked for staleness in the background, as a stat
+	// may have to connect first. Only used on the UI goroutine.
+	missing map[string]bool      // Remote path -> gone at the last check
+	checked map[string]time.Time // Remote path -> when that check started
 }
 
+// remoteCheckInterval is how often a remote shelf item is checked again.
+const remoteCheckInterval = 30 * time.Second
+
 func NewShelf(gui *Gui) *Shelf {
 	return &Shelf{
 		gui:      gui,
 		selected: make(map[string]struct{}),
+		missing:  make(map[string]bool),
+		checked:  make(map[string]time.Time),
 	}
 }
 
@@ -48,9 +60,24 @@ func (s *Shelf) Keybindings() error {
 	if err := s.gui.g.SetKeybinding("shelf", 'x', gocui.ModNone, s.setModeMove); err != nil {
 		return err
 	}
+	if err := s.gui.g.SetKeybinding("shelf", 'c', gocui.ModNone, s.cyclePolicy); err != nil {
+		return err
+	}
+	if err := s.gui.g.SetKeybinding("shelf", 'v', gocui.ModNone, s.cycleVerify); err != nil {
+		return err
+	}
+	if err := s.gui.g.SetKeybinding("shelf", 'n', gocui.ModNone, s.cycleSanitize); err != nil {
+		return err
+	}
+	if err := s.gui.g.SetKeybinding("shelf", 'R', gocui.ModNone, s.resumePartials); err != nil {
+		return err
+	}
 	if err := s.gui.g.SetKeybinding("shelf", 'd', gocui.ModNone, s.executeDelete); err != nil {
 		return err
 	}
+	if err := s.gui.g.SetKeybinding("shelf", 'A', gocui.ModNone, s.executeArchive); err != nil {
+		return err
+	}
 	// 'p' is global or shelf specific? Plan says shelf item to target. Usually 'p' in browser or shelf?
 	// Plan said: "p = shelf 선택 항목을 target으로 put" (H3). Browser keybinding mentions p too.
 	// Let's bind 'p' globally or in both views that calls executePut.
@@ -149,6 +176,20 @@ func (s *Shelf) remove(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+// clampCursor keeps the shelf cursor on an existing item after removals.
+func (s *Shelf) clampCursor() {
+	v, err := s.gui.g.View("shelf")
+	if err != nil {
+		return
+	}
+	cx, cy := v.Cursor()
+	if last := len(s.gui.State.ShelfItems) - 1; cy > last && last >= 0 {
+		v.SetCursor(cx, last)
+	} else if last < 0 {
+		v.SetCursor(cx, 0)
+	}
+}
+
 func (s *Shelf) currentItem(v *gocui.View) *store.ShelfItem {
 	_, cy := v.Cursor()
 	if cy >= 0 && cy < len(s.gui.State.ShelfItems) {
@@ -174,7 +215,7 @@ func (s *Shelf) Update() {
 			
 			// Check stale
 			staleMark := ""
-			if _, err := os.Stat(item.AbsPath); os.IsNotExist(err) {
+			if s.isMissing(item.AbsPath) {
 				staleMark = " (!)"
 			}
 			
@@ -183,3 +224,27 @@ func (s *Shelf) Update() {
 		return nil
 	})
 }
+
+// isMissing reports whether path no longer exists. Remote paths report
+// the last background check and start a new one when it is due.
+func (s *Shelf) isMissing(path string) bool {
+	if !fs.IsRemote(path) && !fs.IsS3(path) {
+		_, err := fs.Stat(path)
+		return os.IsNotExist(err)
+	}
+	if time.Since(s.checked[path]) >= remoteCheckInterval {
+		s.checked[path] = time.Now()
+		go func() {
+			_, err := fs.Stat(path)
+			missing := os.IsNotExist(err)
+			s.gui.g.Update(func(g *gocui.Gui) error {
+				if s.missing[path] != missing {
+					s.missing[path] = missing
+					s.Update()
+				}
+				return nil
+			})
+		}()
+	}
+	return s.missing[path]
+}
@@ -1,8 +1,6 @@
 package ui
 
 import (
-	"path/filepath"
-
 	"lazycd/internal/core"
 	"lazycd/internal/store"
 
@@ -49,6 +47,54 @@ func (s *Shelf) setMode(mode store.OpMode) {
 	s.Update()
 }
 
+// cycleVerify switches to the next post-copy checksum mode.
+func (s *Shelf) cycleVerify(g *gocui.Gui, v *gocui.View) error {
+	current := core.HashAlgo(s.gui.State.VerifyAlgo)
+	next := core.HashAlgos[0]
+	for i, algo := range core.HashAlgos {
+		if algo == current {
+			next = core.HashAlgos[(i+1)%len(core.HashAlgos)]
+			break
+		}
+	}
+	s.gui.State.VerifyAlgo = string(next)
+	s.gui.Info("Verify: %s", next)
+	s.gui.updateStatus()
+	return nil
+}
+
+// cyclePolicy switches to the next conflict policy used by Put.
+func (s *Shelf) cyclePolicy(g *gocui.Gui, v *gocui.View) error {
+	current := s.gui.conflictPolicy()
+	next := core.Policies[0]
+	for i, policy := range core.Policies {
+		if policy == current {
+			next = core.Policies[(i+1)%len(core.Policies)]
+			break
+		}
+	}
+	s.gui.State.ConflictPolicy = string(next)
+	s.gui.Info("Conflict policy: %s", next)
+	s.gui.updateStatus()
+	return nil
+}
+
+// cycleSanitize switches to the next filename sanitization mode used by Put.
+func (s *Shelf) cycleSanitize(g *gocui.Gui, v *gocui.View) error {
+	current := s.gui.sanitizeMode()
+	next := core.SanitizeModes[0]
+	for i, mode := range core.SanitizeModes {
+		if mode == current {
+			next = core.SanitizeModes[(i+1)%len(core.SanitizeModes)]
+			break
+		}
+	}
+	s.gui.State.Sanitize = string(next)
+	s.gui.Info("Name sanitization: %s", next)
+	s.gui.updateStatus()
+	return nil
+}
+
 func (s *Shelf) executeDelete(g *gocui.Gui, v *gocui.View) error {
 	// Items to delete
 	var targets []int
@@ -75,48 +121,43 @@ func (s *Shelf) executeDelete(g *gocui.Gui, v *gocui.View) error {
 		return nil
 	}
 	
-	// Create Job
-	job := s.gui.JobMgr.CreateJob(core.JobDelete)
-	
-	// Execute
+	paths := make([]string, 0, len(targets))
 	for _, idx := range targets {
-		item := s.gui.State.ShelfItems[idx]
-		
-		trashPath, err := core.DeleteToTrash(item.AbsPath, job.ID)
-		
-		jobItem := core.JobItem{
-			Src:    item.AbsPath,
-			Op:     "delete",
-			Status: core.StatusOK,
-			TrashPath: trashPath,
-		}
-		
-		if err != nil {
-			jobItem.Status = core.StatusError
-			jobItem.Error = err.Error()
-		}
-		
-		job.Items = append(job.Items, jobItem)
+		paths = append(paths, s.gui.State.ShelfItems[idx].AbsPath)
 	}
 	
-	// Save Job
-	s.gui.JobMgr.SaveJob(job)
-	
-	// Remove from shelf
-	s.remove(g, v) // Reuse remove logic which handles selection clearing
+	plan := core.PlanDelete(paths)
+	return s.gui.Plan.Show(plan, func(plan *core.Plan) error {
+		opts := core.PutOptions{Parallelism: s.gui.State.Parallelism}
+		if err := s.gui.Jobs.Enqueue(plan, opts, s.deleteDone); err != nil {
+			s.gui.Error("Delete not started: %v", err) // Nothing was written
+			return nil
+		}
+		s.gui.Info("Queued delete of %d items", len(plan.Items))
+		s.selected = make(map[string]struct{}) // Clear selection
+		s.Update()
+		return nil
+	})
+}
+
+// deleteDone updates the shelf once a delete job has finished.
+func (s *Shelf) deleteDone(job *core.Job) {
+	// Remove deleted items from shelf; failed ones stay for another try
+	s.gui.State.RemoveShelfPaths(job.Succeeded("delete"))
+	s.clampCursor()
 	
+	s.Update()
+	s.gui.updateStatus()
+	s.gui.reportJob(job)
 	// Refresh browser if we deleted something in current view
-	if s.gui.Browser != nil {
-		s.gui.Browser.Refresh()
-	}
-	
-	return nil
+	s.gui.refreshBrowser()
 }
 
 func (s *Shelf) executePut(g *gocui.Gui, v *gocui.View) error {
 	targetDir := s.gui.State.TargetDir
 	if targetDir == "" {
-		return nil // No target
+		s.gui.Warn("No target directory; set one with t in the browser")
+		return nil
 	}
 	
 	// Items to put: All items in shelf? Or selected?
@@ -126,106 +167,87 @@ func (s *Shelf) executePut(g *gocui.Gui, v *gocui.View) error {
 	// However, if nothing selected, maybe all?
 	// Let's assume: if selection exists, put selection. If NO selection, put ALL shelf items.
 	
-	var targets []store.ShelfItem
-	if len(s.selected) > 0 {
-		for _, item := range s.gui.State.ShelfItems {
-			if _, ok := s.selected[item.ID]; ok {
-				targets = append(targets, item)
-			}
-		}
-	} else {
-		targets = s.gui.State.ShelfItems
-	}
-	
+	targets := s.putTargets()
 	if len(targets) == 0 {
 		return nil
 	}
 	
-	job := s.gui.JobMgr.CreateJob(core.JobPut)
-	
+	items := make([]core.PutItem, 0, len(targets))
 	for _, item := range targets {
-		dst := filepath.Join(targetDir, filepath.Base(item.AbsPath))
-		
-		// Conflict Check
-		finalDst, err := core.ResolveConflict(item.AbsPath, dst, core.PolicyRename) // Default to Rename for now as per MVP safe default or Skip? Spec says "기본 skip" (F2).
-		// Wait, Spec says "Basic conflict policy: skip". "Override: skip | rename | overwrite".
-		// H3 says "기본 skip로 실행".
-		// But "P(대문자) or modal...".
-		// Let's implement Skip as default.
-		
-		finalDst, err = core.ResolveConflict(item.AbsPath, dst, core.PolicySkip)
-		if err != nil {
-			// Log error
-			continue
-		}
-		
-		if finalDst == "" {
-			// Skipped
-			job.Items = append(job.Items, core.JobItem{
-				Src: item.AbsPath,
-				Dst: dst,
-				Op: string(item.OpMode),
-				Status: core.StatusSkipped,
-			})
-			continue
-		}
-		
-		// Execute Op
-		var opErr error
-		if item.OpMode == store.OpMove {
-			opErr = core.Move(item.AbsPath, finalDst)
-		} else {
-			if item.Type == "dir" {
-				opErr = core.CopyDir(item.AbsPath, finalDst)
-			} else {
-				opErr = core.CopyFile(item.AbsPath, finalDst)
-			}
-		}
-		
-		jobItem := core.JobItem{
-			Src: item.AbsPath,
-			Dst: finalDst,
-			Op: string(item.OpMode),
-			CreatedPath: finalDst,
-			Status: core.StatusOK,
-		}
-		
-		if opErr != nil {
-			jobItem.Status = core.StatusError
-			jobItem.Error = opErr.Error()
-		}
-		
-		job.Items = append(job.Items, jobItem)
+		items = append(items, core.PutItem{Src: item.AbsPath, Op: string(item.OpMode)})
 	}
 	
-	s.gui.JobMgr.SaveJob(job)
+	// Spec says "기본 skip" (F2): Put runs with the Skip policy by default.
+	opts := core.PutOptions{
+		TargetDir:      targetDir,
+		Policy:         s.gui.conflictPolicy(),
+		RenameTemplate: s.gui.State.RenameTemplate,
+		Verify:         core.HashAlgo(s.gui.State.VerifyAlgo),
+		Parallelism:    s.gui.State.Parallelism,
+		Sanitize:       s.gui.sanitizeMode(),
+	}
 	
+	plan := core.PlanPut(items, opts)
+	return s.gui.Plan.Show(plan, func(plan *core.Plan) error {
+		if err := s.gui.Jobs.Enqueue(plan, opts, s.putDone); err != nil {
+			s.gui.Error("Put not started: %v", err) // Nothing was written
+			return nil
+		}
+		s.gui.Info("Queued put of %d items to %s", len(plan.Items), plan.TargetDir)
+		s.selected = make(map[string]struct{}) // Clear selection
+		s.Update()
+		return nil
+	})
+}
+
+// putDone updates the shelf once a put job has finished.
+func (s *Shelf) putDone(job *core.Job) {
 	// If Move success, remove from shelf? 
 	// Spec doesn't explicitly say to remove from shelf after Put. 
 	// But logically Move should remove. Copy should keep?
 	// Let's remove successfully moved items.
+	s.gui.State.RemoveShelfPaths(job.Succeeded("move"))
+	s.clampCursor()
 	
-	var newShelf []store.ShelfItem
-	for _, item := range s.gui.State.ShelfItems {
-		// check if this item was processed successfully as Move
-		removed := false
-		for _, ji := range job.Items {
-			if ji.Src == item.AbsPath && ji.Op == "move" && ji.Status == core.StatusOK {
-				removed = true
-				break
-			}
-		}
-		if !removed {
-			newShelf = append(newShelf, item)
-		}
+	s.Update()
+	s.gui.reportJob(job)
+	s.gui.refreshBrowser()
+}
+
+// resumePartials queues a job continuing every interrupted copy left in
+// the target directory or below it.
+func (s *Shelf) resumePartials(g *gocui.Gui, v *gocui.View) error {
+	targetDir := s.gui.State.TargetDir
+	if targetDir == "" {
+		s.gui.Warn("No target directory; set one with t in the browser")
+		return nil
 	}
-	s.gui.State.ShelfItems = newShelf
-	s.selected = make(map[string]struct{}) // Clear selection
 	
-	s.Update()
-	if s.gui.Browser != nil {
-		s.gui.Browser.Refresh()
+	partials, err := core.FindPartials(targetDir)
+	if err != nil {
+		s.gui.Error("Cannot look for interrupted transfers: %v", err)
+		return nil
+	}
+	if len(partials) == 0 {
+		s.gui.Info("No interrupted transfers in %s", targetDir)
+		return nil
 	}
 	
+	opts := core.PutOptions{
+		TargetDir: targetDir,
+		Verify:    core.HashAlgo(s.gui.State.VerifyAlgo),
+	}
+	plan := core.PlanResume(partials, targetDir)
+	if err := s.gui.Jobs.Enqueue(plan, opts, s.resumeDone); err != nil {
+		s.gui.Error("Resume not started: %v", err)
+		return nil
+	}
+	s.gui.Info("Queued resume of %d interrupted transfers in %s", len(partials), targetDir)
 	return nil
 }
+
+// resumeDone reports a finished resume job.
+func (s *Shelf) resumeDone(job *core.Job) {
+	s.gui.reportJob(job)
+	s.gui.refreshBrowser()
+}
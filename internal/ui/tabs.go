@@ -0,0 +1,162 @@
+package ui
+
+import (
+	"slices"
+	"sort"
+
+	"lazycd/internal/store"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// Browser tabs. The main browser shows the active tab of State.Tabs; the
+// others keep the directory, cursor, selection, sort order, hidden-file
+// setting and history they were left with. Number keys switch between them.
+
+const maxTabs = 9 // One per number key
+
+// initTabs opens the active tab in State.LastDir, the directory lazycd
+// starts in, creating the first tab if there is none.
+func (b *Browser) initTabs() {
+	st := b.gui.State
+	if len(st.Tabs) == 0 {
+		st.Tabs = []store.Tab{{Dir: st.LastDir}}
+	}
+	if st.ActiveTab < 0 || st.ActiveTab >= len(st.Tabs) {
+		st.ActiveTab = 0
+	}
+	tab := &st.Tabs[st.ActiveTab]
+	if tab.Dir != st.LastDir {
+		// Started elsewhere; back returns to where the tab was left
+		if tab.Dir != "" {
+			tab.Back = pushHistory(tab.Back, tab.Dir)
+			tab.Forward = nil
+		}
+		tab.Dir = st.LastDir
+		tab.Cursor = 0
+	}
+	b.loadTab(*tab)
+}
+
+// loadTab takes over the directory and settings of tab; the cursor is set
+// once the listing is shown.
+func (b *Browser) loadTab(tab store.Tab) {
+	b.gui.State.LastDir = tab.Dir
+	b.sortBy = tab.Sort
+	b.showHidden = tab.ShowHidden
+	b.back = slices.Clone(tab.Back) // Tabs opened from this one share the arrays
+	b.forward = slices.Clone(tab.Forward)
+	b.selected = make(map[string]struct{}, len(tab.Selected))
+	for _, path := range tab.Selected {
+		b.selected[path] = struct{}{}
+	}
+}
+
+// saveTab stores the state of the browser view v in the active tab.
+func (b *Browser) saveTab(v *gocui.View) {
+	tab := store.Tab{
+		Dir:        b.gui.State.LastDir,
+		Cursor:     cursorIndex(v),
+		Sort:       b.sortBy,
+		ShowHidden: b.showHidden,
+		Back:       b.back,
+		Forward:    b.forward,
+	}
+	for path := range b.selected {
+		tab.Selected = append(tab.Selected, path)
+	}
+	sort.Strings(tab.Selected)
+	b.gui.State.Tabs[b.gui.State.ActiveTab] = tab
+}
+
+// restoreCursor puts the cursor of v back where the active tab left it.
+func (b *Browser) restoreCursor(v *gocui.View) {
+	b.selectIndex(v, b.gui.State.Tabs[b.gui.State.ActiveTab].Cursor)
+}
+
+// openTab shows the active tab in the browser view v. A directory that
+// cannot be listed any more is reported and shown empty, so the tab can
+// still be navigated away from or closed.
+func (b *Browser) openTab(v *gocui.View) {
+	tab := b.gui.State.Tabs[b.gui.State.ActiveTab]
+	b.loadTab(tab)
+	if err := b.Refresh(); err != nil {
+		b.items = nil
+		b.UpdateView()
+		b.gui.Error("Cannot list %s: %v", tab.Dir, err)
+	}
+	b.restoreCursor(v)
+	b.cursorMoved(v)
+	b.gui.updateStatus()
+}
+
+func (b *Browser) tabKeybindings() error {
+	for i := 0; i < maxTabs; i++ {
+		tab := i
+		switchTab := func(g *gocui.Gui, v *gocui.View) error {
+			return b.switchTab(v, tab)
+		}
+		if err := b.gui.g.SetKeybinding(b.view, rune('1'+i), gocui.ModNone, switchTab); err != nil {
+			return err
+		}
+	}
+	if err := b.gui.g.SetKeybinding(b.view, gocui.KeyCtrlT, gocui.ModNone, b.newTab); err != nil {
+		return err
+	}
+	if err := b.gui.g.SetKeybinding(b.view, gocui.KeyCtrlW, gocui.ModNone, b.closeTab); err != nil {
+		return err
+	}
+	return nil
+}
+
+// switchTab makes tab i (from 0) the active tab.
+func (b *Browser) switchTab(v *gocui.View, i int) error {
+	st := b.gui.State
+	if i == st.ActiveTab {
+		return nil
+	}
+	if i >= len(st.Tabs) {
+		b.gui.Warn("No tab %d; Ctrl+T opens a new one", i+1)
+		return nil
+	}
+	b.saveTab(v)
+	st.ActiveTab = i
+	b.openTab(v)
+	return nil
+}
+
+// newTab opens a tab on the current directory, with the current sort
+// order and hidden-file setting, after the last one.
+func (b *Browser) newTab(g *gocui.Gui, v *gocui.View) error {
+	st := b.gui.State
+	if len(st.Tabs) >= maxTabs {
+		b.gui.Warn("At most %d tabs can be open", maxTabs)
+		return nil
+	}
+	b.saveTab(v)
+	tab := st.Tabs[st.ActiveTab]
+	tab.Selected = nil
+	st.Tabs = append(st.Tabs, tab)
+	st.ActiveTab = len(st.Tabs) - 1
+	b.openTab(v)
+	b.gui.Info("Opened tab %d", st.ActiveTab+1)
+	return nil
+}
+
+// closeTab closes the active tab and shows the one after it, or the one
+// before if it was the last.
+func (b *Browser) closeTab(g *gocui.Gui, v *gocui.View) error {
+	st := b.gui.State
+	if len(st.Tabs) == 1 {
+		b.gui.Warn("The last tab cannot be closed")
+		return nil
+	}
+	closed := st.ActiveTab
+	st.Tabs = append(st.Tabs[:closed], st.Tabs[closed+1:]...)
+	if st.ActiveTab >= len(st.Tabs) {
+		st.ActiveTab = len(st.Tabs) - 1
+	}
+	b.openTab(v)
+	b.gui.Info("Closed tab %d", closed+1)
+	return nil
+}
@@ -1,29 +1,314 @@
 package ui
 
 import (
+	"fmt"
+	"path/filepath"
+
+	"lazycd/internal/core"
+
 	"github.com/awesome-gocui/gocui"
 )
 
+// UndoView is a modal asking whether to undo items changed since their
+// job, and listing the result of the last undo item by item.
+type UndoView struct {
+	gui *Gui
+
+	job      *core.Job // Awaiting confirmation, nil when showing a result
+	opts     core.UndoOptions
+	prevView string
+
+	last    *core.UndoResult // Result of the last undo this session
+	lastErr error            // Error saving the job record afterwards
+
+	skipped map[string]struct{} // Jobs stepped past this session
+}
+
+func NewUndoView(gui *Gui) *UndoView {
+	return &UndoView{gui: gui, skipped: make(map[string]struct{})}
+}
+
+func (u *UndoView) Keybindings() error {
+	if err := u.gui.g.SetKeybinding("undo", 'y', gocui.ModNone, u.confirm); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", gocui.KeyEnter, gocui.ModNone, u.confirm); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", 'n', gocui.ModNone, u.cancel); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", gocui.KeyEsc, gocui.ModNone, u.cancel); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", 's', gocui.ModNone, u.skipJob); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", 'u', gocui.ModNone, u.retry); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", 'j', gocui.ModNone, scrollDown); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", gocui.KeyArrowDown, gocui.ModNone, scrollDown); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", 'k', gocui.ModNone, scrollUp); err != nil {
+		return err
+	}
+	if err := u.gui.g.SetKeybinding("undo", gocui.KeyArrowUp, gocui.ModNone, scrollUp); err != nil {
+		return err
+	}
+	// Swallow global keys that would act behind the modal
+	for _, key := range []interface{}{gocui.KeyTab, 'p', 'U', 'J', 'P'} {
+		if err := u.gui.g.SetKeybinding("undo", key, gocui.ModNone, noop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoLastJob undoes the newest saved job that has something to undo, is
+// not queued or running and was not skipped. Items changed since the job
+// are listed for confirmation first.
 func (gui *Gui) undoLastJob(g *gocui.Gui, v *gocui.View) error {
-	jobs, err := gui.JobMgr.GetRecentJobs(1)
+	lastJob, err := gui.JobMgr.LastUndoable(gui.Undo.skipped)
 	if err != nil {
+		gui.Error("Undo: cannot read jobs: %v", err)
 		return nil
 	}
-	
-	if len(jobs) == 0 {
-		return nil // Nothing to undo
+	if lastJob == nil {
+		gui.Info("Nothing to undo")
+		return nil
+	}
+
+	// Restores keep both when something took an original path meanwhile;
+	// the Put policy is about the target, not about what undo finds there
+	opts := core.UndoOptions{
+		Verify: gui.State.VerifyAlgo != "",
+		Policy: core.PolicyRename,
+	}
+	if changed := gui.JobMgr.CheckUndo(lastJob, opts); len(changed) > 0 {
+		return gui.Undo.confirmChanged(lastJob, opts, changed)
+	}
+	return gui.Undo.run(lastJob, opts)
+}
+
+// confirmChanged asks whether to undo job although items changed.
+func (u *UndoView) confirmChanged(job *core.Job, opts core.UndoOptions, changed []core.UndoItem) error {
+	u.job = job
+	u.opts = opts
+	v, err := u.open(" Changed since the job (y: Undo anyway | n: Cancel | s: Skip job) ")
+	if err != nil {
+		return err
+	}
+	for _, item := range changed {
+		fmt.Fprintf(v, "%-6s %s: %s\n", item.Op, item.Path, item.Reason)
+	}
+	fmt.Fprintln(v, "")
+	fmt.Fprintf(v, "Undoing replaces or deletes %d changed items.\n", len(changed))
+	return nil
+}
+
+// run undoes job, reports a summary in the status bar and lists the
+// items in detail if any was not restored.
+func (u *UndoView) run(job *core.Job, opts core.UndoOptions) error {
+	result, err := u.gui.JobMgr.Undo(job, opts)
+	u.last, u.lastErr = result, err
+
+	u.gui.refreshBrowser()
+
+	// Items left alone go to the log; the summary is the toast
+	for _, item := range result.Items {
+		if item.Outcome != core.UndoRestored {
+			u.gui.Warn("Undo %s %s: %s (%s)", item.Op, item.Path, item.Outcome, item.Reason)
+		}
+	}
+	summary := undoSummary(result, err) + " (U: Details)"
+	switch {
+	case err != nil:
+		u.gui.Error("%s: %v", summary, err)
+	case result.Count(core.UndoRestored) < len(result.Items):
+		u.gui.Warn("%s", summary)
+	default:
+		u.gui.Info("%s", summary)
+		return nil
+	}
+	return u.showResult()
+}
+
+// showLast shows the result of the last undo again.
+func (u *UndoView) showLast(g *gocui.Gui, v *gocui.View) error {
+	if u.last == nil {
+		u.gui.Info("Nothing undone this session")
+		return nil
+	}
+	return u.showResult()
+}
+
+// undoSummary counts the outcomes of an undo in one line.
+func undoSummary(result *core.UndoResult, err error) string {
+	if len(result.Items) == 0 {
+		return "Undo: nothing to restore"
+	}
+	line := fmt.Sprintf("Undo: %d of %d restored", result.Count(core.UndoRestored), len(result.Items))
+	for _, outcome := range []core.UndoOutcome{core.UndoChanged, core.UndoSkipped, core.UndoFailed} {
+		if n := result.Count(outcome); n > 0 {
+			line += fmt.Sprintf(", %d %s", n, outcome)
+		}
+	}
+	if err != nil {
+		line += ", job record not updated"
+	}
+	return line
+}
+
+// showResult lists the last undo: what was restored where, and what was
+// not and why.
+func (u *UndoView) showResult() error {
+	result := u.last
+	v, err := u.open(" " + undoSummary(result, u.lastErr) + " (Esc: Close) ")
+	if err != nil {
+		return err
+	}
+
+	var restored, left []core.UndoItem
+	for _, item := range result.Items {
+		if item.Outcome == core.UndoRestored {
+			restored = append(restored, item)
+		} else {
+			left = append(left, item)
+		}
+	}
+
+	if len(left) > 0 {
+		fmt.Fprintln(v, "Not restored:")
+		for _, item := range left {
+			fmt.Fprintf(v, "  [%-7s] %-6s %s: %s\n", item.Outcome, item.Op, item.Path, item.Reason)
+		}
+		fmt.Fprintln(v, "")
+	}
+	if len(restored) > 0 {
+		fmt.Fprintln(v, "Restored:")
+		for _, item := range restored {
+			fmt.Fprintf(v, "  %-6s %s\n", item.Op, undoneAction(item))
+			if item.SetAside != "" {
+				fmt.Fprintf(v, "         (replaced entry kept at %s)\n", item.SetAside)
+			}
+		}
+		fmt.Fprintln(v, "")
 	}
-	
-	lastJob := jobs[0]
-	if err := gui.JobMgr.Undo(lastJob); err != nil {
-		// Show error log?
+	if u.lastErr != nil {
+		fmt.Fprintf(v, "Job record not updated: %v\n", u.lastErr)
 	}
-	
-	// Refresh views
-	if gui.Browser != nil {
-		gui.Browser.Refresh()
+	if len(left) > 0 {
+		fmt.Fprintln(v, "Press u to retry the items not restored, or s to skip this job so u undoes the one before it.")
+	}
+	return nil
+}
+
+// undoneAction describes what undo did with a restored item.
+func undoneAction(item core.UndoItem) string {
+	if item.Op == "copy" || item.Op == "archive" {
+		return "removed " + item.Path
+	}
+	to := item.Src
+	if item.RestoredTo != "" {
+		to = item.RestoredTo + " (renamed, " + filepath.Base(item.Src) + " is taken)"
+	}
+	return item.Path + " -> " + to
+}
+
+func (u *UndoView) open(title string) (*gocui.View, error) {
+	g := u.gui.g
+	if cv := g.CurrentView(); cv != nil && cv.Name() != "undo" {
+		u.prevView = cv.Name()
+	}
+
+	maxX, maxY := g.Size()
+	v, err := g.SetView("undo", maxX/10, maxY/4, maxX*9/10, maxY*3/4, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return nil, err
+	}
+	v.Title = title
+	v.Wrap = true
+	v.Clear()
+	v.SetOrigin(0, 0)
+
+	_, err = g.SetCurrentView("undo")
+	return v, err
+}
+
+func (u *UndoView) confirm(g *gocui.Gui, v *gocui.View) error {
+	job, opts := u.job, u.opts
+	if err := u.close(); err != nil {
+		return err
+	}
+	if job == nil {
+		return nil // Result view
+	}
+	opts.Force = true
+	return u.run(job, opts)
+}
+
+// skipJob steps past the job awaiting confirmation or left partly undone
+// for the rest of the session, so the next undo takes the job before it.
+func (u *UndoView) skipJob(g *gocui.Gui, v *gocui.View) error {
+	var id string
+	switch {
+	case u.job != nil:
+		id = u.job.ID
+	case u.last != nil && u.last.Count(core.UndoRestored) < len(u.last.Items):
+		id = u.last.JobID
+	default:
+		return nil // Nothing left to skip
+	}
+	u.skipped[id] = struct{}{}
+	if err := u.close(); err != nil {
+		return err
+	}
+	u.gui.Info("Skipped job %s; u undoes the job before it", id)
+	return nil
+}
+
+// retry closes the result of the last undo and undoes again, which takes
+// the same job while items of it are left and it was not skipped.
+func (u *UndoView) retry(g *gocui.Gui, v *gocui.View) error {
+	if u.job != nil {
+		return nil // Awaiting confirmation
+	}
+	if err := u.close(); err != nil {
+		return err
+	}
+	return u.gui.undoLastJob(g, v)
+}
+
+func (u *UndoView) cancel(g *gocui.Gui, v *gocui.View) error {
+	return u.close()
+}
+
+func (u *UndoView) close() error {
+	u.job = nil
+	if err := u.gui.g.DeleteView("undo"); err != nil {
+		return err
+	}
+	prev := u.prevView
+	if prev == "" {
+		prev = "browser"
+	}
+	_, err := u.gui.g.SetCurrentView(prev)
+	return err
+}
+
+func scrollDown(g *gocui.Gui, v *gocui.View) error {
+	ox, oy := v.Origin()
+	return v.SetOrigin(ox, oy+1)
+}
+
+func scrollUp(g *gocui.Gui, v *gocui.View) error {
+	ox, oy := v.Origin()
+	if oy > 0 {
+		return v.SetOrigin(ox, oy-1)
 	}
-	gui.updateStatus()
-	
 	return nil
 }